@@ -0,0 +1,429 @@
+package main
+
+import (
+	"ArticleForum/internal/archive"
+	"ArticleForum/internal/config"
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+	storage storage.Storage
+	in      io.Reader
+	out     io.Writer
+	json    bool
+
+	// cfg and open describe the source storage and open the destination of
+	// `data copy` and `data verify`
+	cfg  *config.Config
+	open func(cfg *config.Config, migrate bool) (storage.Storage, error)
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	group, command, args := args[0], args[1], args[2:]
+
+	switch group + " " + command {
+	case "posts list":
+		return c.listPosts(ctx)
+	case "posts show":
+		return c.withID(args, func(id string) error { return c.showPost(ctx, id) })
+	case "posts create":
+		return c.createPost(ctx, args)
+	case "posts lock":
+		return c.withID(args, func(id string) error { return c.setCommentsEnabled(ctx, id, false) })
+	case "posts unlock":
+		return c.withID(args, func(id string) error { return c.setCommentsEnabled(ctx, id, true) })
+	case "posts delete":
+		return c.withID(args, func(id string) error { return c.deletePost(ctx, id) })
+	case "comments list":
+		return c.listComments(ctx, args)
+	case "comments purge":
+		return c.withID(args, func(id string) error { return c.purgeComments(ctx, id) })
+	case "users list":
+		return c.listUsers(ctx)
+	case "users show":
+		return c.withID(args, func(username string) error { return c.showUser(ctx, username) })
+	case "data export":
+		return c.exportData(ctx, args)
+	case "data import":
+		return c.importData(ctx, args)
+	case "data copy":
+		return c.copyData(ctx, args, false)
+	case "data verify":
+		return c.copyData(ctx, args, true)
+	default:
+		return errUsage
+	}
+}
+
+func (c *cli) withID(args []string, fn func(id string) error) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return fn(args[0])
+}
+
+func (c *cli) listPosts(ctx context.Context) error {
+	posts, err := c.storage.GetAllPosts(ctx)
+	if err != nil {
+		return err
+	}
+	return c.printPosts(posts)
+}
+
+func (c *cli) showPost(ctx context.Context, id string) error {
+	post, err := c.storage.GetPost(ctx, id)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return fmt.Errorf("post %s not found", id)
+	}
+	return c.printPosts([]*domain.Post{post})
+}
+
+func (c *cli) createPost(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts create", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	title := flags.String("title", "", "Post title")
+	content := flags.String("content", "", "Post content")
+	author := flags.String("author", "", "Author username")
+	markdown := flags.Bool("markdown", false, "Content is Markdown")
+	locked := flags.Bool("locked", false, "Create the post with comments disabled")
+	if err := flags.Parse(args); err != nil || *title == "" || flags.NArg() > 0 {
+		return errUsage
+	}
+
+	format := domain.ContentFormatPlain
+	if *markdown {
+		format = domain.ContentFormatMarkdown
+	}
+	if *author != "" {
+		if _, err := c.storage.EnsureUser(ctx, *author); err != nil {
+			return err
+		}
+	}
+
+	post, err := c.storage.CreatePost(ctx, *author, *title, *content, format, !*locked)
+	if err != nil {
+		return err
+	}
+	return c.printPosts([]*domain.Post{post})
+}
+
+func (c *cli) setCommentsEnabled(ctx context.Context, id string, enabled bool) error {
+	post, err := c.storage.SetCommentsEnabled(ctx, id, enabled)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return fmt.Errorf("post %s not found", id)
+	}
+	return c.printPosts([]*domain.Post{post})
+}
+
+func (c *cli) deletePost(ctx context.Context, id string) error {
+	deleted, err := c.storage.DeletePost(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("post %s not found", id)
+	}
+	return c.printResult(map[string]any{"deleted": id}, "deleted post %s", id)
+}
+
+func (c *cli) listComments(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	postID := args[0]
+
+	flags := flag.NewFlagSet("comments list", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	limit := flags.Int("limit", 50, "Maximum number of comments")
+	offset := flags.Int("offset", 0, "Number of comments to skip")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 || *limit < 0 || *offset < 0 {
+		return errUsage
+	}
+
+	comments, err := c.storage.GetComments(ctx, postID, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	if comments == nil {
+		comments = []*domain.Comment{}
+	}
+	if c.json {
+		return c.printJSON(comments)
+	}
+
+	w := c.table("ID", "PARENT", "AUTHOR", "CREATED", "CONTENT")
+	for _, comment := range comments {
+		parent := "-"
+		if comment.ParentID != nil {
+			parent = *comment.ParentID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", comment.ID, parent, orDash(comment.Author),
+			comment.CreatedAt.Format(time.RFC3339), truncate(comment.Content, 40))
+	}
+	return w.Flush()
+}
+
+func (c *cli) purgeComments(ctx context.Context, id string) error {
+	removed, err := c.storage.DeleteCommentThread(ctx, id)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("comment %s not found", id)
+	}
+	return c.printResult(map[string]any{"deleted": id, "comments": removed}, "deleted %d comments", removed)
+}
+
+func (c *cli) listUsers(ctx context.Context) error {
+	users, err := c.storage.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(users)
+	}
+
+	w := c.table("USERNAME", "REGISTERED")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\n", user.Username, user.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// userDetails is the output of `users show`.
+type userDetails struct {
+	*domain.User
+	Posts []*domain.Post `json:"posts"`
+}
+
+func (c *cli) showUser(ctx context.Context, username string) error {
+	users, err := c.storage.GetUsers(ctx, []string{username})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("user %s not found", username)
+	}
+
+	posts, err := c.storage.GetAllPosts(ctx)
+	if err != nil {
+		return err
+	}
+	details := userDetails{User: users[0], Posts: []*domain.Post{}}
+	for _, post := range posts {
+		if post.Author == username {
+			details.Posts = append(details.Posts, post)
+		}
+	}
+	if c.json {
+		return c.printJSON(details)
+	}
+
+	fmt.Fprintf(c.out, "Username:   %s\nRegistered: %s\nPosts:      %d\n\n",
+		details.Username, details.CreatedAt.Format(time.RFC3339), len(details.Posts))
+	return c.printPosts(details.Posts)
+}
+
+func (c *cli) exportData(ctx context.Context, args []string) error {
+	path, err := parseFileFlag("data export", args)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		// Архив пишется в stdout, поэтому статистика не выводится
+		_, err := archive.Export(ctx, c.storage, c.out)
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	stats, err := archive.Export(ctx, c.storage, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return c.printStats("exported", stats)
+}
+
+func (c *cli) importData(ctx context.Context, args []string) error {
+	path, err := parseFileFlag("data import", args)
+	if err != nil {
+		return err
+	}
+	in := c.in
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	stats, err := archive.Import(ctx, c.storage, in)
+	if err != nil {
+		return err
+	}
+	return c.printStats("imported", stats)
+}
+
+func parseFileFlag(name string, args []string) (string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	path := flags.String("f", "", "Archive file")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return "", errUsage
+	}
+	return *path, nil
+}
+
+// copyData copies all data to the storage given with -to and verifies the
+// result. With verifyOnly nothing is copied.
+func (c *cli) copyData(ctx context.Context, args []string, verifyOnly bool) error {
+	name := "data copy"
+	if verifyOnly {
+		name = "data verify"
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	target := *c.cfg
+	flags.StringVar(&target.StorageType, "to", "", "Destination storage type: memory, postgres or sqlite")
+	flags.StringVar(&target.PostgresDSN, "to-postgres-dsn", "", "Destination PostgreSQL data source name")
+	flags.StringVar(&target.SQLitePath, "to-sqlite-path", "", "Destination SQLite database file")
+	flags.StringVar(&target.DataDir, "to-data-dir", "", "Destination directory of the memory storage")
+	migrate := flags.Bool("migrate", false, "Apply migrations to the destination before copying")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return errUsage
+	}
+
+	switch target.StorageType {
+	case "postgres":
+		if target.PostgresDSN == "" || target.PostgresDSN == c.cfg.PostgresDSN && c.cfg.StorageType == "postgres" {
+			return errors.New("-to-postgres-dsn must name a database other than the source")
+		}
+	case "sqlite":
+		if target.SQLitePath == "" || target.SQLitePath == c.cfg.SQLitePath && c.cfg.StorageType == "sqlite" {
+			return errors.New("-to-sqlite-path must name a file other than the source")
+		}
+	case "memory":
+		if target.DataDir == "" || target.DataDir == c.cfg.DataDir && c.cfg.StorageType == "memory" {
+			return errors.New("-to-data-dir must name a directory other than the source")
+		}
+	default:
+		return errUsage
+	}
+
+	dst, err := c.open(&target, *migrate && !verifyOnly)
+	if err != nil {
+		return err
+	}
+	if closer, ok := dst.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if !verifyOnly {
+		// Уже перенесённые записи пропускаются, поэтому прерванное
+		// копирование продолжается повторным запуском
+		if _, err := archive.Copy(ctx, c.storage, dst); err != nil {
+			return err
+		}
+	}
+	sum, err := archive.Verify(ctx, c.storage, dst)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(sum)
+	}
+	_, err = fmt.Fprintf(c.out, "verified %s\nusers         %s\nposts         %s\ncomments      %s\nnotifications %s\nwebhooks      %s\ndeliveries    %s\nevents        %s\nqueued        %s\n",
+		sum.Stats, sum.UsersSHA256, sum.PostsSHA256, sum.CommentsSHA256,
+		sum.NotificationsSHA256, sum.WebhooksSHA256, sum.DeliveriesSHA256, sum.EventsSHA256, sum.QueuedSHA256)
+	return err
+}
+
+func (c *cli) printStats(action string, stats archive.Stats) error {
+	return c.printResult(stats, "%s %d users, %d posts, %d comments",
+		action, stats.Users, stats.Posts, stats.Comments)
+}
+
+func (c *cli) printPosts(posts []*domain.Post) error {
+	if posts == nil {
+		posts = []*domain.Post{}
+	}
+	if c.json {
+		return c.printJSON(posts)
+	}
+
+	w := c.table("ID", "AUTHOR", "TITLE", "FORMAT", "COMMENTS", "CREATED")
+	for _, post := range posts {
+		comments := "open"
+		if !post.CommentsEnabled {
+			comments = "locked"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", post.ID, orDash(post.Author), truncate(post.Title, 40),
+			post.ContentFormat, comments, post.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// printResult prints value as JSON or the formatted message as text.
+func (c *cli) printResult(value any, format string, args ...any) error {
+	if c.json {
+		return c.printJSON(value)
+	}
+	_, err := fmt.Fprintf(c.out, format+"\n", args...)
+	return err
+}
+
+func (c *cli) printJSON(value any) error {
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func (c *cli) table(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	return w
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func truncate(value string, max int) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	if runes := []rune(value); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return value
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"ArticleForum/internal/config"
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLI(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+	var out bytes.Buffer
+	run := func(asJSON bool, args ...string) string {
+		t.Helper()
+		out.Reset()
+		c := &cli{storage: store, out: &out, json: asJSON}
+		require.NoError(t, c.run(ctx, args))
+		return out.String()
+	}
+
+	var created []*domain.Post
+	require.NoError(t, json.Unmarshal([]byte(run(true, "posts", "create", "-title", "Hello", "-author", "alice", "-markdown")), &created))
+	require.Len(t, created, 1)
+	post := created[0]
+	assert.Equal(t, domain.ContentFormatMarkdown, post.ContentFormat)
+	assert.True(t, post.CommentsEnabled)
+
+	table := run(false, "posts", "list")
+	assert.Contains(t, table, "TITLE")
+	assert.Contains(t, table, "Hello")
+	assert.Contains(t, table, "open")
+
+	assert.Contains(t, run(false, "posts", "lock", post.ID), "locked")
+	rejected, err := store.CreateComment(ctx, post.ID, nil, "bob", "Locked")
+	require.NoError(t, err)
+	assert.Nil(t, rejected)
+	run(false, "posts", "unlock", post.ID)
+
+	root, err := store.CreateComment(ctx, post.ID, nil, "bob", "Root")
+	require.NoError(t, err)
+	_, err = store.CreateComment(ctx, post.ID, &root.ID, "alice", "Reply")
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(run(false, "comments", "list", post.ID), "\n"), "header and two comments")
+	assert.Equal(t, "deleted 2 comments\n", run(false, "comments", "purge", root.ID))
+
+	var user struct {
+		Username string         `json:"username"`
+		Posts    []*domain.Post `json:"posts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(run(true, "users", "show", "alice")), &user))
+	assert.Equal(t, "alice", user.Username)
+	assert.Len(t, user.Posts, 1)
+	assert.Contains(t, run(false, "users", "list"), "alice")
+
+	run(false, "posts", "delete", post.ID)
+	assert.Equal(t, "[]\n", run(true, "posts", "list"))
+
+	c := &cli{storage: store, out: &out}
+	assert.ErrorIs(t, c.run(ctx, []string{"posts"}), errUsage)
+	assert.ErrorIs(t, c.run(ctx, []string{"posts", "create"}), errUsage)
+	assert.ErrorIs(t, c.run(ctx, []string{"comments", "list", post.ID, "-limit", "-1"}), errUsage)
+	assert.ErrorIs(t, c.run(ctx, []string{"comments", "list", post.ID, "-offset", "-1"}), errUsage)
+	assert.Error(t, c.run(ctx, []string{"posts", "delete", post.ID}))
+}
+
+func TestCLIExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+	post, err := source.CreatePost(ctx, "", "Hello", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = source.CreateComment(ctx, post.ID, nil, "", "First")
+	require.NoError(t, err)
+
+	var exported bytes.Buffer
+	require.NoError(t, (&cli{storage: source, out: &exported}).run(ctx, []string{"data", "export"}))
+
+	target := memory.NewMemoryStorage()
+	var out bytes.Buffer
+	c := &cli{storage: target, in: &exported, out: &out}
+	require.NoError(t, c.run(ctx, []string{"data", "import"}))
+	assert.Equal(t, "imported 0 users, 1 posts, 1 comments\n", out.String())
+
+	comments, err := target.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+
+	path := t.TempDir() + "/forum.jsonl"
+	out.Reset()
+	require.NoError(t, (&cli{storage: target, out: &out, json: true}).run(ctx, []string{"data", "export", "-f", path}))
+	assert.Contains(t, out.String(), `"comments": 1`)
+}
+
+func TestCLICopy(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+	post, err := source.CreatePost(ctx, "", "Hello", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = source.CreateComment(ctx, post.ID, nil, "", "First")
+	require.NoError(t, err)
+
+	target := memory.NewMemoryStorage()
+	var opened *config.Config
+	var out bytes.Buffer
+	c := &cli{
+		storage: source,
+		out:     &out,
+		cfg:     &config.Config{StorageType: "memory", DataDir: "data"},
+		open: func(cfg *config.Config, migrate bool) (storage.Storage, error) {
+			opened = cfg
+			return target, nil
+		},
+	}
+
+	assert.ErrorIs(t, c.run(ctx, []string{"data", "copy"}), errUsage)
+	assert.Error(t, c.run(ctx, []string{"data", "copy", "-to", "memory", "-to-data-dir", "data"}))
+	assert.Error(t, c.run(ctx, []string{"data", "verify", "-to", "sqlite", "-to-sqlite-path", "copy.db"}))
+
+	require.NoError(t, c.run(ctx, []string{"data", "copy", "-to", "sqlite", "-to-sqlite-path", "copy.db"}))
+	assert.Equal(t, "sqlite", opened.StorageType)
+	assert.Equal(t, "copy.db", opened.SQLitePath)
+	assert.Contains(t, out.String(), "verified 0 users, 1 posts, 1 comments, 0 notifications, 0 webhooks, 0 deliveries, 2 pending events, 0 queued deliveries")
+
+	comments, err := target.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+}
@@ -0,0 +1,115 @@
+// Command forumctl performs administrative tasks directly against the forum
+// storage: listing, creating, locking and deleting posts, purging comment
+// threads, inspecting users and exporting or importing all forum data.
+//
+//	forumctl [-o table|json] [storage flags] <command> [arguments]
+//
+// Storage flags and environment variables are the same as for the server.
+package main
+
+import (
+	"ArticleForum/internal/config"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"ArticleForum/internal/storage/postgres"
+	"ArticleForum/internal/storage/sqlite"
+	"ArticleForum/pkg/migrations"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: forumctl [-o table|json] [storage flags] <command> [arguments]
+
+Commands:
+  posts list
+  posts show <id>
+  posts create -title <title> [-content <text>] [-author <name>] [-markdown] [-locked]
+  posts lock <id>
+  posts unlock <id>
+  posts delete <id>
+  comments list <post id> [-limit n] [-offset n]
+  comments purge <id>       delete a comment with all replies to it
+  users list
+  users show <username>
+  data export [-f file]     write all data as a JSON Lines archive (stdout by default)
+  data import [-f file]     load an archive written by data export (stdin by default)
+  data copy -to memory|postgres|sqlite [-to-postgres-dsn dsn] [-to-sqlite-path file] [-to-data-dir dir] [-migrate]
+                            copy all data to another storage and verify counts and checksums;
+                            run again to resume an interrupted copy
+  data verify -to ...       only compare counts and checksums with another storage
+
+Flags:
+`
+
+func main() {
+	output := flag.String("o", "table", "Output format: table or json")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	godotenv.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+
+	if *output != "table" && *output != "json" {
+		fail(fmt.Errorf("unknown output format %q", *output))
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := openStorage(cfg, false)
+	if err != nil {
+		fail(err)
+	}
+	c := &cli{storage: store, in: os.Stdin, out: os.Stdout, json: *output == "json", cfg: cfg, open: openStorage}
+	err = c.run(context.Background(), flag.Args())
+	if closer, ok := store.(io.Closer); ok {
+		closer.Close()
+	}
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// openStorage opens the storage described by cfg. Unlike the server it
+// applies migrations only when asked to.
+func openStorage(cfg *config.Config, migrate bool) (storage.Storage, error) {
+	switch cfg.StorageType {
+	case "postgres":
+		if migrate {
+			if err := migrations.RunMigrations(cfg.PostgresDSN); err != nil {
+				return nil, err
+			}
+		}
+		return postgres.NewPostgresStorage(cfg.PostgresDSN)
+	case "sqlite":
+		return sqlite.NewSQLiteStorage(cfg.SQLitePath, migrate)
+	default:
+		// Журнал в каталоге данных пишет только один процесс, поэтому
+		// сервер должен быть остановлен
+		if cfg.DataDir == "" {
+			return nil, errors.New("in-memory storage without -data-dir holds no data; use -data-dir, -storage postgres or -storage sqlite")
+		}
+		return memory.Open(cfg.DataDir, memory.Options{SnapshotInterval: cfg.SnapshotInterval})
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "forumctl:", err)
+	os.Exit(1)
+}
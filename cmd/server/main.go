@@ -1,21 +1,40 @@
 package main
 
 import (
+	"ArticleForum/internal/auth"
 	"ArticleForum/internal/config"
+	"ArticleForum/internal/cors"
 	"ArticleForum/internal/graph"
+	"ArticleForum/internal/health"
+	"ArticleForum/internal/logging"
+	"ArticleForum/internal/metrics"
+	"ArticleForum/internal/outbox"
+	"ArticleForum/internal/rest"
 	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/cache"
 	"ArticleForum/internal/storage/memory"
 	"ArticleForum/internal/storage/postgres"
+	"ArticleForum/internal/storage/sqlite"
+	"ArticleForum/internal/tlsconfig"
+	"ArticleForum/internal/tracing"
+	"ArticleForum/internal/webhook"
 	"ArticleForum/pkg/migrations"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"database/sql"
-	"fmt"
+	"expvar"
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -23,91 +42,339 @@ import (
 
 func main() {
 	godotenv.Load()
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Сообщения пакета log тоже проходят через slog
+	slog.SetDefault(logger)
+
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	case "config":
+		if flag.NArg() != 2 || flag.Arg(1) != "print" {
+			log.Fatal("usage: articleforum [flags] config print")
+		}
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	appMetrics := metrics.New()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.OTLPEndpoint,
+		Insecure:    cfg.OTLPInsecure,
+		ServiceName: "articleforum",
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	checker := health.New(health.DefaultTimeout)
 
 	var store storage.Storage
-	var err error
+	// closeStore закрывает соединения с базой или пишет последний снимок
+	// хранилища в памяти
+	var closeStore func() error
+	// relayLock не даёт экземплярам с общей базой читать outbox одновременно
+	var relayLock outbox.Lock
 
 	switch cfg.StorageType {
 	case "postgres":
-		if cfg.PostgresDSN == "" {
-
-			cfg.PostgresDSN = buildPostgresDSN()
-		}
-
-		if err := waitForPostgres(cfg.PostgresDSN, 10, 2*time.Second); err != nil {
+		if err := checker.Wait(context.Background(), "PostgreSQL", pingPostgres(cfg.PostgresDSN), 10, 2*time.Second); err != nil {
 			log.Fatalf("PostgreSQL is not available: %v", err)
 		}
 
-		if err := migrations.RunMigrations(cfg.PostgresDSN); err != nil {
-			log.Fatalf("Failed to run migrations: %v", err)
+		if cfg.MigrateOnStart {
+			if err := migrations.RunMigrations(cfg.PostgresDSN); err != nil {
+				log.Fatalf("Failed to run migrations: %v", err)
+			}
 		}
 
-		store, err = postgres.NewPostgresStorage(cfg.PostgresDSN)
+		pgStore, err := postgres.Open(cfg.PostgresDSN, postgres.Options{
+			ReplicaDSNs:  cfg.PostgresReplicaDSNs,
+			StickyWindow: cfg.ReplicaStickyWindow,
+		})
 		if err != nil {
 			log.Fatalf("Failed to connect to PostgreSQL: %v", err)
 		}
-		log.Println("Using PostgreSQL storage")
+		store, closeStore, relayLock = pgStore, pgStore.Close, pgStore.LockRelay
+		log.Printf("Using PostgreSQL storage with %d read replicas", len(cfg.PostgresReplicaDSNs))
+	case "sqlite":
+		sqliteStore, err := sqlite.NewSQLiteStorage(cfg.SQLitePath, cfg.MigrateOnStart)
+		if err != nil {
+			log.Fatalf("Failed to open SQLite database: %v", err)
+		}
+		store, closeStore = sqliteStore, sqliteStore.Close
+		log.Printf("Using SQLite storage at %s", cfg.SQLitePath)
 	default:
-		store = memory.NewMemoryStorage()
-		log.Println("Using in-memory storage")
+		if cfg.DataDir == "" {
+			store = memory.NewMemoryStorage()
+			log.Println("Using in-memory storage")
+			break
+		}
+
+		durable, err := memory.Open(cfg.DataDir, memory.Options{SnapshotInterval: cfg.SnapshotInterval})
+		if err != nil {
+			log.Fatalf("Failed to open memory storage: %v", err)
+		}
+		store, closeStore = durable, durable.Close
+		log.Printf("Using in-memory storage persisted to %s", cfg.DataDir)
+	}
+
+	if pooled, ok := store.(interface{ Pools() map[string]*sql.DB }); ok {
+		if err := appMetrics.RegisterDBStats(pooled.Pools()); err != nil {
+			log.Fatalf("Failed to register database metrics: %v", err)
+		}
+	}
+	store = appMetrics.Storage(store, cfg.StorageType)
+
+	if cfg.CacheSize > 0 {
+		cached := cache.New(store, cache.Options{Size: cfg.CacheSize, TTL: cfg.CacheTTL})
+		expvar.Publish("storage_cache", expvar.Func(func() any { return cached.Stats() }))
+		if err := appMetrics.RegisterCache(cached); err != nil {
+			log.Fatalf("Failed to register cache metrics: %v", err)
+		}
+		store = cached
+		log.Printf("Caching up to %d posts and comment pages for %s", cfg.CacheSize, cfg.CacheTTL)
 	}
+	store = tracing.Storage(store, cfg.StorageType)
 
 	resolver := graph.NewResolver(store)
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
 
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	webhooks := webhook.NewDispatcher(store, webhook.DefaultOptions())
+	relay := outbox.NewRelay(store, outbox.DefaultPollInterval, resolver.HandleEvent, webhooks.Dispatch)
+	if relayLock != nil {
+		relay.SetLock(relayLock)
+	}
+	stopRelay := runBackground(relay.Run)
+	stopWebhooks := runBackground(webhooks.Run)
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", cfg.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.Port, nil))
-}
+	checker.Add("storage", store.HealthCheck)
+	checker.Add("broker", relay.HealthCheck)
 
-func buildPostgresDSN() string {
-	host := getEnv("POSTGRES_HOST", "localhost")
-	port := getEnv("POSTGRES_PORT", "5432")
-	user := getEnv("POSTGRES_USER", "postgres")
-	password := getEnv("POSTGRES_PASSWORD", "12345678")
-	dbname := getEnv("POSTGRES_DB", "articleforum")
-	sslmode := getEnv("POSTGRES_SSLMODE", "disable")
+	closing, closeSubscriptions := context.WithCancel(context.Background())
+	corsPolicy := cors.Policy{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+	srv := newGraphQLServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}), closing, corsPolicy.CheckOrigin)
+	srv.Use(appMetrics.GraphQL())
+	srv.Use(tracing.GraphQL(cfg.TraceFields))
+	srv.Use(logging.GraphQL())
 
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		user, password, host, port, dbname, sslmode)
-}
+	// Сессии нужны только для чтения с реплик, без них cookie не выдаются
+	sessions := sessionMiddleware(cfg.StorageType == "postgres" && len(cfg.PostgresReplicaDSNs) > 0)
+	api := func(handler http.Handler, authenticate func(http.Handler) http.Handler) http.Handler {
+		return logging.Middleware(logger)(tracing.Middleware(authenticate(sessions(handler))))
+	}
+	graphQL := func(authenticate func(http.Handler) http.Handler) http.Handler {
+		return api(srv, authenticate)
+	}
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	// Заголовку X-User верим только на запросах от аутентифицирующего прокси
+	proxyNetworks, err := auth.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authenticate := auth.Middleware(auth.Proxy{Networks: proxyNetworks, Secret: cfg.ProxySecret}, cfg.AdminUsers)
+	if len(proxyNetworks) == 0 && cfg.ProxySecret == "" {
+		log.Println("Neither trusted-proxies nor proxy-secret is set, the X-User header is ignored and all requests are anonymous")
 	}
-	return defaultValue
-}
 
-func waitForPostgres(dsn string, maxAttempts int, waitInterval time.Duration) error {
-	var db *sql.DB
-	var err error
+	public := http.NewServeMux()
+	public.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	public.Handle("/query", corsPolicy.Middleware(graphQL(authenticate)))
+	// Спаны GraphQL создаёт расширение gqlgen, а REST — обёртка над его маршрутами
+	public.Handle(rest.Prefix+"/", api(tracing.HTTP(rest.NewHandler(store, resolver.Forum()), "rest"), authenticate))
+	public.Handle("/healthz", health.Liveness())
+	public.Handle("/readyz", checker.Readiness())
 
-	for i := 0; i < maxAttempts; i++ {
-		db, err = sql.Open("postgres", dsn)
+	var tlsConfig *tls.Config
+	stopReloading := func() {}
+	if cfg.TLSCertFile != "" {
+		reloader, err := tlsconfig.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
 		if err != nil {
-			log.Printf("Failed to open database (attempt %d/%d): %v", i+1, maxAttempts, err)
-			time.Sleep(waitInterval)
-			continue
+			log.Fatal(err)
 		}
+		var reloadCtx context.Context
+		reloadCtx, stopReloading = context.WithCancel(context.Background())
+		go reloader.Run(reloadCtx, tlsconfig.DefaultReloadInterval)
+		tlsConfig = tlsconfig.Server(reloader)
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	servers := []*http.Server{newHTTPServer(":"+cfg.Port, public, tlsConfig)}
+	if cfg.AdminAddr != "" {
+		// Метрики доступны только на адресе администратора, а /debug/vars, где
+		// видны аргументы командной строки с секретами, — только клиентам с
+		// сертификатом администратора
+		admin := http.NewServeMux()
+		authenticateAdmin, adminTLS := authenticate, tlsConfig
+		if cfg.AdminClientCAFile != "" {
+			authenticateAdmin = auth.ClientCertMiddleware
+			if adminTLS, err = tlsconfig.RequireClientCerts(tlsConfig, cfg.AdminClientCAFile); err != nil {
+				log.Fatal(err)
+			}
+			admin.Handle("/debug/vars", expvar.Handler())
+		}
+		admin.Handle("/", playground.Handler("GraphQL playground", "/query"))
+		admin.Handle("/query", graphQL(authenticateAdmin))
+		admin.Handle("/metrics", appMetrics.Handler())
+		servers = append(servers, newHTTPServer(cfg.AdminAddr, admin, adminTLS))
+	} else if cfg.PublicMetrics {
+		public.Handle("/metrics", appMetrics.Handler())
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go serve(server, serveErr)
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("connect to %s://localhost:%s/ for GraphQL playground", scheme, cfg.Port)
+	if cfg.AdminAddr != "" {
+		log.Printf("Serving metrics and admin GraphQL on %s", cfg.AdminAddr)
+	} else if !cfg.PublicMetrics {
+		log.Println("Metrics are not served, set admin-addr or public-metrics to enable them")
+	}
 
-		if err = db.PingContext(ctx); err != nil {
-			log.Printf("Database not ready (attempt %d/%d): %v", i+1, maxAttempts, err)
-			db.Close()
-			time.Sleep(waitInterval)
-			continue
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	failed := false
+	select {
+	case err := <-serveErr:
+		log.Printf("Server failed: %v", err)
+		failed = true
+	case <-signals.Done():
+		log.Printf("Shutting down, waiting up to %s", cfg.ShutdownTimeout)
+	}
+	// Повторный сигнал завершает процесс сразу
+	stopSignals()
+
+	// Остановка идёт по порядку, и каждый шаг выполняется, даже если
+	// предыдущий не уложился в отведённое время
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Балансировщик перестаёт направлять новые запросы, а клиенты подписок
+	// получают сообщение о закрытии и переподключаются к другому экземпляру
+	checker.Shutdown()
+	closeSubscriptions()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Requests to %s did not finish in time, closing connections: %v", server.Addr, err)
+			server.Close()
+			failed = true
 		}
+	}
+	stopReloading()
 
-		db.Close()
-		log.Println("Database is ready!")
-		return nil
+	// Новых событий больше нет; relay передаёт обработчикам текущее событие,
+	// а неподтверждённые события доставит следующий запуск
+	if err := stopRelay(ctx); err != nil {
+		log.Printf("Outbox relay did not finish in time, its event stays in the outbox: %v", err)
+		failed = true
 	}
+	// Начатые попытки доставки вебхуков доводятся до конца, остальные
+	// доставки остаются в очереди
+	if err := stopWebhooks(ctx); err != nil {
+		log.Printf("Webhook deliveries did not finish in time, they will be retried: %v", err)
+		failed = true
+	}
+	resolver.Close()
 
-	return fmt.Errorf("database not available after %d attempts: %v", maxAttempts, err)
+	if closeStore != nil {
+		if err := closeStore(); err != nil {
+			log.Printf("Failed to close storage: %v", err)
+			failed = true
+		}
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	log.Println("Server stopped")
+}
+
+// sessionCookie names the cookie that identifies anonymous clients for
+// read-your-writes routing.
+const sessionCookie = "articleforum_session"
+
+// sessionMiddleware identifies the client for read-your-writes routing of
+// storage reads: by username when the caller is known, otherwise by the
+// session cookie. With issueCookies, anonymous clients without one are given
+// a cookie; until they send it back, or if they never do, they are
+// identified by address, which every client behind the same NAT or proxy
+// shares.
+func sessionMiddleware(issueCookies bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var session string
+			if user, ok := auth.UserFromContext(r.Context()); ok {
+				session = "user:" + user
+			} else if cookie, err := r.Cookie(sessionCookie); err == nil && validSessionID(cookie.Value) {
+				session = "cookie:" + cookie.Value
+			} else {
+				host, _, _ := net.SplitHostPort(r.RemoteAddr)
+				session = "addr:" + host
+				if issueCookies {
+					http.SetCookie(w, &http.Cookie{
+						Name:     sessionCookie,
+						Value:    rand.Text(),
+						Path:     "/",
+						HttpOnly: true,
+						Secure:   r.TLS != nil,
+						SameSite: http.SameSiteLaxMode,
+					})
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(storage.WithSession(r.Context(), session)))
+		})
+	}
+}
+
+// validSessionID reports whether id looks like an ID issued by
+// sessionMiddleware, so that clients cannot pick arbitrary session keys.
+func validSessionID(id string) bool {
+	// rand.Text выдаёт 26 символов алфавита base32
+	if len(id) != 26 {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// pingPostgres checks that the database accepts connections, before the
+// storage is opened and the schema version can be checked.
+func pingPostgres(dsn string) health.Check {
+	return func(ctx context.Context) error {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return db.PingContext(ctx)
+	}
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionMiddleware(t *testing.T) {
+	serve := func(issueCookies bool, req *http.Request) (string, *httptest.ResponseRecorder) {
+		var session string
+		handler := sessionMiddleware(issueCookies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, _ = storage.SessionFromContext(r.Context())
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return session, rec
+	}
+	request := func(remoteAddr string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.RemoteAddr = remoteAddr
+		return req
+	}
+
+	// Анонимный клиент без cookie получает её и до её возврата различается по адресу
+	session, rec := serve(true, request("192.0.2.1:1234"))
+	assert.Equal(t, "addr:192.0.2.1", session)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, sessionCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	// Клиенты за одним адресом с разными cookie различаются
+	first := request("192.0.2.1:1234")
+	first.AddCookie(cookies[0])
+	session, rec = serve(true, first)
+	assert.Equal(t, "cookie:"+cookies[0].Value, session)
+	assert.Empty(t, rec.Result().Cookies(), "a known client keeps its cookie")
+
+	_, rec = serve(true, request("192.0.2.1:1234"))
+	second := request("192.0.2.1:1234")
+	second.AddCookie(rec.Result().Cookies()[0])
+	other, _ := serve(true, second)
+	assert.NotEqual(t, session, other)
+
+	// Произвольное значение cookie не принимается за сессию
+	forged := request("192.0.2.1:1234")
+	forged.AddCookie(&http.Cookie{Name: sessionCookie, Value: "user:alice"})
+	session, _ = serve(true, forged)
+	assert.Equal(t, "addr:192.0.2.1", session)
+
+	// Известный пользователь различается по имени
+	known := request("192.0.2.1:1234")
+	known = known.WithContext(auth.WithUser(known.Context(), "alice"))
+	session, _ = serve(true, known)
+	assert.Equal(t, "user:alice", session)
+
+	// Без реплик cookie не выдаются
+	_, rec = serve(false, request("192.0.2.1:1234"))
+	assert.Empty(t, rec.Result().Cookies())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"ArticleForum/internal/config"
+	"ArticleForum/internal/storage/sqlite"
+	"ArticleForum/pkg/migrations"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runMigrate handles `articleforum [flags] migrate <command>` for the storage
+// selected with -storage.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: articleforum [flags] migrate %s", strings.Join(migrations.Commands, "|"))
+	}
+	ctx := context.Background()
+
+	switch cfg.StorageType {
+	case "postgres":
+		db, err := sql.Open("postgres", cfg.PostgresDSN)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return migrations.Command(ctx, db, migrations.Postgres, args[0], os.Stdout)
+	case "sqlite":
+		db, err := sqlite.OpenDB(cfg.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return migrations.Command(ctx, db, migrations.SQLite, args[0], os.Stdout)
+	default:
+		return fmt.Errorf("storage %q has no migrations, use -storage postgres or -storage sqlite", cfg.StorageType)
+	}
+}
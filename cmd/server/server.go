@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// closeReason is sent to websocket clients in a connection error message
+// before their connection is closed on shutdown.
+const closeReason = "server is shutting down"
+
+// newGraphQLServer configures the server like handler.NewDefaultServer, except
+// that websocket upgrades are accepted from the origins checkOrigin allows and
+// websocket connections are closed with closeReason once closing is done.
+func newGraphQLServer(schema graphql.ExecutableSchema, closing context.Context, checkOrigin func(*http.Request) bool) *handler.Server {
+	srv := handler.New(schema)
+
+	srv.AddTransport(transport.Websocket{
+		Upgrader:              websocket.Upgrader{CheckOrigin: checkOrigin},
+		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc: func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+			// gqlgen закрывает соединение при отмене его контекста и
+			// отправляет клиенту причину из контекста
+			ctx, cancel := context.WithCancel(transport.AppendCloseReason(ctx, closeReason))
+			stop := context.AfterFunc(closing, cancel)
+			context.AfterFunc(ctx, func() { stop() })
+			return ctx, nil, nil
+		},
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New[string](100),
+	})
+	return srv
+}
+
+// runBackground calls run in the background, like relay.Run or the webhook
+// dispatcher's Run, and returns a function that cancels its context and waits
+// for it to return or ctx to be done.
+func runBackground(run func(ctx context.Context)) (stop func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return func(wait context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-wait.Done():
+			return wait.Err()
+		}
+	}
+}
+
+// newHTTPServer returns a server for addr speaking HTTP/1.1 and HTTP/2: over
+// TLS when tlsConfig is set, otherwise in cleartext, where HTTP/2 is used by
+// clients and proxies that know the server supports it.
+func newHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if tlsConfig != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		Protocols:         protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serve runs server until it is shut down and reports why it stopped
+// otherwise.
+func serve(server *http.Server, errs chan<- error) {
+	var err error
+	if server.TLSConfig != nil {
+		// Сертификат выдаёт TLSConfig.GetCertificate
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		errs <- fmt.Errorf("%s: %v", server.Addr, err)
+	}
+}
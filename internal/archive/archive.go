@@ -0,0 +1,412 @@
+// Package archive exports forum data to a portable JSON Lines archive,
+// imports it into any storage.Storage backend and copies data directly
+// between backends.
+//
+// An archive holds users, posts and comments. Copy also transfers the data
+// of a running installation: notifications with their read state, webhooks
+// with their secrets, the delivery log and the events not yet dispatched.
+//
+// Every line is a JSON object with a "type" field. The first line is the
+// header with the format version, followed by users, posts and comments, and
+// the last line is the footer with the number of entities written:
+//
+//	{"type":"header","version":1,"createdAt":"..."}
+//	{"type":"user","user":{...}}
+//	{"type":"post","post":{...}}
+//	{"type":"comment","comment":{...}}
+//	{"type":"footer","stats":{"users":1,"posts":1,"comments":1}}
+//
+// Entities keep their IDs, parent links and timestamps. Parents always
+// precede their replies, so an archive can be imported in a single pass.
+package archive
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Version is the archive format version written by Export. Import accepts
+// archives up to this version.
+const Version = 1
+
+const pageSize = 500
+
+// maxPendingEvents bounds the outbox Copy transfers; GetPendingEvents cannot
+// page through a larger one. maxQueuedDeliveries does the same for the
+// webhook delivery queue.
+const (
+	maxPendingEvents    = 100000
+	maxQueuedDeliveries = 100000
+)
+
+// ErrTruncated is returned by Import when the archive has no footer or the
+// footer does not match the entities read.
+var ErrTruncated = errors.New("archive is truncated")
+
+type recordType string
+
+const (
+	typeHeader  recordType = "header"
+	typeUser    recordType = "user"
+	typePost    recordType = "post"
+	typeComment recordType = "comment"
+	typeFooter  recordType = "footer"
+
+	// Только для Copy, в архив не записываются
+	typeNotification recordType = "notification"
+	typeWebhook      recordType = "webhook"
+	typeDelivery     recordType = "delivery"
+	typeEvent        recordType = "event"
+	typeQueued       recordType = "queued"
+)
+
+type record struct {
+	Type      recordType      `json:"type"`
+	Version   int             `json:"version,omitempty"`
+	CreatedAt *time.Time      `json:"createdAt,omitempty"`
+	User      *domain.User    `json:"user,omitempty"`
+	Post      *domain.Post    `json:"post,omitempty"`
+	Comment   *domain.Comment `json:"comment,omitempty"`
+	Stats     *Stats          `json:"stats,omitempty"`
+
+	Notification *domain.Notification    `json:"-"`
+	Webhook      *domain.Webhook         `json:"-"`
+	Delivery     *domain.WebhookDelivery `json:"-"`
+	Event        *domain.Event           `json:"-"`
+	Queued       *domain.QueuedDelivery  `json:"-"`
+}
+
+// Stats counts the entities in an archive, or copied between storages.
+type Stats struct {
+	Users    int `json:"users"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+
+	Notifications int `json:"notifications,omitempty"`
+	Webhooks      int `json:"webhooks,omitempty"`
+	Deliveries    int `json:"deliveries,omitempty"`
+	Events        int `json:"events,omitempty"`
+	Queued        int `json:"queued,omitempty"`
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d users, %d posts, %d comments, %d notifications, %d webhooks, %d deliveries, %d pending events, %d queued deliveries",
+		s.Users, s.Posts, s.Comments, s.Notifications, s.Webhooks, s.Deliveries, s.Events, s.Queued)
+}
+
+// Export writes all users, posts and comments of s to w.
+func Export(ctx context.Context, s storage.Storage, w io.Writer) (Stats, error) {
+	var stats Stats
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	now := time.Now().UTC()
+	if err := encoder.Encode(record{Type: typeHeader, Version: Version, CreatedAt: &now}); err != nil {
+		return stats, err
+	}
+
+	err := walk(ctx, s, func(rec record) error {
+		stats.add(rec)
+		return encoder.Encode(rec)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := encoder.Encode(record{Type: typeFooter, Stats: &stats}); err != nil {
+		return stats, err
+	}
+	return stats, buffered.Flush()
+}
+
+// Import reads an archive written by Export into s. Entities that already
+// exist in s are left unchanged, so an interrupted import can be repeated.
+// Import does not publish events for the imported data.
+func Import(ctx context.Context, s storage.Storage, r io.Reader) (Stats, error) {
+	var stats Stats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	line := 0
+	headerSeen := false
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return stats, fmt.Errorf("line %d: %v", line, err)
+		}
+		if !headerSeen && rec.Type != typeHeader {
+			return stats, fmt.Errorf("line %d: archive must start with a header", line)
+		}
+
+		var err error
+		switch rec.Type {
+		case typeHeader:
+			if headerSeen {
+				return stats, fmt.Errorf("line %d: duplicate header", line)
+			}
+			if rec.Version < 1 || rec.Version > Version {
+				return stats, fmt.Errorf("unsupported archive version %d, expected at most %d", rec.Version, Version)
+			}
+			headerSeen = true
+		case typeUser, typePost, typeComment:
+			if err = restore(ctx, s, rec); err == nil {
+				stats.add(rec)
+			}
+		case typeFooter:
+			if rec.Stats == nil || *rec.Stats != stats {
+				return stats, fmt.Errorf("%w: footer does not match the %d users, %d posts and %d comments read",
+					ErrTruncated, stats.Users, stats.Posts, stats.Comments)
+			}
+			return stats, nil
+		default:
+			// Записи новых типов из будущих версий пропускаются
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+	return stats, ErrTruncated
+}
+
+func (s *Stats) add(rec record) {
+	switch rec.Type {
+	case typeUser:
+		s.Users++
+	case typePost:
+		s.Posts++
+	case typeComment:
+		s.Comments++
+	case typeNotification:
+		s.Notifications++
+	case typeWebhook:
+		s.Webhooks++
+	case typeDelivery:
+		s.Deliveries++
+	case typeEvent:
+		s.Events++
+	case typeQueued:
+		s.Queued++
+	}
+}
+
+// walk passes every user, post and comment of s to fn in archive order:
+// users first, then each post followed by its comments, parents before
+// replies.
+func walk(ctx context.Context, s storage.Storage, fn func(rec record) error) error {
+	users, err := s.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := fn(record{Type: typeUser, User: user}); err != nil {
+			return err
+		}
+	}
+
+	posts, err := s.GetAllPosts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := fn(record{Type: typePost, Post: post}); err != nil {
+			return err
+		}
+
+		comments, err := allComments(ctx, s, post.ID)
+		if err != nil {
+			return err
+		}
+		for _, comment := range parentsFirst(comments) {
+			if err := fn(record{Type: typeComment, Comment: comment}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkAll passes everything walk does and then the data only Copy
+// transfers: the notifications of every user and author, the webhooks each
+// followed by its delivery log, the pending events in outbox order and the
+// queued webhook deliveries in queue order.
+func walkAll(ctx context.Context, s storage.Storage, fn func(rec record) error) error {
+	recipients := map[string]bool{}
+	var names []string
+	addRecipient := func(name string) {
+		if name != "" && !recipients[name] {
+			recipients[name] = true
+			names = append(names, name)
+		}
+	}
+	err := walk(ctx, s, func(rec record) error {
+		switch {
+		case rec.User != nil:
+			addRecipient(rec.User.Username)
+		case rec.Post != nil:
+			addRecipient(rec.Post.Author)
+		case rec.Comment != nil:
+			addRecipient(rec.Comment.Author)
+		}
+		return fn(rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		after := ""
+		for {
+			page, err := s.GetNotifications(ctx, name, false, pageSize, after)
+			if err != nil {
+				return err
+			}
+			for _, notification := range page {
+				if err := fn(record{Type: typeNotification, Notification: notification}); err != nil {
+					return err
+				}
+			}
+			if len(page) < pageSize {
+				break
+			}
+			after = page[len(page)-1].ID
+		}
+	}
+
+	webhooks, err := s.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		if err := fn(record{Type: typeWebhook, Webhook: webhook}); err != nil {
+			return err
+		}
+		for offset := 0; ; offset += pageSize {
+			page, err := s.GetWebhookDeliveries(ctx, webhook.ID, pageSize, offset)
+			if err != nil {
+				return err
+			}
+			for _, delivery := range page {
+				if err := fn(record{Type: typeDelivery, Delivery: delivery}); err != nil {
+					return err
+				}
+			}
+			if len(page) < pageSize {
+				break
+			}
+		}
+	}
+
+	events, err := s.GetPendingEvents(ctx, maxPendingEvents)
+	if err != nil {
+		return err
+	}
+	if len(events) == maxPendingEvents {
+		return fmt.Errorf("outbox holds %d or more pending events; let the server dispatch them before copying", maxPendingEvents)
+	}
+	for _, event := range events {
+		if err := fn(record{Type: typeEvent, Event: event}); err != nil {
+			return err
+		}
+	}
+
+	queued, err := s.GetQueuedDeliveries(ctx, maxQueuedDeliveries)
+	if err != nil {
+		return err
+	}
+	if len(queued) == maxQueuedDeliveries {
+		return fmt.Errorf("webhook queue holds %d or more deliveries; let the server deliver them before copying", maxQueuedDeliveries)
+	}
+	for _, delivery := range queued {
+		if err := fn(record{Type: typeQueued, Queued: delivery}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore stores the entity of rec in s unless it already exists there.
+func restore(ctx context.Context, s storage.Storage, rec record) error {
+	switch {
+	case rec.Type == typeUser && rec.User != nil:
+		return s.RestoreUser(ctx, rec.User)
+	case rec.Type == typePost && rec.Post != nil:
+		return s.RestorePost(ctx, rec.Post)
+	case rec.Type == typeComment && rec.Comment != nil:
+		if rec.Comment.Mentions == nil {
+			rec.Comment.Mentions = []string{}
+		}
+		return s.RestoreComment(ctx, rec.Comment)
+	case rec.Type == typeNotification && rec.Notification != nil:
+		return s.RestoreNotification(ctx, rec.Notification)
+	case rec.Type == typeWebhook && rec.Webhook != nil:
+		return s.RestoreWebhook(ctx, rec.Webhook)
+	case rec.Type == typeDelivery && rec.Delivery != nil:
+		return s.RestoreWebhookDelivery(ctx, rec.Delivery)
+	case rec.Type == typeEvent && rec.Event != nil:
+		return s.RestoreEvent(ctx, rec.Event)
+	case rec.Type == typeQueued && rec.Queued != nil:
+		return s.RestoreQueuedDelivery(ctx, rec.Queued)
+	default:
+		return errors.New("record has no data")
+	}
+}
+
+func allComments(ctx context.Context, s storage.Storage, postID string) ([]*domain.Comment, error) {
+	var comments []*domain.Comment
+	for offset := 0; ; offset += pageSize {
+		page, err := s.GetComments(ctx, postID, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if len(page) < pageSize {
+			return comments, nil
+		}
+	}
+}
+
+// parentsFirst orders comments so that every parent precedes its replies,
+// keeping the original order otherwise.
+func parentsFirst(comments []*domain.Comment) []*domain.Comment {
+	ordered := make([]*domain.Comment, 0, len(comments))
+	emitted := make(map[string]bool, len(comments))
+	for len(ordered) < len(comments) {
+		progress := false
+		for _, comment := range comments {
+			if emitted[comment.ID] {
+				continue
+			}
+			if comment.ParentID == nil || emitted[*comment.ParentID] {
+				ordered = append(ordered, comment)
+				emitted[comment.ID] = true
+				progress = true
+			}
+		}
+		if !progress {
+			// Родитель отсутствует в хранилище, сохраняем такие комментарии как есть
+			for _, comment := range comments {
+				if !emitted[comment.ID] {
+					ordered = append(ordered, comment)
+					emitted[comment.ID] = true
+				}
+			}
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage/memory"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+
+	_, err := source.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	post, err := source.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatMarkdown, true)
+	require.NoError(t, err)
+	root, err := source.CreateComment(ctx, post.ID, nil, "bob", "Hi @alice")
+	require.NoError(t, err)
+	_, err = source.SetMentions(ctx, root.ID, []string{"alice"})
+	require.NoError(t, err)
+	reply, err := source.CreateComment(ctx, post.ID, &root.ID, "alice", "Hello")
+	require.NoError(t, err)
+	_, err = source.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	stats, err := Export(ctx, source, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Users: 1, Posts: 1, Comments: 2}, stats)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.Contains(t, lines[0], `"type":"header","version":1`)
+	assert.Contains(t, lines[5], `"type":"footer"`)
+
+	target := memory.NewMemoryStorage()
+	imported, err := Import(ctx, target, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, stats, imported)
+
+	restored, err := target.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.False(t, restored.CommentsEnabled)
+	assert.True(t, restored.CreatedAt.Equal(post.CreatedAt))
+
+	restoredReply, err := target.GetComment(ctx, reply.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restoredReply)
+	assert.Equal(t, root.ID, *restoredReply.ParentID)
+
+	restoredRoot, err := target.GetComment(ctx, root.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, restoredRoot.Mentions)
+
+	// Повторный импорт ничего не дублирует
+	_, err = Import(ctx, target, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	comments, err := target.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 2)
+}
+
+func TestImportRejectsBrokenArchives(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	source := memory.NewMemoryStorage()
+	_, err := source.CreatePost(ctx, "", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = Export(ctx, source, &buf)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	_, err = Import(ctx, memory.NewMemoryStorage(), strings.NewReader(strings.Join(lines[:2], "")))
+	assert.ErrorIs(t, err, ErrTruncated)
+
+	_, err = Import(ctx, memory.NewMemoryStorage(), strings.NewReader(lines[1]))
+	assert.ErrorContains(t, err, "header")
+
+	_, err = Import(ctx, memory.NewMemoryStorage(), strings.NewReader(`{"type":"header","version":99}`+"\n"))
+	assert.ErrorContains(t, err, "unsupported archive version")
+}
+
+func TestParentsFirst(t *testing.T) {
+	parent := "a"
+	child := "b"
+	comments := []*domain.Comment{
+		{ID: "c", ParentID: &child},
+		{ID: "b", ParentID: &parent},
+		{ID: "a"},
+	}
+
+	var ids []string
+	for _, comment := range parentsFirst(comments) {
+		ids = append(ids, comment.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+}
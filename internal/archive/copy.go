@@ -0,0 +1,220 @@
+package archive
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrMismatch is returned by Copy and Verify when the source and the
+// destination hold different data.
+var ErrMismatch = errors.New("source and destination differ")
+
+// Checksum describes all data of a storage. Two storages holding the same
+// data have equal checksums regardless of the backend and of the order in
+// which the entities were written.
+type Checksum struct {
+	Stats
+	UsersSHA256         string `json:"usersSHA256"`
+	PostsSHA256         string `json:"postsSHA256"`
+	CommentsSHA256      string `json:"commentsSHA256"`
+	NotificationsSHA256 string `json:"notificationsSHA256"`
+	WebhooksSHA256      string `json:"webhooksSHA256"`
+	DeliveriesSHA256    string `json:"deliveriesSHA256"`
+	EventsSHA256        string `json:"eventsSHA256"`
+	QueuedSHA256        string `json:"queuedSHA256"`
+}
+
+// Copy streams all data from src to dst: users, posts and comments,
+// notifications with their read state, webhooks with their secrets and
+// delivery logs, pending events, which dst dispatches after its own, and
+// queued webhook deliveries, which dst delivers after its own.
+// It then verifies that both hold the same data. Entities that already
+// exist in dst are left unchanged, so a copy interrupted at any point is
+// resumed by running it again. The source must not change while it is being
+// copied.
+func Copy(ctx context.Context, src, dst storage.Storage) (Stats, error) {
+	var stats Stats
+	err := walkAll(ctx, src, func(rec record) error {
+		if err := restore(ctx, dst, rec); err != nil {
+			return err
+		}
+		stats.add(rec)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	_, err = Verify(ctx, src, dst)
+	return stats, err
+}
+
+// Verify compares the checksums of src and dst and returns ErrMismatch if
+// they differ.
+func Verify(ctx context.Context, src, dst storage.Storage) (Checksum, error) {
+	want, err := Sum(ctx, src)
+	if err != nil {
+		return want, err
+	}
+	got, err := Sum(ctx, dst)
+	if err != nil {
+		return want, err
+	}
+
+	if got.Stats != want.Stats {
+		return want, fmt.Errorf("%w: source has %s, destination has %s", ErrMismatch, want.Stats, got.Stats)
+	}
+	if got != want {
+		return want, fmt.Errorf("%w: checksums do not match", ErrMismatch)
+	}
+	return want, nil
+}
+
+// Sum computes the checksum of all data of s.
+func Sum(ctx context.Context, s storage.Storage) (Checksum, error) {
+	var (
+		stats                                       Stats
+		users, posts, comments                      [sha256.Size]byte
+		notifications, webhooks, deliveries, outbox [sha256.Size]byte
+		queue                                       [sha256.Size]byte
+	)
+	err := walkAll(ctx, s, func(rec record) error {
+		digest, err := entityDigest(rec)
+		if err != nil {
+			return err
+		}
+		// XOR не зависит от порядка, в котором хранилище возвращает записи
+		switch rec.Type {
+		case typeUser:
+			xor(&users, digest)
+		case typePost:
+			xor(&posts, digest)
+		case typeComment:
+			xor(&comments, digest)
+		case typeNotification:
+			xor(&notifications, digest)
+		case typeWebhook:
+			xor(&webhooks, digest)
+		case typeDelivery:
+			xor(&deliveries, digest)
+		case typeEvent:
+			xor(&outbox, digest)
+		case typeQueued:
+			xor(&queue, digest)
+		}
+		stats.add(rec)
+		return nil
+	})
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	return Checksum{
+		Stats:               stats,
+		UsersSHA256:         hex.EncodeToString(users[:]),
+		PostsSHA256:         hex.EncodeToString(posts[:]),
+		CommentsSHA256:      hex.EncodeToString(comments[:]),
+		NotificationsSHA256: hex.EncodeToString(notifications[:]),
+		WebhooksSHA256:      hex.EncodeToString(webhooks[:]),
+		DeliveriesSHA256:    hex.EncodeToString(deliveries[:]),
+		EventsSHA256:        hex.EncodeToString(outbox[:]),
+		QueuedSHA256:        hex.EncodeToString(queue[:]),
+	}, nil
+}
+
+// entityDigest hashes the entity of rec in a form that does not depend on
+// the backend: timestamps are compared in UTC with the microsecond precision
+// of Postgres, durations with the millisecond precision of the delivery log,
+// mentions are sorted and event data is compared as JSON values.
+func entityDigest(rec record) ([sha256.Size]byte, error) {
+	normalize := func(t time.Time) time.Time {
+		return t.UTC().Truncate(time.Microsecond)
+	}
+
+	var value any
+	switch {
+	case rec.User != nil:
+		user := *rec.User
+		user.CreatedAt = normalize(user.CreatedAt)
+		value = user
+	case rec.Post != nil:
+		post := *rec.Post
+		post.CreatedAt = normalize(post.CreatedAt)
+		value = post
+	case rec.Comment != nil:
+		comment := *rec.Comment
+		comment.CreatedAt = normalize(comment.CreatedAt)
+		comment.Mentions = append([]string{}, comment.Mentions...)
+		sort.Strings(comment.Mentions)
+		value = comment
+	case rec.Notification != nil:
+		notification := *rec.Notification
+		notification.CreatedAt = normalize(notification.CreatedAt)
+		value = notification
+	case rec.Webhook != nil:
+		webhook := *rec.Webhook
+		webhook.CreatedAt = normalize(webhook.CreatedAt)
+		if len(webhook.EventTypes) == 0 {
+			webhook.EventTypes = nil
+		}
+		value = webhook
+	case rec.Delivery != nil:
+		delivery := *rec.Delivery
+		delivery.CreatedAt = normalize(delivery.CreatedAt)
+		delivery.Duration = delivery.Duration.Truncate(time.Millisecond)
+		value = delivery
+	case rec.Event != nil:
+		event, err := normalizeEvent(*rec.Event)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		value = event
+	case rec.Queued != nil:
+		queued := *rec.Queued
+		queued.NextAttemptAt = normalize(queued.NextAttemptAt)
+		queued.CreatedAt = normalize(queued.CreatedAt)
+		event, err := normalizeEvent(queued.Event)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		queued.Event = event
+		value = queued
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+func normalizeEvent(event domain.Event) (domain.Event, error) {
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	// JSONB в Postgres переупорядочивает ключи и убирает пробелы
+	var data any
+	decoder := json.NewDecoder(bytes.NewReader(event.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return event, fmt.Errorf("event %s: %v", event.ID, err)
+	}
+	canonical, err := json.Marshal(data)
+	if err != nil {
+		return event, err
+	}
+	event.Data = canonical
+	return event, nil
+}
+
+func xor(sum *[sha256.Size]byte, digest [sha256.Size]byte) {
+	for i := range sum {
+		sum[i] ^= digest[i]
+	}
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"ArticleForum/internal/storage/sqlite"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStorage fails after a number of restored comments to simulate an
+// interrupted copy.
+type failingStorage struct {
+	storage.Storage
+	remaining int
+}
+
+func (s *failingStorage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	if s.remaining == 0 {
+		return errors.New("connection lost")
+	}
+	s.remaining--
+	return s.Storage.RestoreComment(ctx, comment)
+}
+
+func seed(t *testing.T, s storage.Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		post, err := s.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+		root, err := s.CreateComment(ctx, post.ID, nil, "bob", "Hi @alice")
+		require.NoError(t, err)
+		_, err = s.SetMentions(ctx, root.ID, []string{"alice"})
+		require.NoError(t, err)
+		_, err = s.CreateComment(ctx, post.ID, &root.ID, "alice", "Hello")
+		require.NoError(t, err)
+		_, err = s.CreateNotification(ctx, &domain.Notification{
+			Recipient: "alice", Type: domain.NotificationTypeMention, PostID: post.ID, CommentID: root.ID, Actor: "bob",
+		})
+		require.NoError(t, err)
+	}
+	_, err = s.MarkNotificationsRead(ctx, "alice", nil)
+	require.NoError(t, err)
+
+	webhook, err := s.CreateWebhook(ctx, "https://example.com/hook", "s3cret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+	_, err = s.CreateWebhookDelivery(ctx, &domain.WebhookDelivery{
+		WebhookID: webhook.ID, EventID: "event", EventType: domain.EventPostCreated,
+		Attempt: 1, StatusCode: 200, Success: true, Duration: 1500 * time.Microsecond,
+	})
+	require.NoError(t, err)
+	events, err := s.GetPendingEvents(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, s.EnqueueDeliveries(ctx, events[0], []string{webhook.ID}))
+}
+
+func TestCopyBetweenBackends(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+	seed(t, source)
+
+	target, err := sqlite.NewSQLiteStorage(filepath.Join(t.TempDir(), "forum.db"), true)
+	require.NoError(t, err)
+	defer target.Close()
+
+	stats, err := Copy(ctx, source, target)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Users: 1, Posts: 3, Comments: 6, Notifications: 3, Webhooks: 1, Deliveries: 1, Events: 9, Queued: 1}, stats)
+
+	want, err := Sum(ctx, source)
+	require.NoError(t, err)
+	got, err := Sum(ctx, target)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	notifications, err := target.GetNotifications(ctx, "alice", true, 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "the read state is kept")
+	webhooks, err := target.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "s3cret", webhooks[0].Secret)
+	webhook := webhooks[0]
+
+	// Неотправленные события доставляются из нового хранилища в прежнем порядке
+	sourceEvents, err := source.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	targetEvents, err := target.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, targetEvents, len(sourceEvents))
+	for i := range sourceEvents {
+		assert.Equal(t, sourceEvents[i].ID, targetEvents[i].ID)
+	}
+
+	// Доставки из очереди вебхуков продолжаются с той же попытки
+	queued, err := target.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, webhook.ID, queued[0].WebhookID)
+	assert.Equal(t, sourceEvents[0].ID, queued[0].Event.ID)
+}
+
+func TestCopyResumesAfterInterruption(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+	seed(t, source)
+	target := memory.NewMemoryStorage()
+
+	_, err := Copy(ctx, source, &failingStorage{Storage: target, remaining: 3})
+	require.Error(t, err)
+	_, err = Verify(ctx, source, target)
+	assert.ErrorIs(t, err, ErrMismatch)
+
+	_, err = Copy(ctx, source, target)
+	require.NoError(t, err)
+}
+
+func TestVerifyDetectsChanges(t *testing.T) {
+	ctx := context.Background()
+	source := memory.NewMemoryStorage()
+	seed(t, source)
+	target := memory.NewMemoryStorage()
+	_, err := Copy(ctx, source, target)
+	require.NoError(t, err)
+
+	posts, err := target.GetAllPosts(ctx)
+	require.NoError(t, err)
+	comments, err := target.GetComments(ctx, posts[0].ID, 1, 0)
+	require.NoError(t, err)
+	_, err = target.UpdateComment(ctx, comments[0].ID, "Edited")
+	require.NoError(t, err)
+	// Событие правки отправлено, иначе различается и число событий
+	events, err := target.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.NoError(t, target.AckEvents(ctx, []string{events[len(events)-1].ID}))
+
+	_, err = Verify(ctx, source, target)
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.ErrorContains(t, err, "checksums")
+}
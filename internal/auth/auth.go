@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// UserHeader carries the username of the caller. It is set by the
+// authenticating reverse proxy in front of the server and is honoured only on
+// requests that came through that proxy, see Proxy.
+const UserHeader = "X-User"
+
+// ProxySecretHeader carries the secret shared with the authenticating proxy.
+const ProxySecretHeader = "X-Proxy-Secret"
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("permission denied")
+)
+
+type userKey struct{}
+type adminKey struct{}
+
+func WithUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, userKey{}, username)
+}
+
+// WithAdmin marks the caller as a forum administrator.
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// UserFromContext returns the username of the caller, if any.
+func UserFromContext(ctx context.Context) (string, bool) {
+	username, ok := ctx.Value(userKey{}).(string)
+	return username, ok && username != ""
+}
+
+// Proxy describes the authenticating reverse proxy allowed to set UserHeader.
+// A request came through the proxy if it connects from one of Networks and
+// carries Secret in ProxySecretHeader, whichever of the two are set. The zero
+// Proxy trusts no request, so clients connecting directly cannot name
+// themselves.
+type Proxy struct {
+	Networks []netip.Prefix
+	Secret   string
+}
+
+// ParseNetworks parses CIDR prefixes such as 10.0.0.0/8; a single address
+// stands for a prefix containing only itself.
+func ParseNetworks(values []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: want an address or a CIDR prefix", value)
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
+// Trusts reports whether r came through the proxy.
+func (p Proxy) Trusts(r *http.Request) bool {
+	if len(p.Networks) == 0 && p.Secret == "" {
+		return false
+	}
+	if len(p.Networks) > 0 {
+		addr, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !slices.ContainsFunc(p.Networks, func(network netip.Prefix) bool {
+			return network.Contains(addr.Addr().Unmap())
+		}) {
+			return false
+		}
+	}
+	return p.Secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(ProxySecretHeader)), []byte(p.Secret)) == 1
+}
+
+// Middleware puts the caller identified by UserHeader into the request
+// context. Callers listed in admins are marked as administrators. The header
+// is honoured only when proxy trusts the request; otherwise the request is
+// anonymous. Both headers are removed before the request is passed on.
+func Middleware(proxy Proxy, admins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username := strings.TrimSpace(r.Header.Get(UserHeader))
+			trusted := username != "" && proxy.Trusts(r)
+
+			// Заголовки не должны дойти до обработчиков и журналов запросов
+			r = r.Clone(r.Context())
+			r.Header.Del(UserHeader)
+			r.Header.Del(ProxySecretHeader)
+
+			if trusted {
+				ctx := WithUser(r.Context(), username)
+				if slices.Contains(admins, username) {
+					ctx = WithAdmin(ctx)
+				}
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientCertMiddleware identifies the caller by the common name of a verified
+// TLS client certificate and marks it as an administrator. It is meant for a
+// listener that accepts only certificates issued for administrators; the
+// UserHeader is ignored there.
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName == "" {
+			http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+		ctx := WithAdmin(WithUser(r.Context(), r.TLS.PeerCertificates[0].Subject.CommonName))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.1.2.3/8", "192.168.0.5", "::ffff:127.0.0.1", "fd00::/8"})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.0.5/32"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}, networks)
+
+	_, err = ParseNetworks([]string{"proxy.internal"})
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		proxy      Proxy
+		remoteAddr string
+		secret     string
+		user       string
+		admin      bool
+	}{
+		{name: "direct connections are not trusted by default", remoteAddr: "10.0.0.1:1234"},
+		{name: "from a proxy network", proxy: Proxy{Networks: networks}, remoteAddr: "10.0.0.1:1234", user: "admin", admin: true},
+		{name: "from another network", proxy: Proxy{Networks: networks}, remoteAddr: "192.168.0.1:1234"},
+		{name: "from an IPv4-mapped address", proxy: Proxy{Networks: networks}, remoteAddr: "[::ffff:10.0.0.1]:1234", user: "admin", admin: true},
+		{name: "with the secret", proxy: Proxy{Secret: "s3cret"}, remoteAddr: "192.168.0.1:1234", secret: "s3cret", user: "admin", admin: true},
+		{name: "with a wrong secret", proxy: Proxy{Secret: "s3cret"}, remoteAddr: "192.168.0.1:1234", secret: "guess"},
+		{name: "network and secret are both required", proxy: Proxy{Networks: networks, Secret: "s3cret"}, remoteAddr: "10.0.0.1:1234"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var user string
+			var admin bool
+			var headers http.Header
+			handler := Middleware(tc.proxy, []string{"admin"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _ = UserFromContext(r.Context())
+				admin = IsAdmin(r.Context())
+				headers = r.Header
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set(UserHeader, "admin")
+			if tc.secret != "" {
+				req.Header.Set(ProxySecretHeader, tc.secret)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tc.user, user)
+			assert.Equal(t, tc.admin, admin)
+			assert.Empty(t, headers.Get(UserHeader), "the header is stripped")
+			assert.Empty(t, headers.Get(ProxySecretHeader), "the secret is stripped")
+		})
+	}
+}
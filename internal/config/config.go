@@ -1,47 +1,497 @@
+// Package config loads the settings shared by the server and forumctl.
+//
+// Every setting has a flag, an environment variable and a key in the YAML
+// file given with -config or CONFIG_FILE; the key is the flag name:
+//
+//	storage: postgres
+//	postgres-host: db.internal
+//	cache-size: 1000
+//	cache-ttl: 1m
+//	admin-users: [alice, bob]
+//
+// Flags take precedence over environment variables, which take precedence
+// over the file, which takes precedence over the defaults. Secrets can also
+// be read from a file named by the setting with a -file suffix:
+// -postgres-password-file, POSTGRES_PASSWORD_FILE or postgres-password-file.
 package config
 
 import (
+	"ArticleForum/internal/auth"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Port        string
 	StorageType string
-	PostgresDSN string
+	SQLitePath  string
+	AdminUsers  []string
+
+	// TrustedProxies и ProxySecret описывают аутентифицирующий прокси: только
+	// его заголовок X-User определяет пользователя. Если не задано ни то ни
+	// другое, заголовок игнорируется
+	TrustedProxies []string
+	ProxySecret    string
+
+	// PostgresDSN задаёт подключение целиком; если не задан, строится из
+	// PostgresHost, PostgresPort и остальных полей
+	PostgresDSN      string
+	PostgresHost     string
+	PostgresPort     int
+	PostgresUser     string
+	PostgresPassword string
+	PostgresDB       string
+	PostgresSSLMode  string
+
+	// PostgresReplicaDSNs перечисляет реплики для чтения. Клиент читает с
+	// основной базы в течение ReplicaStickyWindow после своей записи
+	PostgresReplicaDSNs []string
+	ReplicaStickyWindow time.Duration
+
+	// MigrateOnStart применяет миграции при запуске сервера. Если выключено,
+	// схему обновляет отдельный запуск `migrate up`
+	MigrateOnStart bool
+
+	// CacheSize включает кэширование постов и страниц комментариев, если
+	// больше нуля
+	CacheSize int
+	CacheTTL  time.Duration
+
+	// LogLevel — debug, info, warn или error; LogFormat — text или json
+	LogLevel  string
+	LogFormat string
+
+	// TracingExporter выбирает, куда отправлять трассировки: none, stdout
+	// или otlp. OTLPInsecure отправляет их коллектору без TLS.
+	// TraceFields добавляет спаны для каждого поля с резолвером
+	TracingExporter string
+	OTLPEndpoint    string
+	OTLPInsecure    bool
+	TraceFields     bool
+
+	// TLSCertFile и TLSKeyFile включают HTTPS; файлы перечитываются при
+	// изменении
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// AdminAddr включает отдельный адрес для метрик и администрирования.
+	// С AdminClientCAFile на нём принимаются только клиенты с сертификатом,
+	// выданным этим центром сертификации
+	AdminAddr         string
+	AdminClientCAFile string
+	// PublicMetrics отдаёт /metrics на основном порту, если AdminAddr не задан
+	PublicMetrics bool
+
+	// CORSAllowedOrigins перечисляет источники браузерных клиентов с других
+	// доменов (например, SPA), которым разрешено обращаться к /query, в том
+	// числе через websocket
+	CORSAllowedOrigins   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// ShutdownTimeout ограничивает ожидание текущих запросов и попытки доставки
+	// вебхуков при остановке сервера
+	ShutdownTimeout time.Duration
+
+	// DataDir включает сохранение хранилища в памяти на диск
+	DataDir          string
+	SnapshotInterval time.Duration
+}
+
+// dsnPassword matches the password in a key=value data source name.
+var dsnPassword = regexp.MustCompile(`password=('[^']*'|\S+)`)
+
+// setting binds a Config field to its flag, environment variable and file
+// key.
+type setting struct {
+	name  string
+	env   string
+	usage string
+	value flag.Value
+	// secret settings are redacted by Print and can be read from a file.
+	secret bool
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{name: "port", env: "PORT", value: (*stringValue)(&c.Port), usage: "HTTP port"},
+		{name: "storage", env: "STORAGE_TYPE", value: (*stringValue)(&c.StorageType), usage: "Storage type: memory, postgres or sqlite"},
+		{name: "admin-users", env: "ADMIN_USERS", value: (*listValue)(&c.AdminUsers), usage: "Comma-separated usernames allowed to manage webhooks"},
+		{name: "trusted-proxies", env: "TRUSTED_PROXIES", value: (*listValue)(&c.TrustedProxies), usage: "Comma-separated addresses or CIDR prefixes of the authenticating proxy allowed to set X-User"},
+		{name: "proxy-secret", env: "PROXY_SECRET", value: (*stringValue)(&c.ProxySecret), secret: true, usage: "Secret the authenticating proxy sends in X-Proxy-Secret along with X-User"},
+		{name: "postgres-dsn", env: "POSTGRES_DSN", value: (*stringValue)(&c.PostgresDSN), secret: true, usage: "PostgreSQL data source name (default: built from the postgres-* settings)"},
+		{name: "postgres-host", env: "POSTGRES_HOST", value: (*stringValue)(&c.PostgresHost), usage: "PostgreSQL host"},
+		{name: "postgres-port", env: "POSTGRES_PORT", value: (*intValue)(&c.PostgresPort), usage: "PostgreSQL port"},
+		{name: "postgres-user", env: "POSTGRES_USER", value: (*stringValue)(&c.PostgresUser), usage: "PostgreSQL user"},
+		{name: "postgres-password", env: "POSTGRES_PASSWORD", value: (*stringValue)(&c.PostgresPassword), secret: true, usage: "PostgreSQL password"},
+		{name: "postgres-db", env: "POSTGRES_DB", value: (*stringValue)(&c.PostgresDB), usage: "PostgreSQL database name"},
+		{name: "postgres-sslmode", env: "POSTGRES_SSLMODE", value: (*stringValue)(&c.PostgresSSLMode), usage: "PostgreSQL SSL mode"},
+		{name: "postgres-replica-dsns", env: "POSTGRES_REPLICA_DSNS", value: (*listValue)(&c.PostgresReplicaDSNs), secret: true, usage: "Comma-separated PostgreSQL read replica data source names"},
+		{name: "replica-sticky-window", env: "REPLICA_STICKY_WINDOW", value: (*durationValue)(&c.ReplicaStickyWindow), usage: "How long a client reads from the primary after its own write"},
+		{name: "sqlite-path", env: "SQLITE_PATH", value: (*stringValue)(&c.SQLitePath), usage: "SQLite database file"},
+		{name: "migrate-on-start", env: "MIGRATE_ON_START", value: (*boolValue)(&c.MigrateOnStart), usage: "Apply database migrations when the server starts"},
+		{name: "cache-size", env: "CACHE_SIZE", value: (*intValue)(&c.CacheSize), usage: "Number of cached posts, post lists and comment pages; 0 disables the cache"},
+		{name: "cache-ttl", env: "CACHE_TTL", value: (*durationValue)(&c.CacheTTL), usage: "How long cached posts and comments are served"},
+		{name: "log-level", env: "LOG_LEVEL", value: (*stringValue)(&c.LogLevel), usage: "Log level: debug, info, warn or error"},
+		{name: "log-format", env: "LOG_FORMAT", value: (*stringValue)(&c.LogFormat), usage: "Log format: text or json"},
+		{name: "tracing-exporter", env: "TRACING_EXPORTER", value: (*stringValue)(&c.TracingExporter), usage: "Trace exporter: none, stdout or otlp"},
+		{name: "otlp-endpoint", env: "OTLP_ENDPOINT", value: (*stringValue)(&c.OTLPEndpoint), usage: "OTLP/HTTP collector address, e.g. localhost:4318 (default: OTEL_EXPORTER_OTLP_* variables)"},
+		{name: "otlp-insecure", env: "OTLP_INSECURE", value: (*boolValue)(&c.OTLPInsecure), usage: "Send traces to the OTLP collector over plain HTTP instead of HTTPS"},
+		{name: "trace-fields", env: "TRACE_FIELDS", value: (*boolValue)(&c.TraceFields), usage: "Create a span for every resolved GraphQL field"},
+		{name: "tls-cert-file", env: "TLS_CERT_FILE", value: (*stringValue)(&c.TLSCertFile), usage: "TLS certificate file; enables HTTPS together with tls-key-file"},
+		{name: "tls-key-file", env: "TLS_KEY_FILE", value: (*stringValue)(&c.TLSKeyFile), usage: "TLS private key file"},
+		{name: "admin-addr", env: "ADMIN_ADDR", value: (*stringValue)(&c.AdminAddr), usage: "Address of the admin listener serving metrics and admin GraphQL, e.g. :9443; disabled when empty"},
+		{name: "admin-client-ca-file", env: "ADMIN_CLIENT_CA_FILE", value: (*stringValue)(&c.AdminClientCAFile), usage: "CA certificates that admin listener clients must present a certificate from"},
+		{name: "public-metrics", env: "PUBLIC_METRICS", value: (*boolValue)(&c.PublicMetrics), usage: "Serve /metrics on the main port when there is no admin listener"},
+		{name: "cors-allowed-origins", env: "CORS_ALLOWED_ORIGINS", value: (*listValue)(&c.CORSAllowedOrigins), usage: "Comma-separated origins, e.g. https://app.example.com, allowed to call /query from browsers; * allows any origin"},
+		{name: "cors-allowed-headers", env: "CORS_ALLOWED_HEADERS", value: (*listValue)(&c.CORSAllowedHeaders), usage: "Comma-separated request headers allowed in cross-origin requests"},
+		{name: "cors-allow-credentials", env: "CORS_ALLOW_CREDENTIALS", value: (*boolValue)(&c.CORSAllowCredentials), usage: "Allow cross-origin requests with cookies and HTTP authentication"},
+		{name: "cors-max-age", env: "CORS_MAX_AGE", value: (*durationValue)(&c.CORSMaxAge), usage: "How long browsers may cache preflight responses"},
+		{name: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", value: (*durationValue)(&c.ShutdownTimeout), usage: "How long to wait for running requests and the webhook delivery attempt in progress on shutdown"},
+		{name: "data-dir", env: "DATA_DIR", value: (*stringValue)(&c.DataDir), usage: "Directory for the memory storage write-ahead log and snapshots"},
+		{name: "snapshot-interval", env: "SNAPSHOT_INTERVAL", value: (*durationValue)(&c.SnapshotInterval), usage: "How often the memory storage writes a snapshot"},
+	}
 }
 
-func Load() *Config {
-	cfg := &Config{}
+func defaults() *Config {
+	return &Config{
+		Port:                "8080",
+		StorageType:         "memory",
+		PostgresHost:        "localhost",
+		PostgresPort:        5432,
+		PostgresUser:        "postgres",
+		PostgresDB:          "articleforum",
+		PostgresSSLMode:     "disable",
+		ReplicaStickyWindow: 5 * time.Second,
+		SQLitePath:          "articleforum.db",
+		MigrateOnStart:      true,
+		CacheTTL:            30 * time.Second,
+		LogLevel:            "info",
+		LogFormat:           "text",
+		TracingExporter:     "none",
+		CORSAllowedHeaders:  []string{"Content-Type", "Authorization", "X-Request-ID", "traceparent"},
+		CORSMaxAge:          10 * time.Minute,
+		ShutdownTimeout:     20 * time.Second,
+		SnapshotInterval:    5 * time.Minute,
+	}
+}
+
+// Load reads the configuration from the command line flags in os.Args, the
+// environment and the configuration file, and validates it. The flags are
+// registered on flag.CommandLine, so callers may add their own before
+// calling Load and read flag.Args afterwards.
+func Load() (*Config, error) {
+	return load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+}
+
+func load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := defaults()
+	settings := cfg.settings()
 
-	flag.StringVar(&cfg.StorageType, "storage", "memory", "Storage type: memory or postgres")
-	flag.StringVar(&cfg.PostgresDSN, "postgres-dsn", "", "PostgreSQL data source name")
-	flag.Parse()
+	configFile := fs.String("config", "", "YAML configuration file (default: CONFIG_FILE)")
+	for _, s := range settings {
+		fs.Var(s.value, s.name, s.usage+" ("+s.env+")")
+		if s.secret {
+			fs.Var(&fileValue{target: s.value}, s.name+"-file", "File containing the "+s.name+" value ("+s.env+"_FILE)")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	fromFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { fromFlags[f.Name] = true })
 
-	cfg.Port = os.Getenv("PORT")
-	if cfg.Port == "" {
-		cfg.Port = "8080"
+	// Источники применяются от младшего к старшему; значения, заданные
+	// флагами, уже разобраны и не перезаписываются
+	var sources []source
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
 	}
+	if *configFile != "" {
+		values, err := readFile(*configFile, settings)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: *configFile, lookup: func(s setting, file bool) (string, bool) {
+			key := s.name
+			if file {
+				key += "-file"
+			}
+			value, ok := values[key]
+			return value, ok
+		}})
+	}
+	sources = append(sources, source{name: "environment", lookup: func(s setting, file bool) (string, bool) {
+		key := s.env
+		if file {
+			key += "_FILE"
+		}
+		// Пустая переменная, как в .env.example, считается незаданной
+		value, ok := lookupEnv(key)
+		return value, ok && value != ""
+	}})
 
-	return cfg
+	for _, src := range sources {
+		if err := src.apply(settings, fromFlags); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if s.secret && fromFlags[s.name] && fromFlags[s.name+"-file"] {
+			return nil, fmt.Errorf("both -%s and -%s-file are set", s.name, s.name)
+		}
+	}
+
+	if cfg.PostgresDSN == "" {
+		cfg.PostgresDSN = cfg.buildPostgresDSN()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// source is a configuration file or the environment. lookup returns the raw
+// value of s, or with file set the name of a file holding the value.
+type source struct {
+	name   string
+	lookup func(s setting, file bool) (string, bool)
+}
+
+// apply sets the settings found in src, except those given as flags.
+func (src source) apply(settings []setting, fromFlags map[string]bool) error {
+	for _, s := range settings {
+		if fromFlags[s.name] || fromFlags[s.name+"-file"] {
+			continue
+		}
+
+		value, ok := src.lookup(s, false)
+		if s.secret {
+			path, fromFile := src.lookup(s, true)
+			if ok && fromFile {
+				return fmt.Errorf("%s: both %s and its file are set", src.name, s.name)
+			}
+			if fromFile {
+				var err error
+				if value, err = readSecret(path); err != nil {
+					return fmt.Errorf("%s: %s: %v", src.name, s.name, err)
+				}
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := s.value.Set(value); err != nil {
+			return fmt.Errorf("%s: invalid %s: %v", src.name, s.name, err)
+		}
 	}
-	return defaultValue
+	return nil
 }
 
-func buildPostgresDSN() string {
-	host := getEnv("POSTGRES_HOST", "localhost")
-	port := getEnv("POSTGRES_PORT", "5432")
-	user := getEnv("POSTGRES_USER", "postgres")
-	password := getEnv("POSTGRES_PASSWORD", "password")
-	dbname := getEnv("POSTGRES_DB", "articleforum")
-	sslmode := getEnv("POSTGRES_SSLMODE", "disable")
+// readFile reads a YAML configuration file into raw values by key. Lists
+// are joined with commas, as they are given in flags.
+func readFile(path string, settings []setting) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
 
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		user, password, host, port, dbname, sslmode)
+	var nodes map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.name] = true
+		if s.secret {
+			known[s.name+"-file"] = true
+		}
+	}
+
+	values := make(map[string]string, len(nodes))
+	for key, node := range nodes {
+		if !known[key] {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if node.Tag != "!!null" {
+				values[key] = node.Value
+			} else {
+				values[key] = ""
+			}
+		case yaml.SequenceNode:
+			items := make([]string, 0, len(node.Content))
+			for _, item := range node.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%s: line %d: %s must be a list of strings", path, item.Line, key)
+				}
+				items = append(items, item.Value)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("%s: line %d: %s must be a value or a list", path, node.Line, key)
+		}
+	}
+	return values, nil
+}
+
+// readSecret reads a secret from a file such as a Docker or Kubernetes
+// secret mount, without the trailing newline.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func (c *Config) buildPostgresDSN() string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.PostgresUser, c.PostgresPassword),
+		Host:     c.PostgresHost + ":" + strconv.Itoa(c.PostgresPort),
+		Path:     "/" + c.PostgresDB,
+		RawQuery: url.Values{"sslmode": {c.PostgresSSLMode}}.Encode(),
+	}
+	if c.PostgresPassword == "" {
+		dsn.User = url.User(c.PostgresUser)
+	}
+	return dsn.String()
+}
+
+// Validate reports all invalid settings at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(name, value string, allowed ...string) {
+		check(slices.Contains(allowed, value), "%s must be one of %s, got %q", name, strings.Join(allowed, ", "), value)
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "port must be a number between 1 and 65535, got %q", c.Port)
+	oneOf("storage", c.StorageType, "memory", "postgres", "sqlite")
+	oneOf("log-level", c.LogLevel, "debug", "info", "warn", "error")
+	oneOf("log-format", c.LogFormat, "text", "json")
+	oneOf("tracing-exporter", c.TracingExporter, "none", "stdout", "otlp")
+
+	switch c.StorageType {
+	case "postgres":
+		check(c.PostgresDSN != "", "postgres-dsn or postgres-host is required for postgres storage")
+		check(c.PostgresPort > 0 && c.PostgresPort < 65536, "postgres-port must be between 1 and 65535, got %d", c.PostgresPort)
+		check(c.ReplicaStickyWindow >= 0, "replica-sticky-window must not be negative")
+	case "sqlite":
+		check(c.SQLitePath != "", "sqlite-path is required for sqlite storage")
+	case "memory":
+		check(c.DataDir == "" || c.SnapshotInterval > 0, "snapshot-interval must be positive")
+	}
+
+	_, err = auth.ParseNetworks(c.TrustedProxies)
+	check(err == nil, "trusted-proxies: %v", err)
+
+	check(c.CacheSize >= 0, "cache-size must not be negative")
+	check(c.CacheSize == 0 || c.CacheTTL > 0, "cache-ttl must be positive when the cache is enabled")
+	check(c.ShutdownTimeout > 0, "shutdown-timeout must be positive")
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls-cert-file and tls-key-file must be set together")
+	if c.AdminClientCAFile != "" {
+		check(c.AdminAddr != "", "admin-client-ca-file requires admin-addr")
+		check(c.TLSCertFile != "", "admin-client-ca-file requires tls-cert-file and tls-key-file")
+	}
+	if c.AdminAddr != "" {
+		_, adminPort, err := net.SplitHostPort(c.AdminAddr)
+		check(err == nil, "admin-addr must be host:port or :port, got %q", c.AdminAddr)
+		check(err != nil || adminPort != c.Port, "admin-addr must use a port other than %s", c.Port)
+		check(!c.PublicMetrics, "public-metrics cannot be combined with admin-addr, metrics are served on the admin listener")
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			check(!c.CORSAllowCredentials, "cors-allowed-origins must list origins explicitly when cors-allow-credentials is set")
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil &&
+			u.Path == "" && u.RawQuery == "" && u.Fragment == "",
+			"cors-allowed-origins must contain origins like https://app.example.com, got %q", origin)
+	}
+	check(c.CORSMaxAge >= 0, "cors-max-age must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Print writes the configuration in the format of the configuration file,
+// with passwords and other secrets redacted.
+func Print(w io.Writer, c *Config) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.settings() {
+		var value *yaml.Node
+		if list, ok := s.value.(*listValue); ok {
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, item := range *list {
+				if s.secret {
+					item = redact(item)
+				}
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+			}
+		} else {
+			text := s.value.String()
+			if s.secret {
+				text = redact(text)
+			}
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: text}
+			if text == "" {
+				value.Style = yaml.DoubleQuotedStyle
+			}
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.name}, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redact hides the password in a data source name, or the whole value of
+// any other secret.
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+		return u.String()
+	}
+	if dsnPassword.MatchString(value) {
+		return dsnPassword.ReplaceAllString(value, "password=REDACTED")
+	}
+	return "[REDACTED]"
 }
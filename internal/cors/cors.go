@@ -0,0 +1,106 @@
+// Package cors lets browser clients served from other origins, such as the
+// SPA, call the GraphQL endpoint over HTTP and websockets.
+package cors
+
+import (
+	"ArticleForum/internal/logging"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wildcard allows every origin. It cannot be combined with credentials.
+const Wildcard = "*"
+
+// allowedMethods are the methods the GraphQL endpoint accepts.
+const allowedMethods = "GET, POST, OPTIONS"
+
+// Policy decides which cross-origin requests browsers may make.
+type Policy struct {
+	// AllowedOrigins lists origins as scheme://host[:port], or Wildcard.
+	AllowedOrigins []string
+	// AllowedHeaders lists the request headers clients may send besides
+	// the ones browsers always allow.
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and HTTP authentication
+	// and read the responses to such requests.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// AllowOrigin reports whether origin is in the allowlist.
+func (p Policy) AllowOrigin(origin string) bool {
+	return slices.ContainsFunc(p.AllowedOrigins, func(allowed string) bool {
+		return allowed == Wildcard || strings.EqualFold(allowed, origin)
+	})
+}
+
+// CheckOrigin accepts a websocket upgrade from the server's own origin, from
+// an allowed origin or without an Origin header, which only non-browser
+// clients omit. It is meant for websocket.Upgrader.CheckOrigin.
+func (p Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.AllowOrigin(origin)
+}
+
+// Middleware answers preflight requests and adds CORS headers to responses to
+// allowed origins. Requests from other origins are passed on without the
+// headers, so that browsers refuse to expose the responses; their preflight
+// requests are rejected with 403.
+func (p Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Ответ зависит от Origin, кэши должны это учитывать
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.AllowOrigin(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if p.AllowCredentials || !slices.Contains(p.AllowedOrigins, Wildcard) {
+			h.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			h.Set("Access-Control-Allow-Origin", Wildcard)
+		}
+		if p.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", logging.RequestIDHeader)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", allowedMethods)
+		if len(p.AllowedHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,99 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var policy = Policy{
+	AllowedOrigins:   []string{"https://app.example.com"},
+	AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func serve(p Policy, method, origin string, header http.Header) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	req := httptest.NewRequest(method, "/query", nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, called
+}
+
+func TestPreflight(t *testing.T) {
+	rec, called := serve(policy, http.MethodOptions, "https://app.example.com", http.Header{
+		"Access-Control-Request-Method":  {"POST"},
+		"Access-Control-Request-Headers": {"content-type,x-user"},
+	})
+	assert.False(t, called, "preflight requests are answered by the middleware")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST, OPTIONS", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Request-ID", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	rec, called = serve(policy, http.MethodOptions, "https://evil.example.com", http.Header{
+		"Access-Control-Request-Method": {"POST"},
+	})
+	assert.False(t, called)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestRequest(t *testing.T) {
+	rec, called := serve(policy, http.MethodPost, "https://APP.example.com", nil)
+	assert.True(t, called)
+	assert.Equal(t, "https://APP.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID", rec.Header().Get("Access-Control-Expose-Headers"))
+
+	// Запрос с чужого источника выполняется, но браузер не покажет ответ
+	rec, called = serve(policy, http.MethodPost, "https://evil.example.com", nil)
+	assert.True(t, called)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	rec, called = serve(policy, http.MethodPost, "", nil)
+	assert.True(t, called)
+	assert.Empty(t, rec.Header().Values("Vary"), "requests without Origin are not cross-origin")
+}
+
+func TestWildcard(t *testing.T) {
+	public := Policy{AllowedOrigins: []string{Wildcard}}
+	rec, _ := serve(public, http.MethodPost, "https://any.example.com", nil)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	rec, _ = serve(Policy{}, http.MethodPost, "https://any.example.com", nil)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "no origins are allowed by default")
+}
+
+func TestCheckOrigin(t *testing.T) {
+	upgrade := func(host, origin string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/query", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return req
+	}
+
+	assert.True(t, policy.CheckOrigin(upgrade("api.example.com", "https://app.example.com")))
+	assert.True(t, policy.CheckOrigin(upgrade("api.example.com", "https://api.example.com")), "same origin")
+	assert.True(t, policy.CheckOrigin(upgrade("api.example.com", "")), "non-browser client")
+	assert.False(t, policy.CheckOrigin(upgrade("api.example.com", "https://evil.example.com")))
+	assert.False(t, Policy{}.CheckOrigin(upgrade("api.example.com", "https://app.example.com")))
+}
@@ -1,19 +1,108 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+type ContentFormat string
+
+const (
+	ContentFormatPlain    ContentFormat = "plain"
+	ContentFormatMarkdown ContentFormat = "markdown"
+)
+
+type NotificationType string
+
+const (
+	NotificationTypeCommentReply NotificationType = "comment_reply"
+	NotificationTypePostComment  NotificationType = "post_comment"
+	NotificationTypeMention      NotificationType = "mention"
+)
+
+type EventType string
+
+const (
+	EventPostCreated    EventType = "post.created"
+	EventPostUpdated    EventType = "post.updated"
+	EventCommentCreated EventType = "comment.created"
+	EventCommentUpdated EventType = "comment.updated"
+)
+
+var EventTypes = []EventType{EventPostCreated, EventPostUpdated, EventCommentCreated, EventCommentUpdated}
+
+type User struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
 
 type Post struct {
-	ID              string    `json:"id"`
-	Title           string    `json:"title"`
-	Content         string    `json:"content"`
-	CommentsEnabled bool      `json:"commentsEnabled"`
-	CreatedAt       time.Time `json:"createdAt"`
+	ID              string        `json:"id"`
+	Author          string        `json:"author"`
+	Title           string        `json:"title"`
+	Content         string        `json:"content"`
+	ContentFormat   ContentFormat `json:"contentFormat"`
+	CommentsEnabled bool          `json:"commentsEnabled"`
+	CreatedAt       time.Time     `json:"createdAt"`
 }
 
 type Comment struct {
 	ID        string    `json:"id"`
 	PostID    string    `json:"postID"`
 	ParentID  *string   `json:"parentID"`
+	Author    string    `json:"author"`
 	Content   string    `json:"content"`
+	Mentions  []string  `json:"mentions"`
 	CreatedAt time.Time `json:"createdAt"`
 }
+
+type Notification struct {
+	ID        string           `json:"id"`
+	Recipient string           `json:"recipient"`
+	Type      NotificationType `json:"type"`
+	PostID    string           `json:"postID"`
+	CommentID string           `json:"commentID"`
+	Actor     string           `json:"actor"`
+	Read      bool             `json:"read"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type Event struct {
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type Webhook struct {
+	ID         string      `json:"id"`
+	URL        string      `json:"url"`
+	Secret     string      `json:"secret"`
+	EventTypes []EventType `json:"eventTypes"`
+	Active     bool        `json:"active"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+// QueuedDelivery is an event waiting to be delivered to one webhook.
+type QueuedDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookID"`
+	Event     Event  `json:"event"`
+	// Attempts counts the delivery attempts started so far.
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type WebhookDelivery struct {
+	ID         string        `json:"id"`
+	WebhookID  string        `json:"webhookID"`
+	EventID    string        `json:"eventID"`
+	EventType  EventType     `json:"eventType"`
+	Attempt    int           `json:"attempt"`
+	StatusCode int           `json:"statusCode"`
+	Error      string        `json:"error"`
+	Success    bool          `json:"success"`
+	Duration   time.Duration `json:"duration"`
+	CreatedAt  time.Time     `json:"createdAt"`
+}
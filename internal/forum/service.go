@@ -0,0 +1,149 @@
+// Package forum implements the forum operations that change data, shared by
+// the GraphQL and REST APIs: the caller is taken from the request context,
+// mentions are recorded with the comment and the affected users notified.
+package forum
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/notification"
+	"ArticleForum/internal/render"
+	"ArticleForum/internal/storage"
+	"context"
+	"log"
+	"sort"
+)
+
+type Service struct {
+	storage  storage.Storage
+	notifier *notification.Notifier
+}
+
+func NewService(storage storage.Storage, notifier *notification.Notifier) *Service {
+	return &Service{storage: storage, notifier: notifier}
+}
+
+// CreatePost creates a post authored by the caller, or an anonymous post when
+// the caller is not authenticated.
+func (s *Service) CreatePost(ctx context.Context, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	author, err := s.ensureUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storage.CreatePost(ctx, author, title, content, format, commentsEnabled)
+}
+
+// CreateComment adds the caller's comment to a post and notifies the affected
+// users. Like storage.Storage.CreateComment, it returns nil without an error
+// when the post does not exist, has comments disabled, or parentID is not a
+// comment of the same post.
+func (s *Service) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*domain.Comment, error) {
+	author, err := s.ensureUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Комментарий и его упоминания сохраняются вместе
+	var comment *domain.Comment
+	var mentioned []string
+	err = s.storage.WithinTx(ctx, func(tx storage.Storage) error {
+		var err error
+		comment, err = tx.CreateComment(ctx, postID, parentID, author, content)
+		if err != nil || comment == nil {
+			return err
+		}
+		comment, mentioned, err = recordMentions(ctx, tx, comment)
+		return err
+	})
+	if err != nil || comment == nil {
+		return nil, err
+	}
+
+	if err := s.notifier.CommentCreated(ctx, comment, mentioned); err != nil {
+		log.Printf("Failed to create notifications for comment %s: %v", comment.ID, err)
+	}
+	return comment, nil
+}
+
+// UpdateComment replaces the content of the caller's comment, recomputes its
+// mentions and notifies the users mentioned in it for the first time. It
+// returns nil when the comment does not exist and auth.ErrForbidden when it
+// belongs to someone else.
+func (s *Service) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	var comment *domain.Comment
+	var mentioned []string
+	err := s.storage.WithinTx(ctx, func(tx storage.Storage) error {
+		existing, err := tx.GetComment(ctx, id)
+		if err != nil || existing == nil {
+			return err
+		}
+		if existing.Author != user {
+			return auth.ErrForbidden
+		}
+
+		if comment, err = tx.UpdateComment(ctx, id, content); err != nil || comment == nil {
+			return err
+		}
+		// Упоминания пересчитываются по новому тексту; из добавленных уведомляем
+		// только тех, кто ещё не получал уведомления об этом комментарии
+		comment, mentioned, err = recordMentions(ctx, tx, comment)
+		return err
+	})
+	if err != nil || comment == nil {
+		return nil, err
+	}
+
+	if err := s.notifier.CommentEdited(ctx, comment, mentioned); err != nil {
+		log.Printf("Failed to create notifications for comment %s: %v", comment.ID, err)
+	}
+	return comment, nil
+}
+
+// ensureUser registers the authenticated caller, if any, and returns their
+// username. Anonymous callers get an empty username.
+func (s *Service) ensureUser(ctx context.Context) (string, error) {
+	username, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	if _, err := s.storage.EnsureUser(ctx, username); err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// recordMentions replaces the mentions of the comment with the known users
+// mentioned in its content. It returns the comment with the new mention list
+// and the users that were not mentioned in it before. Unknown usernames are
+// ignored. store is the unit of work the comment was written in.
+func recordMentions(ctx context.Context, store storage.Storage, comment *domain.Comment) (*domain.Comment, []string, error) {
+	known := make([]string, 0)
+	if usernames := render.ParseMentions(comment.Content); len(usernames) > 0 {
+		users, err := store.GetUsers(ctx, usernames)
+		if err != nil {
+			return comment, nil, err
+		}
+		for _, user := range users {
+			known = append(known, user.Username)
+		}
+	}
+	if len(known) == 0 && len(comment.Mentions) == 0 {
+		return comment, nil, nil
+	}
+
+	added, err := store.SetMentions(ctx, comment.ID, known)
+	if err != nil {
+		return comment, nil, err
+	}
+
+	updated := *comment
+	updated.Mentions = known
+	sort.Strings(updated.Mentions)
+	return &updated, added, nil
+}
@@ -0,0 +1,124 @@
+package forum
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/notification"
+	"ArticleForum/internal/storage/memory"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+	service := NewService(store, notification.NewNotifier(store))
+	alice := auth.WithUser(ctx, "alice")
+	bob := auth.WithUser(ctx, "bob")
+
+	for _, username := range []string{"carol", "dave"} {
+		_, err := store.EnsureUser(ctx, username)
+		require.NoError(t, err)
+	}
+	post, err := service.CreatePost(alice, "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", post.Author)
+
+	mentions := func(t *testing.T, recipient string) []*domain.Notification {
+		t.Helper()
+		notifications, err := store.GetNotifications(ctx, recipient, false, 10, "")
+		require.NoError(t, err)
+		var result []*domain.Notification
+		for _, n := range notifications {
+			if n.Type == domain.NotificationTypeMention {
+				result = append(result, n)
+			}
+		}
+		return result
+	}
+
+	t.Run("Creating a comment records mentions and notifies", func(t *testing.T) {
+		comment, err := service.CreateComment(bob, post.ID, nil, "Hi @carol and @nobody")
+		require.NoError(t, err)
+		require.NotNil(t, comment)
+		assert.Equal(t, "bob", comment.Author)
+		assert.Equal(t, []string{"carol"}, comment.Mentions, "unknown users are ignored")
+
+		notified := mentions(t, "carol")
+		require.Len(t, notified, 1)
+		assert.Equal(t, comment.ID, notified[0].CommentID)
+		assert.Equal(t, "bob", notified[0].Actor)
+
+		stored, err := store.GetComment(ctx, comment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"carol"}, stored.Mentions)
+	})
+
+	t.Run("Rejected comments return nil", func(t *testing.T) {
+		comment, err := service.CreateComment(bob, "missing", nil, "Hi @dave")
+		require.NoError(t, err)
+		assert.Nil(t, comment, "the post does not exist")
+
+		locked, err := service.CreatePost(alice, "Locked", "Content", domain.ContentFormatPlain, false)
+		require.NoError(t, err)
+		comment, err = service.CreateComment(bob, locked.ID, nil, "Hi @dave")
+		require.NoError(t, err)
+		assert.Nil(t, comment, "comments are disabled")
+
+		foreign, err := service.CreateComment(alice, post.ID, nil, "Parent")
+		require.NoError(t, err)
+		open, err := service.CreatePost(alice, "Open", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+		comment, err = service.CreateComment(bob, open.ID, &foreign.ID, "Hi @dave")
+		require.NoError(t, err)
+		assert.Nil(t, comment, "the parent belongs to another post")
+
+		assert.Empty(t, mentions(t, "dave"), "rejected comments notify nobody")
+	})
+
+	t.Run("Only the author can edit a comment", func(t *testing.T) {
+		comment, err := service.CreateComment(bob, post.ID, nil, "Original")
+		require.NoError(t, err)
+
+		_, err = service.UpdateComment(alice, comment.ID, "Hijacked")
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = service.UpdateComment(ctx, comment.ID, "Anonymous")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+		stored, err := store.GetComment(ctx, comment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Original", stored.Content)
+
+		missing, err := service.UpdateComment(bob, "missing", "Content")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("Editing recomputes mentions and notifies only first-time mentions", func(t *testing.T) {
+		comment, err := service.CreateComment(bob, post.ID, nil, "Ping @carol")
+		require.NoError(t, err)
+		before := len(mentions(t, "carol"))
+
+		edited, err := service.UpdateComment(bob, comment.ID, "Ping @carol and @dave")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"carol", "dave"}, edited.Mentions)
+		assert.Len(t, mentions(t, "carol"), before, "users mentioned before are not notified again")
+		assert.Len(t, mentions(t, "dave"), 1)
+
+		edited, err = service.UpdateComment(bob, comment.ID, "Ping @dave")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dave"}, edited.Mentions)
+		stored, err := store.GetComment(ctx, comment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dave"}, stored.Mentions, "removed mentions are deleted")
+		assert.Len(t, mentions(t, "dave"), 1)
+
+		edited, err = service.UpdateComment(bob, comment.ID, "Ping @dave and @carol again")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"carol", "dave"}, edited.Mentions)
+		assert.Len(t, mentions(t, "carol"), before, "users mentioned again are not notified again")
+	})
+}
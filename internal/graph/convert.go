@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/graph/model"
+)
+
+func toDomainContentFormat(format model.ContentFormat) domain.ContentFormat {
+	switch format {
+	case model.ContentFormatMarkdown:
+		return domain.ContentFormatMarkdown
+	default:
+		return domain.ContentFormatPlain
+	}
+}
+
+func toModelContentFormat(format domain.ContentFormat) model.ContentFormat {
+	switch format {
+	case domain.ContentFormatMarkdown:
+		return model.ContentFormatMarkdown
+	default:
+		return model.ContentFormatPlain
+	}
+}
+
+func toModelPost(post *domain.Post) *model.Post {
+	return &model.Post{
+		ID:              post.ID,
+		Author:          optionalString(post.Author),
+		Title:           post.Title,
+		Content:         post.Content,
+		ContentFormat:   toModelContentFormat(post.ContentFormat),
+		CommentsEnabled: post.CommentsEnabled,
+		CreatedAt:       post.CreatedAt,
+	}
+}
+
+func toModelComment(comment *domain.Comment) *model.Comment {
+	return &model.Comment{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		ParentID:  comment.ParentID,
+		Author:    optionalString(comment.Author),
+		Content:   comment.Content,
+		Mentions:  append([]string{}, comment.Mentions...),
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+func toModelNotificationType(kind domain.NotificationType) model.NotificationType {
+	switch kind {
+	case domain.NotificationTypeCommentReply:
+		return model.NotificationTypeCommentReply
+	case domain.NotificationTypeMention:
+		return model.NotificationTypeMention
+	default:
+		return model.NotificationTypePostComment
+	}
+}
+
+func toModelNotification(notification *domain.Notification) *model.Notification {
+	return &model.Notification{
+		ID:        notification.ID,
+		Type:      toModelNotificationType(notification.Type),
+		PostID:    notification.PostID,
+		CommentID: notification.CommentID,
+		Actor:     optionalString(notification.Actor),
+		Read:      notification.Read,
+		CreatedAt: notification.CreatedAt,
+	}
+}
+
+func toModelWebhook(webhook *domain.Webhook) *model.Webhook {
+	eventTypes := make([]string, 0, len(webhook.EventTypes))
+	for _, eventType := range webhook.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	return &model.Webhook{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		EventTypes: eventTypes,
+		Active:     webhook.Active,
+		CreatedAt:  webhook.CreatedAt,
+	}
+}
+
+func toModelWebhookDelivery(delivery *domain.WebhookDelivery) *model.WebhookDelivery {
+	result := &model.WebhookDelivery{
+		ID:         delivery.ID,
+		WebhookID:  delivery.WebhookID,
+		EventID:    delivery.EventID,
+		EventType:  string(delivery.EventType),
+		Attempt:    delivery.Attempt,
+		Error:      optionalString(delivery.Error),
+		Success:    delivery.Success,
+		DurationMs: int(delivery.Duration.Milliseconds()),
+		CreatedAt:  delivery.CreatedAt,
+	}
+	if delivery.StatusCode != 0 {
+		result.StatusCode = &delivery.StatusCode
+	}
+	return result
+}
+
+// optionalString maps an empty value, such as an anonymous author, to null.
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -3,26 +3,61 @@
 package model
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
 type Comment struct {
-	ID        string    `json:"id"`
-	PostID    string    `json:"postID"`
-	ParentID  *string   `json:"parentID,omitempty"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID          string    `json:"id"`
+	PostID      string    `json:"postID"`
+	ParentID    *string   `json:"parentID,omitempty"`
+	Author      *string   `json:"author,omitempty"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"contentHTML"`
+	Mentions    []string  `json:"mentions"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
 
 type Mutation struct {
 }
 
+type Notification struct {
+	ID        string           `json:"id"`
+	Type      NotificationType `json:"type"`
+	PostID    string           `json:"postID"`
+	CommentID string           `json:"commentID"`
+	Actor     *string          `json:"actor,omitempty"`
+	Read      bool             `json:"read"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type NotificationConnection struct {
+	Edges    []*NotificationEdge `json:"edges"`
+	PageInfo *PageInfo           `json:"pageInfo"`
+}
+
+type NotificationEdge struct {
+	Cursor string        `json:"cursor"`
+	Node   *Notification `json:"node"`
+}
+
+type PageInfo struct {
+	EndCursor   *string `json:"endCursor,omitempty"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
 type Post struct {
-	ID              string    `json:"id"`
-	Title           string    `json:"title"`
-	Content         string    `json:"content"`
-	CommentsEnabled bool      `json:"commentsEnabled"`
-	CreatedAt       time.Time `json:"createdAt"`
+	ID              string        `json:"id"`
+	Author          *string       `json:"author,omitempty"`
+	Title           string        `json:"title"`
+	Content         string        `json:"content"`
+	ContentFormat   ContentFormat `json:"contentFormat"`
+	ContentHTML     string        `json:"contentHTML"`
+	CommentsEnabled bool          `json:"commentsEnabled"`
+	CreatedAt       time.Time     `json:"createdAt"`
 }
 
 type Query struct {
@@ -30,3 +65,136 @@ type Query struct {
 
 type Subscription struct {
 }
+
+type Webhook struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhookID"`
+	EventID    string    `json:"eventID"`
+	EventType  string    `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"statusCode,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int       `json:"durationMs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ContentFormat string
+
+const (
+	ContentFormatPlain    ContentFormat = "PLAIN"
+	ContentFormatMarkdown ContentFormat = "MARKDOWN"
+)
+
+var AllContentFormat = []ContentFormat{
+	ContentFormatPlain,
+	ContentFormatMarkdown,
+}
+
+func (e ContentFormat) IsValid() bool {
+	switch e {
+	case ContentFormatPlain, ContentFormatMarkdown:
+		return true
+	}
+	return false
+}
+
+func (e ContentFormat) String() string {
+	return string(e)
+}
+
+func (e *ContentFormat) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ContentFormat(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ContentFormat", str)
+	}
+	return nil
+}
+
+func (e ContentFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ContentFormat) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ContentFormat) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type NotificationType string
+
+const (
+	NotificationTypeCommentReply NotificationType = "COMMENT_REPLY"
+	NotificationTypePostComment  NotificationType = "POST_COMMENT"
+	NotificationTypeMention      NotificationType = "MENTION"
+)
+
+var AllNotificationType = []NotificationType{
+	NotificationTypeCommentReply,
+	NotificationTypePostComment,
+	NotificationTypeMention,
+}
+
+func (e NotificationType) IsValid() bool {
+	switch e {
+	case NotificationTypeCommentReply, NotificationTypePostComment, NotificationTypeMention:
+		return true
+	}
+	return false
+}
+
+func (e NotificationType) String() string {
+	return string(e)
+}
+
+func (e *NotificationType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = NotificationType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid NotificationType", str)
+	}
+	return nil
+}
+
+func (e NotificationType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *NotificationType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e NotificationType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,24 @@
+package graph
+
+import "errors"
+
+// pageBounds returns the limit and offset of a list query, using defaultLimit
+// when no limit is given. Negative values are rejected.
+func pageBounds(limit, offset *int, defaultLimit int) (int, int, error) {
+	actualLimit := defaultLimit
+	if limit != nil {
+		actualLimit = *limit
+	}
+	actualOffset := 0
+	if offset != nil {
+		actualOffset = *offset
+	}
+
+	if actualLimit < 0 {
+		return 0, 0, errors.New("limit must not be negative")
+	}
+	if actualOffset < 0 {
+		return 0, 0, errors.New("offset must not be negative")
+	}
+	return actualLimit, actualOffset, nil
+}
@@ -3,40 +3,61 @@ package graph
 // THIS CODE WILL BE UPDATED WITH SCHEMA CHANGES. PREVIOUS IMPLEMENTATION FOR SCHEMA CHANGES WILL BE KEPT IN THE COMMENT SECTION. IMPLEMENTATION FOR UNCHANGED SCHEMA WILL BE KEPT.
 
 import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/forum"
 	"ArticleForum/internal/graph/model"
+	"ArticleForum/internal/notification"
+	"ArticleForum/internal/pubsub"
+	"ArticleForum/internal/render"
 	"ArticleForum/internal/storage"
 	"context"
+	"errors"
+)
+
+const (
+	defaultNotificationsPageSize = 20
+	maxNotificationsPageSize     = 100
+	defaultDeliveriesPageSize    = 20
 )
 
 type Resolver struct {
-	storage storage.Storage
+	storage  storage.Storage
+	forum    *forum.Service
+	renderer *render.Renderer
+	notifier *notification.Notifier
+	comments *pubsub.Broker[*domain.Comment]
 }
 
 func NewResolver(storage storage.Storage) *Resolver {
+	notifier := notification.NewNotifier(storage)
 	return &Resolver{
-		storage: storage,
+		storage:  storage,
+		forum:    forum.NewService(storage, notifier),
+		renderer: render.NewRenderer(render.DefaultCacheSize),
+		notifier: notifier,
+		comments: pubsub.NewBroker[*domain.Comment](),
 	}
 }
 
 // CreatePost is the resolver for the createPost field.
-func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, commentsEnabled bool) (*model.Post, error) {
-	post, err := r.storage.CreatePost(ctx, title, content, commentsEnabled)
+func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, commentsEnabled bool, contentFormat *model.ContentFormat) (*model.Post, error) {
+	format := model.ContentFormatPlain
+	if contentFormat != nil {
+		format = *contentFormat
+	}
+
+	post, err := r.forum.CreatePost(ctx, title, content, toDomainContentFormat(format), commentsEnabled)
 	if err != nil {
 		return nil, err
 	}
 
-	return &model.Post{
-		ID:              post.ID,
-		Title:           post.Title,
-		Content:         post.Content,
-		CommentsEnabled: post.CommentsEnabled,
-		CreatedAt:       post.CreatedAt,
-	}, nil
+	return toModelPost(post), nil
 }
 
 // CreateComment is the resolver for the createComment field.
 func (r *mutationResolver) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*model.Comment, error) {
-	comment, err := r.storage.CreateComment(ctx, postID, parentID, content)
+	comment, err := r.forum.CreateComment(ctx, postID, parentID, content)
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +66,73 @@ func (r *mutationResolver) CreateComment(ctx context.Context, postID string, par
 		return nil, nil // Пост не найден или комментарии запрещены
 	}
 
-	return &model.Comment{
-		ID:        comment.ID,
-		PostID:    comment.PostID,
-		ParentID:  comment.ParentID,
-		Content:   comment.Content,
-		CreatedAt: comment.CreatedAt,
-	}, nil
+	return toModelComment(comment), nil
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, content string) (*model.Comment, error) {
+	comment, err := r.forum.UpdateComment(ctx, id, content)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return nil, nil
+	}
+
+	return toModelComment(comment), nil
+}
+
+// MarkNotificationsRead is the resolver for the markNotificationsRead field.
+func (r *mutationResolver) MarkNotificationsRead(ctx context.Context, ids []string) (int, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return 0, auth.ErrUnauthenticated
+	}
+
+	return r.storage.MarkNotificationsRead(ctx, user, ids)
+}
+
+// ContentHTML is the resolver for the contentHTML field.
+func (r *postResolver) ContentHTML(ctx context.Context, obj *model.Post) (string, error) {
+	return r.renderer.Render(toDomainContentFormat(obj.ContentFormat), obj.Content)
+}
+
+// CreateWebhook is the resolver for the createWebhook field.
+func (r *mutationResolver) CreateWebhook(ctx context.Context, url string, secret string, eventTypes []string) (*model.Webhook, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, auth.ErrForbidden
+	}
+	if err := validateWebhookURL(url); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, errors.New("webhook secret must not be empty")
+	}
+
+	types, err := parseEventTypes(eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := r.storage.CreateWebhook(ctx, url, secret, types)
+	if err != nil {
+		return nil, err
+	}
+	return toModelWebhook(webhook), nil
+}
+
+// DeleteWebhook is the resolver for the deleteWebhook field.
+func (r *mutationResolver) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	if !auth.IsAdmin(ctx) {
+		return false, auth.ErrForbidden
+	}
+
+	return r.storage.DeleteWebhook(ctx, id)
+}
+
+// ContentHTML is the resolver for the contentHTML field.
+func (r *commentResolver) ContentHTML(ctx context.Context, obj *model.Comment) (string, error) {
+	return r.renderer.RenderComment(obj.Content, obj.Mentions)
 }
 
 // Posts is the resolver for the posts field.
@@ -63,13 +144,7 @@ func (r *queryResolver) Posts(ctx context.Context) ([]*model.Post, error) {
 
 	var result []*model.Post
 	for _, post := range posts {
-		result = append(result, &model.Post{
-			ID:              post.ID,
-			Title:           post.Title,
-			Content:         post.Content,
-			CommentsEnabled: post.CommentsEnabled,
-			CreatedAt:       post.CreatedAt,
-		})
+		result = append(result, toModelPost(post))
 	}
 	return result, nil
 }
@@ -85,25 +160,14 @@ func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error
 		return nil, nil
 	}
 
-	return &model.Post{
-		ID:              post.ID,
-		Title:           post.Title,
-		Content:         post.Content,
-		CommentsEnabled: post.CommentsEnabled,
-		CreatedAt:       post.CreatedAt,
-	}, nil
+	return toModelPost(post), nil
 }
 
 // Comments is the resolver for the comments field.
 func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int, offset *int) ([]*model.Comment, error) {
-	actualLimit := 10
-	if limit != nil {
-		actualLimit = *limit
-	}
-
-	actualOffset := 0
-	if offset != nil {
-		actualOffset = *offset
+	actualLimit, actualOffset, err := pageBounds(limit, offset, 10)
+	if err != nil {
+		return nil, err
 	}
 
 	comments, err := r.storage.GetComments(ctx, postID, actualLimit, actualOffset)
@@ -113,33 +177,151 @@ func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int,
 
 	var result []*model.Comment
 	for _, comment := range comments {
-		result = append(result, &model.Comment{
-			ID:        comment.ID,
-			PostID:    comment.PostID,
-			ParentID:  comment.ParentID,
-			Content:   comment.Content,
-			CreatedAt: comment.CreatedAt,
+		result = append(result, toModelComment(comment))
+	}
+	return result, nil
+}
+
+// Notifications is the resolver for the notifications field.
+func (r *queryResolver) Notifications(ctx context.Context, unreadOnly *bool, first *int, after *string) (*model.NotificationConnection, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	limit := defaultNotificationsPageSize
+	if first != nil && *first > 0 {
+		limit = min(*first, maxNotificationsPageSize)
+	}
+
+	cursor := ""
+	if after != nil {
+		cursor = *after
+	}
+
+	// Запрашиваем на одно уведомление больше, чтобы узнать, есть ли следующая страница
+	notifications, err := r.storage.GetNotifications(ctx, user, unreadOnly != nil && *unreadOnly, limit+1, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.NotificationConnection{
+		Edges:    []*model.NotificationEdge{},
+		PageInfo: &model.PageInfo{HasNextPage: len(notifications) > limit},
+	}
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	for _, notification := range notifications {
+		result.Edges = append(result.Edges, &model.NotificationEdge{
+			Cursor: notification.ID,
+			Node:   toModelNotification(notification),
 		})
 	}
+	if len(notifications) > 0 {
+		result.PageInfo.EndCursor = &notifications[len(notifications)-1].ID
+	}
+	return result, nil
+}
+
+// Webhooks is the resolver for the webhooks field.
+func (r *queryResolver) Webhooks(ctx context.Context) ([]*model.Webhook, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, auth.ErrForbidden
+	}
+
+	webhooks, err := r.storage.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		result = append(result, toModelWebhook(webhook))
+	}
+	return result, nil
+}
+
+// WebhookDeliveries is the resolver for the webhookDeliveries field.
+func (r *queryResolver) WebhookDeliveries(ctx context.Context, webhookID string, limit *int, offset *int) ([]*model.WebhookDelivery, error) {
+	if !auth.IsAdmin(ctx) {
+		return nil, auth.ErrForbidden
+	}
+
+	actualLimit, actualOffset, err := pageBounds(limit, offset, defaultDeliveriesPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := r.storage.GetWebhookDeliveries(ctx, webhookID, actualLimit, actualOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, toModelWebhookDelivery(delivery))
+	}
 	return result, nil
 }
 
 // CommentAdded is the resolver for the commentAdded field.
 func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
+	comments := r.comments.Subscribe(ctx, postID)
 	ch := make(chan *model.Comment, 1)
+	go func() {
+		defer close(ch)
+		for comment := range comments {
+			select {
+			case ch <- toModelComment(comment):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 	return ch, nil
 }
 
+// NotificationAdded is the resolver for the notificationAdded field.
+func (r *subscriptionResolver) NotificationAdded(ctx context.Context) (<-chan *model.Notification, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	notifications := r.notifier.Subscribe(ctx, user)
+	ch := make(chan *model.Notification, 1)
+	go func() {
+		defer close(ch)
+		for notification := range notifications {
+			select {
+			case ch <- toModelNotification(notification):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Post returns PostResolver implementation.
+func (r *Resolver) Post() PostResolver { return &postResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
 
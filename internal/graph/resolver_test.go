@@ -1,7 +1,11 @@
 package graph
 
 import (
+	"ArticleForum/internal/auth"
 	"ArticleForum/internal/domain"
+	"ArticleForum/internal/graph/model"
+	"ArticleForum/internal/outbox"
+	"ArticleForum/internal/storage/memory"
 	"ArticleForum/internal/storage/mock"
 	"context"
 	"testing"
@@ -22,27 +26,43 @@ func TestResolverWithMocks(t *testing.T) {
 			ID:              "1",
 			Title:           "Test Title",
 			Content:         "Test Content",
+			ContentFormat:   domain.ContentFormatPlain,
 			CommentsEnabled: true,
 			CreatedAt:       time.Now(),
 		}
-		mockStorage.On("CreatePost", context.Background(), "Test Title", "Test Content", true).Return(expectedPost, nil)
+		mockStorage.On("CreatePost", context.Background(), "", "Test Title", "Test Content", domain.ContentFormatPlain, true).Return(expectedPost, nil)
 
 		post, err := resolver.Mutation().CreatePost(
 			context.Background(),
 			"Test Title",
 			"Test Content",
 			true,
+			nil,
 		)
 
 		require.NoError(t, err)
 		assert.Equal(t, "1", post.ID)
 		assert.Equal(t, "Test Title", post.Title)
 		assert.Equal(t, "Test Content", post.Content)
+		assert.Equal(t, model.ContentFormatPlain, post.ContentFormat)
 		assert.True(t, post.CommentsEnabled)
 
 		mockStorage.AssertExpectations(t)
 	})
 
+	t.Run("ContentHTML renders markdown", func(t *testing.T) {
+		post := &model.Post{
+			Content:       "# Title\n\n[link](https://example.com) <script>alert(1)</script>",
+			ContentFormat: model.ContentFormatMarkdown,
+		}
+
+		html, err := resolver.Post().ContentHTML(context.Background(), post)
+		require.NoError(t, err)
+		assert.Contains(t, html, "<h1>Title</h1>")
+		assert.Contains(t, html, `rel="nofollow`)
+		assert.NotContains(t, html, "<script>")
+	})
+
 	t.Run("GetPosts with mock", func(t *testing.T) {
 		expectedPosts := []*domain.Post{
 			{
@@ -80,7 +100,8 @@ func TestResolverWithMocks(t *testing.T) {
 			Content:   "Test Comment",
 			CreatedAt: time.Now(),
 		}
-		mockStorage.On("CreateComment", context.Background(), "post-1", (*string)(nil), "Test Comment").Return(expectedComment, nil)
+		mockStorage.On("CreateComment", context.Background(), "post-1", (*string)(nil), "", "Test Comment").Return(expectedComment, nil)
+		mockStorage.On("GetPost", context.Background(), "post-1").Return(nil, nil)
 
 		comment, err := resolver.Mutation().CreateComment(
 			context.Background(),
@@ -131,4 +152,110 @@ func TestResolverWithMocks(t *testing.T) {
 
 		mockStorage.AssertExpectations(t)
 	})
+
+	t.Run("Negative comment page bounds are rejected", func(t *testing.T) {
+		negative := -1
+		_, err := resolver.Query().Comments(context.Background(), "post-1", &negative, nil)
+		assert.ErrorContains(t, err, "limit must not be negative")
+		_, err = resolver.Query().Comments(context.Background(), "post-1", nil, &negative)
+		assert.ErrorContains(t, err, "offset must not be negative")
+
+		mockStorage.AssertNotCalled(t, "GetComments", context.Background(), "post-1", -1, 0)
+		mockStorage.AssertNotCalled(t, "GetComments", context.Background(), "post-1", 10, -1)
+	})
+}
+
+func TestCommentMentions(t *testing.T) {
+	resolver := NewResolver(memory.NewMemoryStorage())
+	alice := auth.WithUser(context.Background(), "alice")
+	bob := auth.WithUser(context.Background(), "bob")
+
+	post, err := resolver.Mutation().CreatePost(alice, "Title", "Content", true, nil)
+	require.NoError(t, err)
+
+	comment, err := resolver.Mutation().CreateComment(bob, post.ID, nil, "Thanks @alice, cc @nobody")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, comment.Mentions)
+
+	html, err := resolver.Comment().ContentHTML(bob, comment)
+	require.NoError(t, err)
+	assert.Contains(t, html, `<a href="/users/alice" class="mention">@alice</a>`)
+	assert.Contains(t, html, "@nobody")
+
+	edited, err := resolver.Mutation().UpdateComment(bob, comment.ID, "Thanks again @alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, edited.Mentions)
+
+	notifications, err := resolver.Query().Notifications(alice, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, notifications.Edges, 1)
+	assert.Equal(t, model.NotificationTypeMention, notifications.Edges[0].Node.Type)
+
+	edited, err = resolver.Mutation().UpdateComment(bob, comment.ID, "Thanks, everyone")
+	require.NoError(t, err)
+	assert.Empty(t, edited.Mentions, "users removed from the text are no longer mentioned")
+	comments, err := resolver.Query().Comments(bob, post.ID, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Empty(t, comments[0].Mentions)
+
+	_, err = resolver.Mutation().UpdateComment(bob, comment.ID, "Thanks @alice, after all")
+	require.NoError(t, err)
+	notifications, err = resolver.Query().Notifications(alice, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, notifications.Edges, 1, "a user mentioned again is not notified again")
+
+	_, err = resolver.Mutation().UpdateComment(alice, comment.ID, "Hijacked")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+}
+
+func TestWebhookAdministration(t *testing.T) {
+	resolver := NewResolver(memory.NewMemoryStorage())
+	admin := auth.WithAdmin(auth.WithUser(context.Background(), "root"))
+
+	_, err := resolver.Mutation().CreateWebhook(auth.WithUser(context.Background(), "bob"), "https://example.com/hook", "secret", []string{"post.created"})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+
+	_, err = resolver.Mutation().CreateWebhook(admin, "https://example.com/hook", "secret", []string{"post.deleted"})
+	assert.Error(t, err)
+
+	created, err := resolver.Mutation().CreateWebhook(admin, "https://example.com/hook", "secret", []string{"post.created", "comment.created"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post.created", "comment.created"}, created.EventTypes)
+
+	webhooks, err := resolver.Query().Webhooks(admin)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+
+	deleted, err := resolver.Mutation().DeleteWebhook(admin, created.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestCommentAddedSubscription(t *testing.T) {
+	store := memory.NewMemoryStorage()
+	resolver := NewResolver(store)
+	relay := outbox.NewRelay(store, 0, resolver.HandleEvent)
+
+	post, err := resolver.Mutation().CreatePost(context.Background(), "Title", "Content", true, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	comments, err := resolver.Subscription().CommentAdded(ctx, post.ID)
+	require.NoError(t, err)
+
+	created, err := resolver.Mutation().CreateComment(context.Background(), post.ID, nil, "Live comment")
+	require.NoError(t, err)
+
+	_, err = relay.Flush(context.Background())
+	require.NoError(t, err)
+
+	select {
+	case comment := <-comments:
+		assert.Equal(t, created.ID, comment.ID)
+		assert.Equal(t, "Live comment", comment.Content)
+	case <-time.After(time.Second):
+		t.Fatal("comment was not delivered to the subscription")
+	}
 }
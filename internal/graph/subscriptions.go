@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/forum"
+	"context"
+	"encoding/json"
+)
+
+// HandleEvent feeds committed outbox events to GraphQL subscriptions. It is
+// meant to be registered as an outbox.Handler.
+func (r *Resolver) HandleEvent(ctx context.Context, event *domain.Event) error {
+	if event.Type != domain.EventCommentCreated {
+		return nil
+	}
+
+	var comment domain.Comment
+	if err := json.Unmarshal(event.Data, &comment); err != nil {
+		return err
+	}
+	r.comments.Publish(comment.PostID, &comment)
+	return nil
+}
+
+// Close ends all GraphQL subscriptions, so that their clients receive a
+// complete message. Call it once the outbox relay has stopped.
+func (r *Resolver) Close() {
+	r.comments.Close()
+	r.notifier.Close()
+}
+
+// Forum returns the service behind the mutations. Other APIs use it so that
+// their changes notify the subscribers of this resolver.
+func (r *Resolver) Forum() *forum.Service {
+	return r.forum
+}
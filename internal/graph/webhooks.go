@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"ArticleForum/internal/domain"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+func validateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %v", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("webhook url must be an absolute http or https url")
+	}
+	return nil
+}
+
+func parseEventTypes(eventTypes []string) ([]domain.EventType, error) {
+	if len(eventTypes) == 0 {
+		return nil, errors.New("at least one event type is required")
+	}
+
+	result := make([]domain.EventType, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		if !slices.Contains(domain.EventTypes, domain.EventType(eventType)) {
+			return nil, fmt.Errorf("unknown event type %q", eventType)
+		}
+		if !slices.Contains(result, domain.EventType(eventType)) {
+			result = append(result, domain.EventType(eventType))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,222 @@
+// Package health serves the liveness and readiness endpoints used by
+// orchestrators such as Kubernetes.
+//
+// /healthz answers 200 as long as the process can serve HTTP. /readyz runs
+// the registered checks and answers 200 when all of them pass and 503
+// otherwise, with the result of every check in the body:
+//
+//	{"status":"unavailable","checks":{"broker":{"status":"ok"},"storage":{"status":"error","error":"..."}}}
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single run of a check.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK          = "ok"
+	StatusError       = "error"
+	StatusUnavailable = "unavailable"
+	// StatusShuttingDown is reported by readiness after Shutdown, without
+	// running the checks.
+	StatusShuttingDown = "shutting down"
+)
+
+// Check reports whether a dependency can be used.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body of a readiness response.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs the named readiness checks.
+type Checker struct {
+	timeout time.Duration
+
+	mu           sync.Mutex
+	checks       map[string]Check
+	shuttingDown bool
+	// failing holds the checks that failed on the last run, to log only
+	// changes of state instead of every probe.
+	failing map[string]bool
+}
+
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+		failing: make(map[string]bool),
+	}
+}
+
+// Add registers a readiness check under name, replacing a check with the same
+// name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run runs all checks concurrently, each limited by the checker timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	if c.shuttingDown {
+		c.mu.Unlock()
+		return Report{Status: StatusShuttingDown}
+	}
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := Result{Status: StatusOK}
+			if err := run(ctx, check); err != nil {
+				result = Result{Status: StatusError, Error: err.Error()}
+			}
+			mu.Lock()
+			report.Checks[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	c.logChanges(report)
+	return report
+}
+
+// run waits for check until ctx is done, so that a check ignoring its
+// context cannot hold up the probe.
+func run(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Checker) logChanges(report Report) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, result := range report.Checks {
+		failing := result.Status != StatusOK
+		if failing == c.failing[name] {
+			continue
+		}
+		if failing {
+			log.Printf("Readiness check %s failed: %s", name, result.Error)
+		} else {
+			log.Printf("Readiness check %s recovered", name)
+		}
+		c.failing[name] = failing
+	}
+}
+
+// Shutdown makes readiness fail from now on, so that load balancers stop
+// sending new requests while the server drains the current ones.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shuttingDown = true
+}
+
+// Liveness returns the /healthz handler. It does not run the checks: a
+// failing dependency is a reason to stop routing traffic to the process, not
+// to restart it.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// Readiness returns the /readyz handler.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	// Ответы проб не должны оседать в кэшах прокси
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Wait runs check until it succeeds, at most maxAttempts times with interval
+// between attempts, and returns the last error otherwise. Each attempt is
+// limited by the checker timeout.
+func (c *Checker) Wait(ctx context.Context, name string, check Check, maxAttempts int, interval time.Duration) error {
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		err = run(attemptCtx, check)
+		cancel()
+		if err == nil {
+			log.Printf("%s is ready", name)
+			return nil
+		}
+		log.Printf("%s is not ready (attempt %d/%d): %v", name, i+1, maxAttempts, err)
+		if i == maxAttempts-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return fmt.Errorf("%s not available after %d attempts: %v", name, maxAttempts, err)
+}
@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Liveness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	checker := New(50 * time.Millisecond)
+	checker.Add("storage", func(ctx context.Context) error { return nil })
+
+	report := probe(t, checker, http.StatusOK)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, Result{Status: StatusOK}, report.Checks["storage"])
+
+	checker.Add("broker", func(ctx context.Context) error { return errors.New("relay is not running") })
+	report = probe(t, checker, http.StatusServiceUnavailable)
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, Result{Status: StatusOK}, report.Checks["storage"])
+	assert.Equal(t, Result{Status: StatusError, Error: "relay is not running"}, report.Checks["broker"])
+}
+
+func TestReadinessShutdown(t *testing.T) {
+	checker := New(0)
+	checker.Add("storage", func(ctx context.Context) error { return nil })
+	checker.Shutdown()
+
+	report := probe(t, checker, http.StatusServiceUnavailable)
+	assert.Equal(t, StatusShuttingDown, report.Status)
+	assert.Empty(t, report.Checks)
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	checker := New(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	// Проверка, не учитывающая контекст, не должна задерживать ответ
+	checker.Add("storage", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+
+	start := time.Now()
+	report := probe(t, checker, http.StatusServiceUnavailable)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["storage"].Error)
+}
+
+func TestWait(t *testing.T) {
+	checker := New(time.Second)
+	attempts := 0
+	check := func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	require.NoError(t, checker.Wait(context.Background(), "database", check, 5, time.Millisecond))
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err := checker.Wait(context.Background(), "database", check, 2, time.Millisecond)
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 2, attempts)
+}
+
+func probe(t *testing.T, checker *Checker, code int) Report {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	checker.Readiness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, code, rec.Code)
+
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return report
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveNames are parts of variable names whose values are never logged.
+var sensitiveNames = []string{"password", "secret", "token", "key", "authorization", "credential"}
+
+// GraphQL returns a gqlgen extension that logs every operation with its
+// name, redacted variables, duration and errors. Subscriptions are logged
+// when they start and when they end rather than per event.
+func GraphQL() graphql.HandlerExtension {
+	return graphQLExtension{}
+}
+
+type graphQLExtension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.ResponseInterceptor
+} = graphQLExtension{}
+
+func (graphQLExtension) ExtensionName() string {
+	return "Logging"
+}
+
+func (graphQLExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse logs queries and mutations, including requests that
+// failed validation before an operation could be started.
+func (graphQLExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	response := next(ctx)
+	if !graphql.HasOperationContext(ctx) {
+		return response
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation != nil && oc.Operation.Operation == ast.Subscription {
+		return response
+	}
+
+	var messages []string
+	level := slog.LevelInfo
+	if response != nil && len(response.Errors) > 0 {
+		level = slog.LevelWarn
+		messages = errorMessages(response.Errors)
+	}
+	operationLogger(ctx, oc).Log(ctx, level, "graphql operation",
+		slog.Duration("duration", time.Since(oc.Stats.OperationStart)), slog.Any("errors", messages))
+	return response
+}
+
+// InterceptOperation logs subscriptions when they start and when they end.
+func (graphQLExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil || oc.Operation.Operation != ast.Subscription {
+		return next(ctx)
+	}
+
+	logger := operationLogger(ctx, oc)
+	logger.InfoContext(ctx, "graphql subscription started")
+
+	responses := next(ctx)
+	var messages []string
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+		if response == nil {
+			logger.InfoContext(ctx, "graphql subscription finished",
+				slog.Duration("duration", time.Since(oc.Stats.OperationStart)), slog.Any("errors", messages))
+			return nil
+		}
+		messages = append(messages, errorMessages(response.Errors)...)
+		return response
+	}
+}
+
+func operationLogger(ctx context.Context, oc *graphql.OperationContext) *slog.Logger {
+	name, kind := oc.OperationName, "unknown"
+	if oc.Operation != nil {
+		kind = string(oc.Operation.Operation)
+		if name == "" {
+			name = oc.Operation.Name
+		}
+	}
+
+	logger := FromContext(ctx).With(
+		slog.String("operation", name),
+		slog.String("type", kind),
+		slog.Any("variables", Redact(oc.Variables)),
+	)
+	if span := trace.SpanFromContext(ctx).SpanContext(); span.IsValid() {
+		logger = logger.With(slog.String("trace_id", span.TraceID().String()))
+	}
+	return logger
+}
+
+func errorMessages(errors gqlerror.List) []string {
+	messages := make([]string, 0, len(errors))
+	for _, err := range errors {
+		messages = append(messages, err.Message)
+	}
+	return messages
+}
+
+// Redact returns a copy of GraphQL variables with the values of sensitive
+// variables and input fields, such as secrets and passwords, replaced.
+func Redact(variables map[string]any) map[string]any {
+	if variables == nil {
+		return nil
+	}
+	result := make(map[string]any, len(variables))
+	for name, value := range variables {
+		if isSensitive(name) {
+			result[name] = redacted
+			continue
+		}
+		result[name] = redactValue(value)
+	}
+	return result
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return Redact(v)
+	case []any:
+		values := make([]any, len(v))
+		for i, item := range v {
+			values[i] = redactValue(item)
+		}
+		return values
+	default:
+		return value
+	}
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/graph"
+	"ArticleForum/internal/storage/memory"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "verbose", "text")
+	assert.ErrorContains(t, err, "log level")
+	_, err = New(&bytes.Buffer{}, "info", "xml")
+	assert.ErrorContains(t, err, "log format")
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "json")
+	require.NoError(t, err)
+	logger.Info("hidden")
+	logger.Warn("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `"msg":"shown"`)
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var seen string
+	handler := Middleware(slogDiscard())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", rec.Header().Get(RequestIDHeader))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, seen)
+	assert.NotEqual(t, "abc-123", seen)
+	assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+}
+
+func TestGraphQLLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	require.NoError(t, err)
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(memory.NewMemoryStorage())}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(GraphQL())
+	h := Middleware(logger)(auth.Middleware(auth.Proxy{Secret: "proxy"}, []string{"admin"})(srv))
+
+	post := func(body string) map[string]any {
+		t.Helper()
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(RequestIDHeader, "req-1")
+		req.Header.Set(auth.UserHeader, "admin")
+		req.Header.Set(auth.ProxySecretHeader, "proxy")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 1)
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		return entry
+	}
+
+	entry := post(`{"query":"query Feed { posts { id } }"}`)
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "graphql operation", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, "Feed", entry["operation"])
+	assert.Equal(t, "query", entry["type"])
+	assert.Contains(t, entry, "duration")
+	assert.Nil(t, entry["errors"])
+
+	entry = post(`{"query":"mutation Hook($url: String!, $secret: String!) { createWebhook(url: $url, secret: $secret, eventTypes: [\"comment.created\"]) { id } }",
+		"variables":{"url":"http://example.com","secret":"s3cr3t"}}`)
+	assert.Equal(t, map[string]any{"url": "http://example.com", "secret": redacted}, entry["variables"])
+	assert.NotContains(t, buf.String(), "s3cr3t")
+
+	entry = post(`{"query":"mutation { createComment(postID: \"missing\", content: \"x\") { id } }"}`)
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Len(t, entry["errors"], 1)
+
+	entry = post(`{"query":"{ nope }"}`)
+	assert.Equal(t, "unknown", entry["type"])
+	assert.Len(t, entry["errors"], 1)
+}
+
+func TestRedact(t *testing.T) {
+	variables := map[string]any{
+		"input":    map[string]any{"title": "Hello", "apiKey": "k"},
+		"list":     []any{map[string]any{"password": "p"}},
+		"webhook":  "ok",
+		"X-Token":  "t",
+		"nothing":  nil,
+		"postID":   "1",
+		"contents": "text",
+	}
+	assert.Equal(t, map[string]any{
+		"input":    map[string]any{"title": "Hello", "apiKey": redacted},
+		"list":     []any{map[string]any{"password": redacted}},
+		"webhook":  "ok",
+		"X-Token":  redacted,
+		"nothing":  nil,
+		"postID":   "1",
+		"contents": "text",
+	}, Redact(variables))
+}
+
+func slogDiscard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
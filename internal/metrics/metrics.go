@@ -0,0 +1,223 @@
+// Package metrics collects Prometheus metrics of GraphQL operations, storage
+// calls and database connection pools and serves them on /metrics.
+package metrics
+
+import (
+	"ArticleForum/internal/storage/cache"
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const namespace = "articleforum"
+
+// maxOperationNames caps the distinct operation names used as label values.
+// Clients choose the names, so later ones are counted as otherOperation to
+// keep the number of series bounded.
+const maxOperationNames = 100
+
+const otherOperation = "other"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	operations        *prometheus.CounterVec
+	operationErrors   *prometheus.CounterVec
+	operationDuration *prometheus.HistogramVec
+	subscriptions     *prometheus.GaugeVec
+
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+
+	mu sync.Mutex
+	// names holds the operation names seen so far, up to maxOperationNames.
+	names map[string]bool
+}
+
+// New creates the metrics in a registry of their own, together with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		names:    make(map[string]bool),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "graphql_operations_total",
+			Help:      "GraphQL operations by operation name and type.",
+		}, []string{"operation", "type"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "graphql_operation_errors_total",
+			Help:      "GraphQL responses with errors by operation name and type.",
+		}, []string{"operation", "type"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "graphql_operation_duration_seconds",
+			Help:      "Duration of GraphQL queries and mutations by operation name.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "type"}),
+		subscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "graphql_active_subscriptions",
+			Help:      "Currently open GraphQL subscriptions by operation name.",
+		}, []string{"operation"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Duration of storage calls by backend and method.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage calls by backend and method.",
+		}, []string{"backend", "method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.operations, m.operationErrors, m.operationDuration, m.subscriptions,
+		m.storageDuration, m.storageErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Register adds further collectors, such as gauges of other components.
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	return m.registry.Register(collector)
+}
+
+// RegisterDBStats exports the connection pool statistics of the given
+// databases, labeled with their names.
+func (m *Metrics) RegisterDBStats(pools map[string]*sql.DB) error {
+	for name, db := range pools {
+		if err := m.registry.Register(collectors.NewDBStatsCollector(db, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterCache exports the hit, miss and invalidation counters and the size
+// of the storage cache.
+func (m *Metrics) RegisterCache(c *cache.Storage) error {
+	counter := func(name, help string, value func(cache.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help},
+			func() float64 { return float64(value(c.Stats())) })
+	}
+	for _, collector := range []prometheus.Collector{
+		counter("storage_cache_hits_total", "Reads served from the storage cache.", func(s cache.Stats) uint64 { return s.Hits }),
+		counter("storage_cache_misses_total", "Reads passed through the storage cache.", func(s cache.Stats) uint64 { return s.Misses }),
+		counter("storage_cache_invalidations_total", "Invalidations of the storage cache.", func(s cache.Stats) uint64 { return s.Invalidations }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "storage_cache_entries",
+			Help:      "Entries in the storage cache.",
+		}, func() float64 { return float64(c.Stats().Entries) }),
+	} {
+		if err := m.registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GraphQL returns a gqlgen extension that counts and times operations.
+func (m *Metrics) GraphQL() graphql.HandlerExtension {
+	return graphQLExtension{m}
+}
+
+type graphQLExtension struct {
+	metrics *Metrics
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = graphQLExtension{}
+
+func (graphQLExtension) ExtensionName() string {
+	return "Metrics"
+}
+
+func (graphQLExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e graphQLExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	name, kind := e.metrics.operationLabels(oc)
+	e.metrics.operations.WithLabelValues(name, kind).Inc()
+
+	responses := next(ctx)
+	if kind != string(ast.Subscription) {
+		return func(ctx context.Context) *graphql.Response {
+			response := responses(ctx)
+			e.metrics.operationDuration.WithLabelValues(name, kind).Observe(time.Since(oc.Stats.OperationStart).Seconds())
+			if response != nil && len(response.Errors) > 0 {
+				e.metrics.operationErrors.WithLabelValues(name, kind).Inc()
+			}
+			return response
+		}
+	}
+
+	// Подписка активна, пока обработчик не вернёт nil
+	active := e.metrics.subscriptions.WithLabelValues(name)
+	active.Inc()
+	done := false
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+		if response == nil {
+			if !done {
+				done = true
+				active.Dec()
+			}
+			return nil
+		}
+		if len(response.Errors) > 0 {
+			e.metrics.operationErrors.WithLabelValues(name, kind).Inc()
+		}
+		return response
+	}
+}
+
+// operationLabels returns the operation name and type of oc. Requests that
+// failed to parse have no operation. Operations without a name are labeled
+// "anonymous", and names beyond the first maxOperationNames "other".
+func (m *Metrics) operationLabels(oc *graphql.OperationContext) (string, string) {
+	name := oc.OperationName
+	kind := "unknown"
+	if oc.Operation != nil {
+		kind = string(oc.Operation.Operation)
+		if name == "" {
+			name = oc.Operation.Name
+		}
+	}
+	if name == "" {
+		return "anonymous", kind
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.names[name] {
+		if len(m.names) >= maxOperationNames {
+			return otherOperation, kind
+		}
+		m.names[name] = true
+	}
+	return name, kind
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"ArticleForum/internal/graph"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"ArticleForum/internal/storage/storagetest"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestInstrumentedStorageConformance(t *testing.T) {
+	m := New()
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return m.Storage(memory.NewMemoryStorage(), "memory")
+	})
+	assert.Positive(t, testutil.CollectAndCount(m.storageDuration))
+}
+
+func TestGraphQLMetrics(t *testing.T) {
+	m := New()
+	store := m.Storage(memory.NewMemoryStorage(), "memory")
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(m.GraphQL())
+
+	query := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	query(`{"query":"query ListPosts { posts { id } }"}`)
+	query(`{"query":"query ListPosts { posts { id } }"}`)
+	query(`{"query":"{ post(id: \"missing\") { id } }"}`)
+	query(`{"query":"mutation { createComment(postID: \"missing\", content: \"x\") { id } }"}`)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.operations.WithLabelValues("ListPosts", "query")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("anonymous", "query")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operationErrors.WithLabelValues("anonymous", "mutation")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.operationErrors.WithLabelValues("ListPosts", "query")))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `articleforum_graphql_operation_duration_seconds_count{operation="ListPosts",type="query"} 2`)
+	assert.Contains(t, rec.Body.String(), `articleforum_storage_operation_duration_seconds_count{backend="memory",method="GetAllPosts"} 2`)
+}
+
+func TestOperationNameLimit(t *testing.T) {
+	m := New()
+	label := func(name string) string {
+		name, _ = m.operationLabels(&graphql.OperationContext{
+			OperationName: name,
+			Operation:     &ast.OperationDefinition{Operation: ast.Query, Name: name},
+		})
+		return name
+	}
+
+	for i := 0; i < maxOperationNames; i++ {
+		assert.Equal(t, fmt.Sprintf("Query%d", i), label(fmt.Sprintf("Query%d", i)))
+	}
+	// Новые имена после предела не создают новых серий
+	assert.Equal(t, otherOperation, label("Unseen"))
+	assert.Equal(t, otherOperation, label("Unseen"))
+	assert.Equal(t, "Query0", label("Query0"), "names seen before keep their label")
+	assert.Equal(t, "anonymous", label(""))
+}
+
+func TestActiveSubscriptions(t *testing.T) {
+	m := New()
+	ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		Operation: &ast.OperationDefinition{Operation: ast.Subscription, Name: "OnComment"},
+	})
+
+	remaining := 2
+	responses := graphQLExtension{m}.InterceptOperation(ctx, func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			if remaining == 0 {
+				return nil
+			}
+			remaining--
+			return &graphql.Response{}
+		}
+	})
+
+	gauge := m.subscriptions.WithLabelValues("OnComment")
+	require.NotNil(t, responses(ctx))
+	assert.Equal(t, 1.0, testutil.ToFloat64(gauge))
+	require.NotNil(t, responses(ctx))
+	assert.Nil(t, responses(ctx))
+	assert.Nil(t, responses(ctx))
+	assert.Equal(t, 0.0, testutil.ToFloat64(gauge))
+}
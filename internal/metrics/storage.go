@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"time"
+)
+
+// instrumentedStorage records the latency and errors of every call to the
+// wrapped storage.
+type instrumentedStorage struct {
+	next    storage.Storage
+	metrics *Metrics
+	backend string
+}
+
+// Storage wraps s so that its calls are measured under the given backend
+// name.
+func (m *Metrics) Storage(s storage.Storage, backend string) storage.Storage {
+	return &instrumentedStorage{next: s, metrics: m, backend: backend}
+}
+
+func (s *instrumentedStorage) observe(method string, start time.Time, err *error) {
+	s.metrics.storageDuration.WithLabelValues(s.backend, method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		s.metrics.storageErrors.WithLabelValues(s.backend, method).Inc()
+	}
+}
+
+// Close closes the wrapped storage if it can be closed.
+func (s *instrumentedStorage) Close() error {
+	if closer, ok := s.next.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *instrumentedStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (result *domain.Post, err error) {
+	defer s.observe("CreatePost", time.Now(), &err)
+	return s.next.CreatePost(ctx, author, title, content, format, commentsEnabled)
+}
+
+func (s *instrumentedStorage) GetPost(ctx context.Context, id string) (result *domain.Post, err error) {
+	defer s.observe("GetPost", time.Now(), &err)
+	return s.next.GetPost(ctx, id)
+}
+
+func (s *instrumentedStorage) GetAllPosts(ctx context.Context) (result []*domain.Post, err error) {
+	defer s.observe("GetAllPosts", time.Now(), &err)
+	return s.next.GetAllPosts(ctx)
+}
+
+func (s *instrumentedStorage) GetPosts(ctx context.Context, limit, offset int) (result []*domain.Post, err error) {
+	defer s.observe("GetPosts", time.Now(), &err)
+	return s.next.GetPosts(ctx, limit, offset)
+}
+
+func (s *instrumentedStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (result *domain.Post, err error) {
+	defer s.observe("SetCommentsEnabled", time.Now(), &err)
+	return s.next.SetCommentsEnabled(ctx, postID, enabled)
+}
+
+func (s *instrumentedStorage) DeletePost(ctx context.Context, id string) (result bool, err error) {
+	defer s.observe("DeletePost", time.Now(), &err)
+	return s.next.DeletePost(ctx, id)
+}
+
+func (s *instrumentedStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (result *domain.Comment, err error) {
+	defer s.observe("CreateComment", time.Now(), &err)
+	return s.next.CreateComment(ctx, postID, parentID, author, content)
+}
+
+func (s *instrumentedStorage) GetComment(ctx context.Context, id string) (result *domain.Comment, err error) {
+	defer s.observe("GetComment", time.Now(), &err)
+	return s.next.GetComment(ctx, id)
+}
+
+func (s *instrumentedStorage) GetComments(ctx context.Context, postID string, limit, offset int) (result []*domain.Comment, err error) {
+	defer s.observe("GetComments", time.Now(), &err)
+	return s.next.GetComments(ctx, postID, limit, offset)
+}
+
+func (s *instrumentedStorage) UpdateComment(ctx context.Context, id, content string) (result *domain.Comment, err error) {
+	defer s.observe("UpdateComment", time.Now(), &err)
+	return s.next.UpdateComment(ctx, id, content)
+}
+
+func (s *instrumentedStorage) DeleteCommentThread(ctx context.Context, id string) (result int, err error) {
+	defer s.observe("DeleteCommentThread", time.Now(), &err)
+	return s.next.DeleteCommentThread(ctx, id)
+}
+
+func (s *instrumentedStorage) SetMentions(ctx context.Context, commentID string, usernames []string) (result []string, err error) {
+	defer s.observe("SetMentions", time.Now(), &err)
+	return s.next.SetMentions(ctx, commentID, usernames)
+}
+
+func (s *instrumentedStorage) EnsureUser(ctx context.Context, username string) (result *domain.User, err error) {
+	defer s.observe("EnsureUser", time.Now(), &err)
+	return s.next.EnsureUser(ctx, username)
+}
+
+func (s *instrumentedStorage) GetUsers(ctx context.Context, usernames []string) (result []*domain.User, err error) {
+	defer s.observe("GetUsers", time.Now(), &err)
+	return s.next.GetUsers(ctx, usernames)
+}
+
+func (s *instrumentedStorage) ListUsers(ctx context.Context) (result []*domain.User, err error) {
+	defer s.observe("ListUsers", time.Now(), &err)
+	return s.next.ListUsers(ctx)
+}
+
+func (s *instrumentedStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (result *domain.Notification, err error) {
+	defer s.observe("CreateNotification", time.Now(), &err)
+	return s.next.CreateNotification(ctx, notification)
+}
+
+func (s *instrumentedStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) (result []*domain.Notification, err error) {
+	defer s.observe("GetNotifications", time.Now(), &err)
+	return s.next.GetNotifications(ctx, recipient, unreadOnly, limit, after)
+}
+
+func (s *instrumentedStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) (result []string, err error) {
+	defer s.observe("GetNotifiedUsers", time.Now(), &err)
+	return s.next.GetNotifiedUsers(ctx, commentID, usernames)
+}
+
+func (s *instrumentedStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (result int, err error) {
+	defer s.observe("MarkNotificationsRead", time.Now(), &err)
+	return s.next.MarkNotificationsRead(ctx, recipient, ids)
+}
+
+func (s *instrumentedStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (result *domain.Webhook, err error) {
+	defer s.observe("CreateWebhook", time.Now(), &err)
+	return s.next.CreateWebhook(ctx, url, secret, eventTypes)
+}
+
+func (s *instrumentedStorage) GetWebhooks(ctx context.Context) (result []*domain.Webhook, err error) {
+	defer s.observe("GetWebhooks", time.Now(), &err)
+	return s.next.GetWebhooks(ctx)
+}
+
+func (s *instrumentedStorage) DeleteWebhook(ctx context.Context, id string) (result bool, err error) {
+	defer s.observe("DeleteWebhook", time.Now(), &err)
+	return s.next.DeleteWebhook(ctx, id)
+}
+
+func (s *instrumentedStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (result *domain.WebhookDelivery, err error) {
+	defer s.observe("CreateWebhookDelivery", time.Now(), &err)
+	return s.next.CreateWebhookDelivery(ctx, delivery)
+}
+
+func (s *instrumentedStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) (result []*domain.WebhookDelivery, err error) {
+	defer s.observe("GetWebhookDeliveries", time.Now(), &err)
+	return s.next.GetWebhookDeliveries(ctx, webhookID, limit, offset)
+}
+
+func (s *instrumentedStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) (err error) {
+	defer s.observe("EnqueueDeliveries", time.Now(), &err)
+	return s.next.EnqueueDeliveries(ctx, event, webhookIDs)
+}
+
+func (s *instrumentedStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (result []*domain.QueuedDelivery, err error) {
+	defer s.observe("ClaimDeliveries", time.Now(), &err)
+	return s.next.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (s *instrumentedStorage) RetryDelivery(ctx context.Context, id string, at time.Time) (err error) {
+	defer s.observe("RetryDelivery", time.Now(), &err)
+	return s.next.RetryDelivery(ctx, id, at)
+}
+
+func (s *instrumentedStorage) RemoveDelivery(ctx context.Context, id string) (err error) {
+	defer s.observe("RemoveDelivery", time.Now(), &err)
+	return s.next.RemoveDelivery(ctx, id)
+}
+
+func (s *instrumentedStorage) GetQueuedDeliveries(ctx context.Context, limit int) (result []*domain.QueuedDelivery, err error) {
+	defer s.observe("GetQueuedDeliveries", time.Now(), &err)
+	return s.next.GetQueuedDeliveries(ctx, limit)
+}
+
+func (s *instrumentedStorage) GetPendingEvents(ctx context.Context, limit int) (result []*domain.Event, err error) {
+	defer s.observe("GetPendingEvents", time.Now(), &err)
+	return s.next.GetPendingEvents(ctx, limit)
+}
+
+func (s *instrumentedStorage) AckEvents(ctx context.Context, ids []string) (err error) {
+	defer s.observe("AckEvents", time.Now(), &err)
+	return s.next.AckEvents(ctx, ids)
+}
+
+func (s *instrumentedStorage) RestoreUser(ctx context.Context, user *domain.User) (err error) {
+	defer s.observe("RestoreUser", time.Now(), &err)
+	return s.next.RestoreUser(ctx, user)
+}
+
+func (s *instrumentedStorage) RestorePost(ctx context.Context, post *domain.Post) (err error) {
+	defer s.observe("RestorePost", time.Now(), &err)
+	return s.next.RestorePost(ctx, post)
+}
+
+func (s *instrumentedStorage) RestoreComment(ctx context.Context, comment *domain.Comment) (err error) {
+	defer s.observe("RestoreComment", time.Now(), &err)
+	return s.next.RestoreComment(ctx, comment)
+}
+
+func (s *instrumentedStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) (err error) {
+	defer s.observe("RestoreNotification", time.Now(), &err)
+	return s.next.RestoreNotification(ctx, notification)
+}
+
+func (s *instrumentedStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) (err error) {
+	defer s.observe("RestoreWebhook", time.Now(), &err)
+	return s.next.RestoreWebhook(ctx, webhook)
+}
+
+func (s *instrumentedStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (err error) {
+	defer s.observe("RestoreWebhookDelivery", time.Now(), &err)
+	return s.next.RestoreWebhookDelivery(ctx, delivery)
+}
+
+func (s *instrumentedStorage) RestoreEvent(ctx context.Context, event *domain.Event) (err error) {
+	defer s.observe("RestoreEvent", time.Now(), &err)
+	return s.next.RestoreEvent(ctx, event)
+}
+
+func (s *instrumentedStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) (err error) {
+	defer s.observe("RestoreQueuedDelivery", time.Now(), &err)
+	return s.next.RestoreQueuedDelivery(ctx, delivery)
+}
+
+func (s *instrumentedStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) (err error) {
+	defer s.observe("WithinTx", time.Now(), &err)
+	return s.next.WithinTx(ctx, func(tx storage.Storage) error {
+		return fn(&instrumentedStorage{next: tx, metrics: s.metrics, backend: s.backend})
+	})
+}
+
+func (s *instrumentedStorage) HealthCheck(ctx context.Context) (err error) {
+	defer s.observe("HealthCheck", time.Now(), &err)
+	return s.next.HealthCheck(ctx)
+}
+
+var _ storage.Storage = (*instrumentedStorage)(nil)
@@ -0,0 +1,118 @@
+package notification
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/pubsub"
+	"ArticleForum/internal/storage"
+	"context"
+)
+
+// Notifier stores notifications for users affected by new comments and
+// pushes them to the recipients' live subscriptions.
+type Notifier struct {
+	storage storage.Storage
+	broker  *pubsub.Broker[*domain.Notification]
+}
+
+func NewNotifier(storage storage.Storage) *Notifier {
+	return &Notifier{
+		storage: storage,
+		broker:  pubsub.NewBroker[*domain.Notification](),
+	}
+}
+
+// CommentCreated notifies the author of the parent comment about a reply,
+// the mentioned users about the mention and the author of the post about a
+// new comment. Nobody is notified about their own comment, and a user is
+// notified at most once per comment.
+func (n *Notifier) CommentCreated(ctx context.Context, comment *domain.Comment, mentioned []string) error {
+	notified := map[string]bool{comment.Author: true, "": true}
+
+	if comment.ParentID != nil {
+		parent, err := n.storage.GetComment(ctx, *comment.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent != nil && !notified[parent.Author] {
+			if err := n.notify(ctx, parent.Author, domain.NotificationTypeCommentReply, comment); err != nil {
+				return err
+			}
+			notified[parent.Author] = true
+		}
+	}
+
+	if err := n.notifyMentioned(ctx, comment, mentioned, notified); err != nil {
+		return err
+	}
+
+	post, err := n.storage.GetPost(ctx, comment.PostID)
+	if err != nil {
+		return err
+	}
+	if post != nil && !notified[post.Author] {
+		if err := n.notify(ctx, post.Author, domain.NotificationTypePostComment, comment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CommentEdited notifies the users mentioned in an edited comment who have
+// not been notified about it yet, so a user removed from the comment and
+// mentioned again is not notified twice.
+func (n *Notifier) CommentEdited(ctx context.Context, comment *domain.Comment, mentioned []string) error {
+	if len(mentioned) == 0 {
+		return nil
+	}
+	notified := map[string]bool{comment.Author: true, "": true}
+	previous, err := n.storage.GetNotifiedUsers(ctx, comment.ID, mentioned)
+	if err != nil {
+		return err
+	}
+	for _, username := range previous {
+		notified[username] = true
+	}
+	return n.notifyMentioned(ctx, comment, mentioned, notified)
+}
+
+// Subscribe streams notifications created for recipient until ctx is done or
+// the notifier is closed.
+func (n *Notifier) Subscribe(ctx context.Context, recipient string) <-chan *domain.Notification {
+	return n.broker.Subscribe(ctx, recipient)
+}
+
+// Close ends all live subscriptions. Notifications are still stored after
+// Close, but no longer pushed.
+func (n *Notifier) Close() {
+	n.broker.Close()
+}
+
+func (n *Notifier) notifyMentioned(ctx context.Context, comment *domain.Comment, mentioned []string, notified map[string]bool) error {
+	for _, username := range mentioned {
+		if notified[username] {
+			continue
+		}
+		if err := n.notify(ctx, username, domain.NotificationTypeMention, comment); err != nil {
+			return err
+		}
+		notified[username] = true
+	}
+	return nil
+}
+
+func (n *Notifier) notify(ctx context.Context, recipient string, kind domain.NotificationType, comment *domain.Comment) error {
+	notification, err := n.storage.CreateNotification(ctx, &domain.Notification{
+		Recipient: recipient,
+		Type:      kind,
+		PostID:    comment.PostID,
+		CommentID: comment.ID,
+		Actor:     comment.Author,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.broker.Publish(recipient, notification)
+	return nil
+}
@@ -0,0 +1,111 @@
+package notification
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage/memory"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+	notifier := NewNotifier(store)
+
+	post, err := store.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	t.Run("Post author is notified about comments", func(t *testing.T) {
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		live := notifier.Subscribe(subCtx, "alice")
+
+		comment, err := store.CreateComment(ctx, post.ID, nil, "bob", "Hello")
+		require.NoError(t, err)
+		require.NoError(t, notifier.CommentCreated(ctx, comment, nil))
+
+		notifications, err := store.GetNotifications(ctx, "alice", true, 10, "")
+		require.NoError(t, err)
+		require.Len(t, notifications, 1)
+		assert.Equal(t, domain.NotificationTypePostComment, notifications[0].Type)
+		assert.Equal(t, comment.ID, notifications[0].CommentID)
+		assert.Equal(t, "bob", notifications[0].Actor)
+
+		select {
+		case n := <-live:
+			assert.Equal(t, notifications[0].ID, n.ID)
+		case <-time.After(time.Second):
+			t.Fatal("notification was not published")
+		}
+	})
+
+	t.Run("Reply notifies parent author once and skips self", func(t *testing.T) {
+		parent, err := store.CreateComment(ctx, post.ID, nil, "alice", "Own comment")
+		require.NoError(t, err)
+		require.NoError(t, notifier.CommentCreated(ctx, parent, nil))
+
+		reply, err := store.CreateComment(ctx, post.ID, &parent.ID, "carol", "Reply to @alice")
+		require.NoError(t, err)
+		require.NoError(t, notifier.CommentCreated(ctx, reply, []string{"alice"}))
+
+		notifications, err := store.GetNotifications(ctx, "alice", false, 10, "")
+		require.NoError(t, err)
+		require.Len(t, notifications, 2)
+		assert.Equal(t, domain.NotificationTypeCommentReply, notifications[0].Type)
+		assert.Equal(t, reply.ID, notifications[0].CommentID)
+	})
+
+	t.Run("Mentioned users are notified", func(t *testing.T) {
+		other, err := store.CreatePost(ctx, "", "Anonymous", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+
+		comment, err := store.CreateComment(ctx, other.ID, nil, "bob", "Hi @dave and @bob")
+		require.NoError(t, err)
+		require.NoError(t, notifier.CommentCreated(ctx, comment, []string{"dave", "bob"}))
+
+		edited, err := store.UpdateComment(ctx, comment.ID, "Hi @dave, @erin")
+		require.NoError(t, err)
+		require.NoError(t, notifier.CommentEdited(ctx, edited, []string{"erin"}))
+		// dave уже получил уведомление об этом комментарии
+		require.NoError(t, notifier.CommentEdited(ctx, edited, []string{"dave", "erin"}))
+
+		for _, username := range []string{"dave", "erin"} {
+			notifications, err := store.GetNotifications(ctx, username, false, 10, "")
+			require.NoError(t, err)
+			require.Len(t, notifications, 1, username)
+			assert.Equal(t, domain.NotificationTypeMention, notifications[0].Type)
+		}
+
+		own, err := store.GetNotifications(ctx, "bob", false, 10, "")
+		require.NoError(t, err)
+		assert.Empty(t, own)
+	})
+
+	t.Run("Pagination and marking read", func(t *testing.T) {
+		first, err := store.GetNotifications(ctx, "alice", false, 1, "")
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+
+		rest, err := store.GetNotifications(ctx, "alice", false, 10, first[0].ID)
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.NotEqual(t, first[0].ID, rest[0].ID)
+
+		marked, err := store.MarkNotificationsRead(ctx, "alice", []string{first[0].ID})
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+
+		unread, err := store.GetNotifications(ctx, "alice", true, 10, "")
+		require.NoError(t, err)
+		require.Len(t, unread, 1)
+		assert.Equal(t, rest[0].ID, unread[0].ID)
+
+		marked, err = store.MarkNotificationsRead(ctx, "alice", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+	})
+}
@@ -0,0 +1,181 @@
+package outbox
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultBatchSize    = 100
+)
+
+// Handler receives events from the outbox. It may see an event more than once
+// and must be idempotent or tolerate duplicates.
+type Handler func(ctx context.Context, event *domain.Event) error
+
+// Lock makes the caller the only relay of a database shared by several
+// server instances until release is called. ok is false when another relay
+// holds the lock.
+type Lock func(ctx context.Context) (release func(), ok bool, err error)
+
+// Relay moves events from the storage outbox to the registered handlers. Events
+// are handed over strictly in the order they were written, and an event is
+// acknowledged only after every handler has returned for it: when a handler
+// fails, the relay stops and retries from the failed event on the next poll,
+// so every event is delivered at least once. A slow handler therefore delays
+// the events after it. Only one relay may read an outbox at a time to keep
+// that ordering; when the storage is shared, set a Lock with SetLock.
+type Relay struct {
+	storage      storage.Storage
+	handlers     []Handler
+	pollInterval time.Duration
+	batchSize    int
+	lock         Lock
+
+	mu      sync.Mutex
+	running bool
+	// polled is when the outbox was last read successfully.
+	polled time.Time
+	// busy is set while the handlers process an event.
+	busy bool
+}
+
+func NewRelay(storage storage.Storage, pollInterval time.Duration, handlers ...Handler) *Relay {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	return &Relay{
+		storage:      storage,
+		handlers:     handlers,
+		pollInterval: pollInterval,
+		batchSize:    DefaultBatchSize,
+	}
+}
+
+// SetLock makes every Flush take lock first. While another relay holds it,
+// Flush dispatches nothing.
+func (r *Relay) SetLock(lock Lock) {
+	r.lock = lock
+}
+
+// Run polls the outbox until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	r.setRunning(true)
+	defer r.setRunning(false)
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush dispatches pending events until the outbox is empty or a handler
+// fails, and returns the number of events dispatched.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	if r.lock != nil {
+		release, ok, err := r.lock(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to lock the outbox: %w", err)
+		}
+		if !ok {
+			// Outbox читает relay другого экземпляра, этот остаётся в резерве
+			r.markPolled()
+			return 0, nil
+		}
+		defer release()
+	}
+
+	dispatched := 0
+	for {
+		events, err := r.storage.GetPendingEvents(ctx, r.batchSize)
+		if err != nil {
+			return dispatched, err
+		}
+		r.markPolled()
+		if len(events) == 0 {
+			return dispatched, nil
+		}
+
+		for _, event := range events {
+			if err := r.dispatch(ctx, event); err != nil {
+				return dispatched, err
+			}
+			// Подтверждаем каждое событие отдельно, чтобы после сбоя
+			// повторно отправлялось только неподтверждённое
+			if err := r.storage.AckEvents(ctx, []string{event.ID}); err != nil {
+				return dispatched, err
+			}
+			dispatched++
+		}
+	}
+}
+
+// HealthCheck reports an error when Run is not running or has not read the
+// outbox for ten poll intervals, so events would not reach subscribers.
+// Failing handlers do not make the relay unhealthy: their events are retried.
+// Neither do slow ones: the relay is healthy while a handler runs.
+func (r *Relay) HealthCheck(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		return errors.New("relay is not running")
+	}
+	if r.busy {
+		return nil
+	}
+	if r.polled.IsZero() {
+		return errors.New("relay has not read the outbox yet")
+	}
+	if since := time.Since(r.polled); since > 10*r.pollInterval {
+		return fmt.Errorf("relay has not read the outbox for %s", since.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (r *Relay) setRunning(running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = running
+}
+
+func (r *Relay) markPolled() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.polled = time.Now()
+}
+
+func (r *Relay) setBusy(busy bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.busy = busy
+}
+
+func (r *Relay) dispatch(ctx context.Context, event *domain.Event) error {
+	r.setBusy(true)
+	defer r.setBusy(false)
+
+	for _, handler := range r.handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage/memory"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	post, err := store.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	comment, err := store.CreateComment(ctx, post.ID, nil, "bob", "First")
+	require.NoError(t, err)
+	_, err = store.UpdateComment(ctx, comment.ID, "Edited")
+	require.NoError(t, err)
+
+	var seen []domain.EventType
+	failures := 1
+	relay := NewRelay(store, 0, func(ctx context.Context, event *domain.Event) error {
+		// Второе событие один раз завершается ошибкой
+		if event.Type == domain.EventCommentCreated && failures > 0 {
+			failures--
+			return errors.New("receiver unavailable")
+		}
+		seen = append(seen, event.Type)
+		return nil
+	})
+
+	dispatched, err := relay.Flush(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 1, dispatched)
+
+	pending, err := store.GetPendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, domain.EventCommentCreated, pending[0].Type)
+
+	dispatched, err = relay.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, dispatched)
+	assert.Equal(t, []domain.EventType{domain.EventPostCreated, domain.EventCommentCreated, domain.EventCommentUpdated}, seen)
+
+	pending, err = store.GetPendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestRelayHealthCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := NewRelay(memory.NewMemoryStorage(), 10*time.Millisecond)
+	assert.Error(t, relay.HealthCheck(ctx), "not running yet")
+
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return relay.HealthCheck(ctx) == nil }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Error(t, relay.HealthCheck(context.Background()), "stopped")
+}
+
+func TestRelayHealthCheckSlowHandler(t *testing.T) {
+	store := memory.NewMemoryStorage()
+	_, err := store.CreatePost(context.Background(), "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	relay := NewRelay(store, time.Millisecond, func(ctx context.Context, event *domain.Event) error {
+		close(started)
+		<-release
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	<-started
+
+	// Обработчик дольше десяти интервалов опроса не делает relay неготовым
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, relay.HealthCheck(ctx))
+
+	close(release)
+	cancel()
+	<-done
+}
+
+func TestRelayLock(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+	_, err := store.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	var seen int
+	relay := NewRelay(store, 0, func(ctx context.Context, event *domain.Event) error {
+		seen++
+		return nil
+	})
+	held, released := true, 0
+	relay.SetLock(func(ctx context.Context) (func(), bool, error) {
+		if held {
+			return nil, false, nil
+		}
+		return func() { released++ }, true, nil
+	})
+
+	// Пока outbox читает другой relay, события не отправляются
+	dispatched, err := relay.Flush(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, dispatched)
+	assert.Zero(t, seen)
+
+	held = false
+	dispatched, err = relay.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, dispatched)
+	assert.Equal(t, 1, released)
+}
+
+func TestRelayStopKeepsUndeliveredEvents(t *testing.T) {
+	store := memory.NewMemoryStorage()
+	_, err := store.CreatePost(context.Background(), "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	// Обработчик ждёт повтора доставки, пока relay не остановят
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	relay := NewRelay(store, time.Hour, func(ctx context.Context, event *domain.Event) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	pending, err := store.GetPendingEvents(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "the event is delivered again after a restart")
+
+	var delivered []string
+	restarted := NewRelay(store, 0, func(ctx context.Context, event *domain.Event) error {
+		delivered = append(delivered, event.ID)
+		return nil
+	})
+	_, err = restarted.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{pending[0].ID}, delivered)
+}
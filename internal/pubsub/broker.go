@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriberBuffer is how many undelivered messages a slow subscriber may
+// accumulate before new messages to it are dropped.
+const subscriberBuffer = 16
+
+// Broker fans messages published to a topic out to every subscriber of that
+// topic within the process.
+type Broker[T any] struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan T]struct{}
+	closed      bool
+}
+
+func NewBroker[T any]() *Broker[T] {
+	return &Broker[T]{
+		subscribers: make(map[string]map[chan T]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving messages published to topic. The
+// channel is closed and the subscription removed once ctx is done or the
+// broker is closed.
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string) <-chan T {
+	ch := make(chan T, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch
+	}
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan T]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// После Close канал уже закрыт
+		if _, ok := b.subscribers[topic][ch]; !ok {
+			return
+		}
+		delete(b.subscribers[topic], ch)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Publish delivers msg to the current subscribers of topic without blocking;
+// subscribers whose buffer is full miss the message.
+func (b *Broker[T]) Publish(topic string, msg T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Close ends all subscriptions by closing their channels. Later subscriptions
+// receive a closed channel and later messages are dropped.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+	}
+	b.subscribers = make(map[string]map[chan T]struct{})
+	b.closed = true
+}
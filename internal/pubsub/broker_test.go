@@ -0,0 +1,29 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewBroker[string]()
+	ch := broker.Subscribe(ctx, "post")
+	broker.Publish("post", "first")
+	broker.Close()
+
+	assert.Equal(t, "first", <-ch, "buffered messages are still delivered")
+	_, ok := <-ch
+	assert.False(t, ok, "the subscription is closed")
+
+	_, ok = <-broker.Subscribe(ctx, "post")
+	assert.False(t, ok, "subscriptions after Close are closed at once")
+
+	// Отмена контекста после Close не должна повторно закрывать канал
+	cancel()
+	broker.Publish("post", "second")
+}
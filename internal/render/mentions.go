@@ -0,0 +1,49 @@
+package render
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MentionURLPrefix is prepended to the username in links to mentioned users.
+const MentionURLPrefix = "/users/"
+
+// mentionPattern matches @username tokens that are not part of a longer word,
+// so e-mail addresses are not treated as mentions.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([A-Za-z0-9_][A-Za-z0-9_-]*)`)
+
+// ParseMentions returns the distinct usernames mentioned in content in order
+// of first appearance.
+func ParseMentions(content string) []string {
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(usernames, match[2]) {
+			usernames = append(usernames, match[2])
+		}
+	}
+	return usernames
+}
+
+// RenderComment renders plain comment text as HTML, turning mentions of the
+// given users into links. Mentions of unknown users are left as plain text.
+func (r *Renderer) RenderComment(content string, mentions []string) (string, error) {
+	key := cacheKey("comment:"+strings.Join(mentions, ","), content)
+	if cached, ok := r.cache.Get(key); ok {
+		return cached, nil
+	}
+
+	out := renderPlain(content)
+	if len(mentions) > 0 {
+		out = mentionPattern.ReplaceAllStringFunc(out, func(token string) string {
+			match := mentionPattern.FindStringSubmatch(token)
+			if !slices.Contains(mentions, match[2]) {
+				return token
+			}
+			return match[1] + `<a href="` + MentionURLPrefix + match[2] + `" class="mention">@` + match[2] + `</a>`
+		})
+	}
+
+	r.cache.Add(key, out)
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"ArticleForum/internal/domain"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// DefaultCacheSize is the number of rendered documents kept in memory.
+const DefaultCacheSize = 1024
+
+// Renderer converts post content to sanitized HTML and caches the result
+// by content hash, so edited content is rendered again automatically.
+type Renderer struct {
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+	cache    *lru.Cache[string, string]
+}
+
+func NewRenderer(cacheSize int) *Renderer {
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	cache, _ := lru.New[string, string](cacheSize)
+
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoFollowOnLinks(true)
+	policy.RequireNoReferrerOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return &Renderer{
+		markdown: goldmark.New(goldmark.WithExtensions(extension.GFM)),
+		policy:   policy,
+		cache:    cache,
+	}
+}
+
+func (r *Renderer) Render(format domain.ContentFormat, content string) (string, error) {
+	key := cacheKey(string(format), content)
+	if cached, ok := r.cache.Get(key); ok {
+		return cached, nil
+	}
+
+	var out string
+	switch format {
+	case domain.ContentFormatMarkdown:
+		var buf bytes.Buffer
+		if err := r.markdown.Convert([]byte(content), &buf); err != nil {
+			return "", err
+		}
+		out = r.policy.Sanitize(buf.String())
+	default:
+		out = renderPlain(content)
+	}
+
+	r.cache.Add(key, out)
+	return out, nil
+}
+
+// renderPlain escapes the text and keeps its paragraph and line breaks.
+func renderPlain(content string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+func cacheKey(kind, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
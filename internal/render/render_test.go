@@ -0,0 +1,47 @@
+package render
+
+import (
+	"ArticleForum/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderer(t *testing.T) {
+	renderer := NewRenderer(16)
+
+	t.Run("Markdown is sanitized", func(t *testing.T) {
+		out, err := renderer.Render(domain.ContentFormatMarkdown, "**bold** <script>alert(1)</script> <a href=\"javascript:alert(1)\">x</a> [site](https://example.com)")
+		require.NoError(t, err)
+		assert.Contains(t, out, "<strong>bold</strong>")
+		assert.NotContains(t, out, "<script>")
+		assert.NotContains(t, out, "javascript:")
+		assert.Contains(t, out, `href="https://example.com"`)
+		assert.Contains(t, out, `rel="nofollow noreferrer noopener"`)
+	})
+
+	t.Run("Plain text is escaped", func(t *testing.T) {
+		out, err := renderer.Render(domain.ContentFormatPlain, "a <b>\nline\n\nnext")
+		require.NoError(t, err)
+		assert.Equal(t, "<p>a &lt;b&gt;<br>\nline</p>\n<p>next</p>\n", out)
+	})
+
+	t.Run("Output is cached by content", func(t *testing.T) {
+		_, err := renderer.Render(domain.ContentFormatMarkdown, "cached")
+		require.NoError(t, err)
+		assert.True(t, renderer.cache.Contains(cacheKey(string(domain.ContentFormatMarkdown), "cached")))
+		assert.False(t, renderer.cache.Contains(cacheKey(string(domain.ContentFormatPlain), "cached")))
+	})
+
+	t.Run("Mentions of known users become links", func(t *testing.T) {
+		out, err := renderer.RenderComment("hi @alice and @ghost, mail me@example.com", []string{"alice"})
+		require.NoError(t, err)
+		assert.Equal(t, `<p>hi <a href="/users/alice" class="mention">@alice</a> and @ghost, mail me@example.com</p>`+"\n", out)
+	})
+}
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob_2"}, ParseMentions("@alice, ping @bob_2 and @alice again; not a@mail.com"))
+	assert.Nil(t, ParseMentions("no mentions here"))
+}
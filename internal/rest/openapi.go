@@ -0,0 +1,267 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// route describes an endpoint for both serving and documenting it.
+type route struct {
+	method string
+	// pattern is the path below Prefix in http.ServeMux syntax, which
+	// matches the OpenAPI path template syntax.
+	pattern     string
+	operationID string
+	summary     string
+	// params are the path and query parameters.
+	params []param
+	// request is the zero value of the request body type, nil without a
+	// body.
+	request any
+	// response is the zero value of the type of the response data; list
+	// responses return a page of them.
+	response any
+	list     bool
+	status   int
+	// errors are the statuses of expected failures, besides the internal
+	// error every endpoint may return.
+	errors []int
+	handle func(w http.ResponseWriter, r *http.Request) error
+}
+
+type param struct {
+	name        string
+	in          string // query, when empty
+	description string
+	schema      schema
+}
+
+type schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Minimum     *int               `json:"minimum,omitempty"`
+	Maximum     *int               `json:"maximum,omitempty"`
+	Default     any                `json:"default,omitempty"`
+	Items       *schema            `json:"items,omitempty"`
+	Properties  map[string]*schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+func ptr[T any](v T) *T { return &v }
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type header struct {
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Headers     map[string]header    `json:"headers,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type document struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// OpenAPI returns the OpenAPI 3.0 document of the API, generated from the
+// route table and the Go types of the request and response bodies.
+func (h *Handler) OpenAPI() ([]byte, error) {
+	doc := document{OpenAPI: "3.0.3", Paths: map[string]map[string]*operation{}}
+	doc.Info.Title = "ArticleForum REST API"
+	doc.Info.Version = "1"
+	doc.Info.Description = "Posts and comments of the forum. The caller is identified by the X-User header set by the authenticating proxy; requests without it are anonymous."
+	doc.Servers = []struct {
+		URL string `json:"url"`
+	}{{URL: Prefix}}
+	g := &generator{schemas: map[string]*schema{}}
+
+	errorBody := g.schemaOf(reflect.TypeFor[errorResponse]())
+	failure := func(status int) response {
+		return response{
+			Description: http.StatusText(status),
+			Content:     map[string]mediaType{"application/json": {Schema: errorBody}},
+		}
+	}
+
+	for _, rt := range h.routes() {
+		op := &operation{OperationID: rt.operationID, Summary: rt.summary, Responses: map[string]response{}}
+		for _, p := range rt.params {
+			in := p.in
+			if in == "" {
+				in = "query"
+			}
+			op.Parameters = append(op.Parameters, parameter{
+				Name:        p.name,
+				In:          in,
+				Description: p.description,
+				Required:    in == "path",
+				Schema:      ptr(p.schema),
+			})
+		}
+		if rt.request != nil {
+			op.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]mediaType{"application/json": {Schema: g.schemaOf(reflect.TypeOf(rt.request))}},
+			}
+		}
+
+		data := g.schemaOf(reflect.TypeOf(rt.response))
+		body := &schema{Type: "object", Properties: map[string]*schema{"data": data}, Required: []string{"data"}}
+		ok := response{Description: http.StatusText(rt.status)}
+		if rt.list {
+			body.Properties["data"] = &schema{Type: "array", Items: data}
+			body.Properties["links"] = g.schemaOf(reflect.TypeFor[Links]())
+			body.Required = append(body.Required, "links")
+			ok.Headers = map[string]header{"Link": {Description: `Links to the next and previous pages with rel="next" and rel="prev"`, Schema: &schema{Type: "string"}}}
+		}
+		if rt.status == http.StatusCreated {
+			ok.Headers = map[string]header{"Location": {Description: "URL of the created resource, if it can be fetched", Schema: &schema{Type: "string"}}}
+		}
+		ok.Content = map[string]mediaType{"application/json": {Schema: body}}
+		op.Responses[strconv.Itoa(rt.status)] = ok
+
+		for _, status := range append(rt.errors, http.StatusInternalServerError) {
+			op.Responses[strconv.Itoa(status)] = failure(status)
+		}
+
+		if doc.Paths[rt.pattern] == nil {
+			doc.Paths[rt.pattern] = map[string]*operation{}
+		}
+		doc.Paths[rt.pattern][strings.ToLower(rt.method)] = op
+	}
+	doc.Components.Schemas = g.schemas
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func (h *Handler) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.OpenAPI()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+// generator builds schemas from Go types by their JSON encoding. Named
+// structs become components referenced by name. Fields tagged with
+// omitempty are optional, pointers without it are nullable, and the doc and
+// enum tags give the description and the allowed values.
+type generator struct {
+	schemas map[string]*schema
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func (g *generator) schemaOf(t reflect.Type) *schema {
+	if t == timeType {
+		return &schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Slice:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		name := componentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			s := &schema{Type: "object", Properties: map[string]*schema{}}
+			// Компонент регистрируется до обхода полей на случай рекурсивных типов
+			g.schemas[name] = s
+			g.addFields(s, t)
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	default:
+		panic("rest: no schema for " + t.String())
+	}
+}
+
+func (g *generator) addFields(s *schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaOf(field.Type)
+		if property.Ref == "" {
+			property.Description = field.Tag.Get("doc")
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property.Enum = strings.Split(enum, ",")
+			}
+		}
+		optional := strings.Contains(options, "omitempty")
+		if field.Type.Kind() == reflect.Pointer && !optional && property.Ref == "" {
+			property.Nullable = true
+		}
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = property
+	}
+}
+
+// componentName names the schema of t, exported or not, like an exported
+// type.
+func componentName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI(t *testing.T) {
+	_, handler := newTestHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc document
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	post := doc.Components.Schemas["Post"]
+	require.NotNil(t, post)
+	assert.Contains(t, post.Required, "author")
+	assert.True(t, post.Properties["author"].Nullable)
+	assert.Equal(t, "date-time", post.Properties["createdAt"].Format)
+	assert.Equal(t, []string{"plain", "markdown"}, post.Properties["contentFormat"].Enum)
+
+	request := doc.Components.Schemas["CreatePostRequest"]
+	require.NotNil(t, request)
+	assert.ElementsMatch(t, []string{"title", "content"}, request.Required, "omitempty fields are optional")
+
+	list := doc.Paths["/posts"]["get"]
+	require.NotNil(t, list)
+	assert.Equal(t, "#/components/schemas/Links", list.Responses["200"].Content["application/json"].Schema.Properties["links"].Ref)
+	assert.Equal(t, "#/components/schemas/ErrorResponse", list.Responses["400"].Content["application/json"].Schema.Ref)
+}
+
+// Документ описывает каждый маршрут, и каждый параметр пути описан
+func TestOpenAPICoversRoutes(t *testing.T) {
+	store, _ := newTestHandler()
+	h := NewHandler(store, nil)
+	data, err := h.OpenAPI()
+	require.NoError(t, err)
+	var doc document
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	pathParam := regexp.MustCompile(`\{(\w+)\}`)
+	for _, rt := range h.routes() {
+		op := doc.Paths[rt.pattern][strings.ToLower(rt.method)]
+		require.NotNil(t, op, "%s %s", rt.method, rt.pattern)
+		assert.Contains(t, op.Responses, strconv.Itoa(rt.status))
+
+		for _, match := range pathParam.FindAllStringSubmatch(rt.pattern, -1) {
+			assert.True(t, slices.ContainsFunc(op.Parameters, func(p parameter) bool {
+				return p.Name == match[1] && p.In == "path" && p.Required
+			}), "%s %s: parameter %s", rt.method, rt.pattern, match[1])
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package rest
+
+import (
+	"ArticleForum/internal/domain"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Post is a post as returned by the API.
+type Post struct {
+	ID              string    `json:"id"`
+	Author          *string   `json:"author" doc:"Username of the author, null for anonymous posts"`
+	Title           string    `json:"title"`
+	Content         string    `json:"content"`
+	ContentFormat   string    `json:"contentFormat" enum:"plain,markdown"`
+	CommentsEnabled bool      `json:"commentsEnabled"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// Comment is a comment as returned by the API.
+type Comment struct {
+	ID        string    `json:"id"`
+	PostID    string    `json:"postID"`
+	ParentID  *string   `json:"parentID" doc:"The comment this one replies to, null for top-level comments"`
+	Author    *string   `json:"author" doc:"Username of the author, null for anonymous comments"`
+	Content   string    `json:"content"`
+	Mentions  []string  `json:"mentions" doc:"Users mentioned with @username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CreatePostRequest struct {
+	Title           string `json:"title"`
+	Content         string `json:"content"`
+	ContentFormat   string `json:"contentFormat,omitempty" enum:"plain,markdown" doc:"Defaults to plain"`
+	CommentsEnabled *bool  `json:"commentsEnabled,omitempty" doc:"Defaults to true"`
+}
+
+type CreateCommentRequest struct {
+	Content  string  `json:"content"`
+	ParentID *string `json:"parentID,omitempty" doc:"The comment of the same post to reply to"`
+}
+
+var postIDParam = param{name: "id", in: "path", description: "ID of the post", schema: schema{Type: "string"}}
+
+func (h *Handler) routes() []route {
+	return []route{
+		{
+			method: http.MethodGet, pattern: "/posts",
+			operationID: "listPosts", summary: "List posts, newest first",
+			params: pageParams, response: Post{}, list: true,
+			status: http.StatusOK, errors: []int{http.StatusBadRequest},
+			handle: h.listPosts,
+		},
+		{
+			method: http.MethodPost, pattern: "/posts",
+			operationID: "createPost", summary: "Create a post as the caller given in the X-User header, or anonymously",
+			request: CreatePostRequest{}, response: Post{},
+			status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+			handle: h.createPost,
+		},
+		{
+			method: http.MethodGet, pattern: "/posts/{id}",
+			operationID: "getPost", summary: "Get a post",
+			params: []param{postIDParam}, response: Post{},
+			status: http.StatusOK, errors: []int{http.StatusNotFound},
+			handle: h.getPost,
+		},
+		{
+			method: http.MethodGet, pattern: "/posts/{id}/comments",
+			operationID: "listComments", summary: "List comments of a post, oldest first",
+			params: append([]param{postIDParam}, pageParams...), response: Comment{}, list: true,
+			status: http.StatusOK, errors: []int{http.StatusBadRequest, http.StatusNotFound},
+			handle: h.listComments,
+		},
+		{
+			method: http.MethodPost, pattern: "/posts/{id}/comments",
+			operationID: "createComment", summary: "Comment on a post as the caller given in the X-User header, or anonymously",
+			params: []param{postIDParam}, request: CreateCommentRequest{}, response: Comment{},
+			status: http.StatusCreated, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+			handle: h.createComment,
+		},
+	}
+}
+
+func (h *Handler) listPosts(w http.ResponseWriter, r *http.Request) error {
+	p, err := parsePage(r)
+	if err != nil {
+		return err
+	}
+
+	// Лишний пост показывает, есть ли следующая страница
+	posts, err := h.storage.GetPosts(r.Context(), p.limit+1, p.offset)
+	if err != nil {
+		return err
+	}
+	hasNext := len(posts) > p.limit
+	if hasNext {
+		posts = posts[:p.limit]
+	}
+
+	data := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		data = append(data, toPost(post))
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: data, Links: p.links(w, r, hasNext)})
+	return nil
+}
+
+func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) error {
+	var req CreatePostRequest
+	if err := decode(w, r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Content) == "" {
+		return errorf(http.StatusUnprocessableEntity, "validation_failed", "title and content must not be empty")
+	}
+
+	format := domain.ContentFormatPlain
+	switch req.ContentFormat {
+	case "", string(domain.ContentFormatPlain):
+	case string(domain.ContentFormatMarkdown):
+		format = domain.ContentFormatMarkdown
+	default:
+		return errorf(http.StatusUnprocessableEntity, "validation_failed", "contentFormat must be plain or markdown, got %q", req.ContentFormat)
+	}
+	commentsEnabled := req.CommentsEnabled == nil || *req.CommentsEnabled
+
+	post, err := h.forum.CreatePost(r.Context(), req.Title, req.Content, format, commentsEnabled)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", Prefix+"/posts/"+post.ID)
+	writeJSON(w, http.StatusCreated, itemResponse{Data: toPost(post)})
+	return nil
+}
+
+func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) error {
+	post, err := h.findPost(r)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, itemResponse{Data: toPost(post)})
+	return nil
+}
+
+func (h *Handler) listComments(w http.ResponseWriter, r *http.Request) error {
+	p, err := parsePage(r)
+	if err != nil {
+		return err
+	}
+	post, err := h.findPost(r)
+	if err != nil {
+		return err
+	}
+
+	// Лишний комментарий показывает, есть ли следующая страница
+	comments, err := h.storage.GetComments(r.Context(), post.ID, p.limit+1, p.offset)
+	if err != nil {
+		return err
+	}
+	hasNext := len(comments) > p.limit
+	if hasNext {
+		comments = comments[:p.limit]
+	}
+
+	data := make([]Comment, 0, len(comments))
+	for _, comment := range comments {
+		data = append(data, toComment(comment))
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: data, Links: p.links(w, r, hasNext)})
+	return nil
+}
+
+func (h *Handler) createComment(w http.ResponseWriter, r *http.Request) error {
+	var req CreateCommentRequest
+	if err := decode(w, r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return errorf(http.StatusUnprocessableEntity, "validation_failed", "content must not be empty")
+	}
+
+	comment, err := h.forum.CreateComment(r.Context(), r.PathValue("id"), req.ParentID, req.Content)
+	if err != nil {
+		return err
+	}
+	if comment == nil {
+		return h.commentRejected(r)
+	}
+	writeJSON(w, http.StatusCreated, itemResponse{Data: toComment(comment)})
+	return nil
+}
+
+// commentRejected explains why the storage did not create a comment.
+func (h *Handler) commentRejected(r *http.Request) error {
+	post, err := h.findPost(r)
+	if err != nil {
+		return err
+	}
+	if !post.CommentsEnabled {
+		return errorf(http.StatusConflict, "comments_disabled", "comments are disabled for post %s", post.ID)
+	}
+	return errorf(http.StatusUnprocessableEntity, "validation_failed", "parentID is not a comment of post %s", post.ID)
+}
+
+// findPost returns the post given by the id path parameter.
+func (h *Handler) findPost(r *http.Request) (*domain.Post, error) {
+	id := r.PathValue("id")
+	post, err := h.storage.GetPost(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, errorf(http.StatusNotFound, "not_found", "post %s not found", id)
+	}
+	return post, nil
+}
+
+func toPost(post *domain.Post) Post {
+	return Post{
+		ID:              post.ID,
+		Author:          optionalString(post.Author),
+		Title:           post.Title,
+		Content:         post.Content,
+		ContentFormat:   string(post.ContentFormat),
+		CommentsEnabled: post.CommentsEnabled,
+		CreatedAt:       post.CreatedAt,
+	}
+}
+
+func toComment(comment *domain.Comment) Comment {
+	return Comment{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		ParentID:  comment.ParentID,
+		Author:    optionalString(comment.Author),
+		Content:   comment.Content,
+		Mentions:  append([]string{}, comment.Mentions...),
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+// optionalString maps an empty value, such as an anonymous author, to null.
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
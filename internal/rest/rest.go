@@ -0,0 +1,216 @@
+// Package rest serves a versioned REST/JSON API for clients that cannot use
+// GraphQL. It is built on the same storage and forum service as the GraphQL
+// API, and its OpenAPI document is generated from the route table.
+package rest
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/forum"
+	"ArticleForum/internal/logging"
+	"ArticleForum/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Prefix is the path all routes of this version of the API are served under.
+const Prefix = "/api/v1"
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxBodySize limits request bodies; posts are the largest of them.
+	maxBodySize = 1 << 20
+)
+
+// Error is the body of every failed response, wrapped in an "error" field.
+// Code is stable and meant for programs, Message is meant for people.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code" doc:"Machine-readable error code, e.g. not_found"`
+	Message string `json:"message" doc:"Human-readable description of the error"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func errorf(status int, code, format string, args ...any) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Links point to neighbouring pages of a list. Next and Prev are omitted on
+// the last and the first page.
+type Links struct {
+	Self string `json:"self" doc:"This page"`
+	Next string `json:"next,omitempty" doc:"The next page, if there is one"`
+	Prev string `json:"prev,omitempty" doc:"The previous page, if there is one"`
+}
+
+type itemResponse struct {
+	Data any `json:"data"`
+}
+
+type listResponse struct {
+	Data  any   `json:"data"`
+	Links Links `json:"links"`
+}
+
+type errorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Handler serves the API under Prefix.
+type Handler struct {
+	storage storage.Storage
+	forum   *forum.Service
+	mux     *http.ServeMux
+}
+
+func NewHandler(storage storage.Storage, forum *forum.Service) *Handler {
+	h := &Handler{storage: storage, forum: forum, mux: http.NewServeMux()}
+
+	// Маршруты с одним путём обслуживает общий обработчик, чтобы на
+	// неподдерживаемый метод отвечать 405 с телом ошибки в нашем формате
+	byPattern := map[string][]route{}
+	var patterns []string
+	for _, rt := range h.routes() {
+		if _, ok := byPattern[rt.pattern]; !ok {
+			patterns = append(patterns, rt.pattern)
+		}
+		byPattern[rt.pattern] = append(byPattern[rt.pattern], rt)
+	}
+	for _, pattern := range patterns {
+		h.mux.Handle(Prefix+pattern, h.dispatch(byPattern[pattern]))
+	}
+	h.mux.HandleFunc("GET "+Prefix+"/openapi.json", h.serveOpenAPI)
+	h.mux.HandleFunc(Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errorf(http.StatusNotFound, "not_found", "no such endpoint %s", r.URL.Path))
+	})
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) dispatch(routes []route) http.Handler {
+	allowed := make([]string, 0, len(routes))
+	for _, rt := range routes {
+		allowed = append(allowed, rt.method)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rt := range routes {
+			if rt.method == r.Method {
+				if err := rt.handle(w, r); err != nil {
+					writeError(w, r, err)
+				}
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, errorf(http.StatusMethodNotAllowed, "method_not_allowed", "method %s is not allowed, use %s", r.Method, strings.Join(allowed, " or ")))
+	})
+}
+
+// page is the position of a list page requested with the limit and offset
+// query parameters.
+type page struct {
+	limit, offset int
+}
+
+var pageParams = []param{
+	{name: "limit", description: fmt.Sprintf("Page size, at most %d", maxPageSize), schema: schema{Type: "integer", Minimum: ptr(1), Maximum: ptr(maxPageSize), Default: defaultPageSize}},
+	{name: "offset", description: "Number of items to skip", schema: schema{Type: "integer", Minimum: ptr(0), Default: 0}},
+}
+
+func parsePage(r *http.Request) (page, error) {
+	p := page{limit: defaultPageSize}
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return page{}, errorf(http.StatusBadRequest, "invalid_parameter", "limit must be an integer between 1 and %d, got %q", maxPageSize, raw)
+		}
+		p.limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return page{}, errorf(http.StatusBadRequest, "invalid_parameter", "offset must be a non-negative integer, got %q", raw)
+		}
+		p.offset = offset
+	}
+	return p, nil
+}
+
+// links returns the links of page p of the list at r's path; hasNext reports
+// whether items follow the page. The links are also set in the Link header.
+func (p page) links(w http.ResponseWriter, r *http.Request, hasNext bool) Links {
+	link := func(offset int) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(p.limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+	}
+
+	links := Links{Self: link(p.offset)}
+	if hasNext {
+		links.Next = link(p.offset + p.limit)
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, links.Next))
+	}
+	if p.offset > 0 {
+		links.Prev = link(max(p.offset-p.limit, 0))
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"`, links.Prev))
+	}
+	return links
+}
+
+// decode reads the JSON request body into v, rejecting unknown fields.
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errorf(http.StatusRequestEntityTooLarge, "body_too_large", "request body must not exceed %d bytes", maxBodySize)
+		}
+		if errors.Is(err, io.EOF) {
+			return errorf(http.StatusBadRequest, "invalid_body", "request body must be a JSON object")
+		}
+		return errorf(http.StatusBadRequest, "invalid_body", "invalid request body: %v", err)
+	}
+	if decoder.More() {
+		return errorf(http.StatusBadRequest, "invalid_body", "request body must contain a single JSON object")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	// Ссылки на страницы содержат &, экранировать его незачем
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(body)
+}
+
+// writeError responds with the status and code of err. Errors that are not
+// an *Error are logged and reported as internal without details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, auth.ErrUnauthenticated):
+		apiErr = errorf(http.StatusUnauthorized, "unauthenticated", "%v", err)
+	case errors.Is(err, auth.ErrForbidden):
+		apiErr = errorf(http.StatusForbidden, "forbidden", "%v", err)
+	default:
+		logging.FromContext(r.Context()).Error("rest request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		apiErr = errorf(http.StatusInternalServerError, "internal", "internal server error")
+	}
+	writeJSON(w, apiErr.Status, errorResponse{Error: *apiErr})
+}
@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"ArticleForum/internal/auth"
+	"ArticleForum/internal/forum"
+	"ArticleForum/internal/notification"
+	"ArticleForum/internal/storage/memory"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler() (*memory.MemoryStorage, http.Handler) {
+	store := memory.NewMemoryStorage()
+	handler := NewHandler(store, forum.NewService(store, notification.NewNotifier(store)))
+	// Запросы httptest приходят с адреса 192.0.2.1
+	proxy := auth.Proxy{Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}
+	return store, auth.Middleware(proxy, nil)(handler)
+}
+
+type result struct {
+	code   int
+	header http.Header
+	Data   json.RawMessage `json:"data"`
+	Links  Links           `json:"links"`
+	Error  Error           `json:"error"`
+}
+
+func call(t *testing.T, handler http.Handler, method, path, user, body string) result {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if user != "" {
+		req.Header.Set(auth.UserHeader, user)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	res := result{code: rec.Code, header: rec.Header()}
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return res
+}
+
+func TestPosts(t *testing.T) {
+	_, handler := newTestHandler()
+
+	res := call(t, handler, http.MethodPost, "/api/v1/posts", "alice", `{"title":"Hello","content":"# Hi","contentFormat":"markdown"}`)
+	require.Equal(t, http.StatusCreated, res.code)
+	var created Post
+	require.NoError(t, json.Unmarshal(res.Data, &created))
+	assert.Equal(t, "alice", *created.Author)
+	assert.Equal(t, "markdown", created.ContentFormat)
+	assert.True(t, created.CommentsEnabled, "comments are enabled by default")
+	assert.Equal(t, "/api/v1/posts/"+created.ID, res.header.Get("Location"))
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts/"+created.ID, "", "")
+	require.Equal(t, http.StatusOK, res.code)
+	var fetched Post
+	require.NoError(t, json.Unmarshal(res.Data, &fetched))
+	assert.Equal(t, created.ID, fetched.ID)
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts/missing", "", "")
+	assert.Equal(t, http.StatusNotFound, res.code)
+	assert.Equal(t, "not_found", res.Error.Code)
+}
+
+func TestPagination(t *testing.T) {
+	_, handler := newTestHandler()
+	for i := range 5 {
+		res := call(t, handler, http.MethodPost, "/api/v1/posts", "", fmt.Sprintf(`{"title":"Post %d","content":"text"}`, i))
+		require.Equal(t, http.StatusCreated, res.code)
+	}
+
+	res := call(t, handler, http.MethodGet, "/api/v1/posts?limit=2&offset=2", "", "")
+	require.Equal(t, http.StatusOK, res.code)
+	var posts []Post
+	require.NoError(t, json.Unmarshal(res.Data, &posts))
+	assert.Len(t, posts, 2)
+	assert.Equal(t, Links{
+		Self: "/api/v1/posts?limit=2&offset=2",
+		Next: "/api/v1/posts?limit=2&offset=4",
+		Prev: "/api/v1/posts?limit=2&offset=0",
+	}, res.Links)
+	assert.Equal(t, []string{`</api/v1/posts?limit=2&offset=4>; rel="next"`, `</api/v1/posts?limit=2&offset=0>; rel="prev"`}, res.header.Values("Link"))
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts?limit=2&offset=4", "", "")
+	require.NoError(t, json.Unmarshal(res.Data, &posts))
+	assert.Len(t, posts, 1)
+	assert.Empty(t, res.Links.Next, "the last page")
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts?offset=10", "", "")
+	assert.JSONEq(t, `[]`, string(res.Data))
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts?limit=500", "", "")
+	assert.Equal(t, http.StatusBadRequest, res.code)
+	assert.Equal(t, "invalid_parameter", res.Error.Code)
+}
+
+func TestComments(t *testing.T) {
+	store, handler := newTestHandler()
+	ctx := context.Background()
+	_, err := store.EnsureUser(ctx, "bob")
+	require.NoError(t, err)
+	post, err := store.CreatePost(ctx, "bob", "Post", "text", "plain", true)
+	require.NoError(t, err)
+	path := "/api/v1/posts/" + post.ID + "/comments"
+
+	res := call(t, handler, http.MethodPost, path, "alice", `{"content":"Hi @bob"}`)
+	require.Equal(t, http.StatusCreated, res.code)
+	var comment Comment
+	require.NoError(t, json.Unmarshal(res.Data, &comment))
+	assert.Equal(t, []string{"bob"}, comment.Mentions)
+
+	// Комментарий создан через общий сервис и уведомляет автора поста
+	notifications, err := store.GetNotifications(ctx, "bob", false, 10, "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, notifications)
+
+	res = call(t, handler, http.MethodPost, path, "", fmt.Sprintf(`{"content":"reply","parentID":%q}`, comment.ID))
+	require.Equal(t, http.StatusCreated, res.code)
+
+	res = call(t, handler, http.MethodGet, path+"?limit=1", "", "")
+	require.Equal(t, http.StatusOK, res.code)
+	var comments []Comment
+	require.NoError(t, json.Unmarshal(res.Data, &comments))
+	require.Len(t, comments, 1)
+	assert.Equal(t, comment.ID, comments[0].ID)
+	assert.Equal(t, path+"?limit=1&offset=1", res.Links.Next)
+
+	res = call(t, handler, http.MethodPost, path, "", `{"content":"reply","parentID":"missing"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.code)
+
+	_, err = store.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+	res = call(t, handler, http.MethodPost, path, "", `{"content":"late"}`)
+	assert.Equal(t, http.StatusConflict, res.code)
+	assert.Equal(t, "comments_disabled", res.Error.Code)
+
+	res = call(t, handler, http.MethodGet, "/api/v1/posts/missing/comments", "", "")
+	assert.Equal(t, http.StatusNotFound, res.code)
+	res = call(t, handler, http.MethodPost, "/api/v1/posts/missing/comments", "", `{"content":"text"}`)
+	assert.Equal(t, http.StatusNotFound, res.code)
+}
+
+func TestErrors(t *testing.T) {
+	_, handler := newTestHandler()
+
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+		errorCode          string
+	}{
+		{http.MethodPost, "/api/v1/posts", `{"title":"","content":"text"}`, http.StatusUnprocessableEntity, "validation_failed"},
+		{http.MethodPost, "/api/v1/posts", `{"title":"t","content":"c","contentFormat":"html"}`, http.StatusUnprocessableEntity, "validation_failed"},
+		{http.MethodPost, "/api/v1/posts", `{"title":"t","content":"c","tags":[]}`, http.StatusBadRequest, "invalid_body"},
+		{http.MethodPost, "/api/v1/posts", `not json`, http.StatusBadRequest, "invalid_body"},
+		{http.MethodPost, "/api/v1/posts", ``, http.StatusBadRequest, "invalid_body"},
+		{http.MethodDelete, "/api/v1/posts", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/api/v1/users", ``, http.StatusNotFound, "not_found"},
+	} {
+		t.Run(tc.method+" "+tc.path+" "+tc.body, func(t *testing.T) {
+			res := call(t, handler, tc.method, tc.path, "", tc.body)
+			assert.Equal(t, tc.code, res.code)
+			assert.Equal(t, tc.errorCode, res.Error.Code)
+			assert.NotEmpty(t, res.Error.Message)
+		})
+	}
+
+	res := call(t, handler, http.MethodDelete, "/api/v1/posts", "", "")
+	assert.Equal(t, "GET, POST", res.header.Get("Allow"))
+}
@@ -0,0 +1,516 @@
+// Package cache provides a storage.Storage decorator that caches posts and
+// comment pages in a bounded LRU with a TTL.
+package cache
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	DefaultSize = 10000
+	DefaultTTL  = 30 * time.Second
+
+	// maxPagesPerKey bounds the pages cached for the post list or for the
+	// comments of a single post.
+	maxPagesPerKey = 64
+)
+
+type Options struct {
+	// Size is the maximum number of cached entries: single posts, the post
+	// list and the comment pages of a post each take one. Zero uses
+	// DefaultSize.
+	Size int
+	// TTL bounds how long an entry is served. It limits staleness caused by
+	// writes made by other server instances. For a TTL after invalidating an
+	// entry, the cache reloads it with storage.WithPrimary, so a lagging read
+	// replica cannot put the old value back. Zero uses DefaultTTL.
+	TTL time.Duration
+}
+
+// Stats reports the effectiveness of the cache.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+// Storage caches GetPost, GetAllPosts, GetPosts and GetComments of the wrapped storage
+// and invalidates the affected entries on every mutation made through it.
+type Storage struct {
+	next  storage.Storage
+	cache *cache
+	// pending collects invalidations inside a unit of work. They are applied
+	// once it commits, and reads inside it bypass the cache.
+	pending *[]string
+}
+
+func New(next storage.Storage, options Options) *Storage {
+	if options.Size == 0 {
+		options.Size = DefaultSize
+	}
+	if options.TTL == 0 {
+		options.TTL = DefaultTTL
+	}
+	return &Storage{
+		next:  next,
+		cache: &cache{entries: expirable.NewLRU[string, any](options.Size, nil, options.TTL), ttl: options.TTL},
+	}
+}
+
+// Stats returns the hit and miss counters and the current number of entries.
+func (s *Storage) Stats() Stats {
+	return Stats{
+		Hits:          s.cache.hits.Load(),
+		Misses:        s.cache.misses.Load(),
+		Invalidations: s.cache.invalidations.Load(),
+		Entries:       s.cache.entries.Len(),
+	}
+}
+
+// Close closes the wrapped storage if it can be closed.
+func (s *Storage) Close() error {
+	if closer, ok := s.next.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+const (
+	postsKey     = "posts"
+	postPagesKey = "posts:pages"
+)
+
+func postKey(id string) string     { return "post:" + id }
+func commentsKey(id string) string { return "comments:" + id }
+
+type page struct{ limit, offset int }
+
+// pages holds the cached pages of the post list or of one post's comments,
+// so that all of them are invalidated by removing a single entry.
+type pages map[page]any
+
+type cache struct {
+	mu      sync.Mutex
+	entries *expirable.LRU[string, any]
+	// generation changes on every invalidation. A value loaded while it
+	// changed may be stale and is not stored.
+	generation uint64
+	// invalidated records when keys were last invalidated. Within ttl of
+	// that, replicas may still return the old value, so the key is reloaded
+	// from the primary.
+	invalidated map[string]time.Time
+	ttl         time.Duration
+	sweepAt     time.Time
+
+	hits, misses, invalidations atomic.Uint64
+}
+
+// fill tells how to load a value missing from the cache.
+type fill struct {
+	// generation is passed to store with the loaded value.
+	generation uint64
+	// primary is set when the value must be read from the primary.
+	primary bool
+}
+
+// context returns the context to load the value with.
+func (f fill) context(ctx context.Context) context.Context {
+	if f.primary {
+		return storage.WithPrimary(ctx)
+	}
+	return ctx
+}
+
+// lookup returns the cached value for key or how to load it.
+func (c *cache) lookup(key string, pg *page) (any, fill, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.entries.Get(key)
+	if ok && pg != nil {
+		value, ok = value.(pages)[*pg]
+	}
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	invalidated, found := c.invalidated[key]
+	return value, fill{generation: c.generation, primary: found && time.Since(invalidated) < c.ttl}, ok
+}
+
+func (c *cache) store(key string, pg *page, generation uint64, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if pg == nil {
+		c.entries.Add(key, value)
+		return
+	}
+
+	cached, ok := c.entries.Get(key)
+	if !ok || len(cached.(pages)) >= maxPagesPerKey {
+		cached = pages{}
+		c.entries.Add(key, cached)
+	}
+	cached.(pages)[*pg] = value
+}
+
+func (c *cache) invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	now := time.Now()
+	if c.invalidated == nil {
+		c.invalidated = make(map[string]time.Time)
+	}
+	// Устаревшие отметки удаляются не чаще раза в ttl
+	if now.After(c.sweepAt) {
+		for key, at := range c.invalidated {
+			if now.Sub(at) >= c.ttl {
+				delete(c.invalidated, key)
+			}
+		}
+		c.sweepAt = now.Add(c.ttl)
+	}
+	for _, key := range keys {
+		c.entries.Remove(key)
+		c.invalidated[key] = now
+	}
+	c.invalidations.Add(1)
+}
+
+// invalidate drops the given entries now, or when the unit of work commits.
+func (s *Storage) invalidate(keys ...string) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, keys...)
+		return
+	}
+	s.cache.invalidate(keys...)
+}
+
+func (s *Storage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	if s.pending != nil {
+		return fn(s)
+	}
+
+	var pending []string
+	err := s.next.WithinTx(ctx, func(tx storage.Storage) error {
+		return fn(&Storage{next: tx, cache: s.cache, pending: &pending})
+	})
+	if err == nil && len(pending) > 0 {
+		s.cache.invalidate(pending...)
+	}
+	return err
+}
+
+func (s *Storage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	post, err := s.next.CreatePost(ctx, author, title, content, format, commentsEnabled)
+	if err == nil {
+		s.invalidate(postsKey, postPagesKey)
+	}
+	return post, err
+}
+
+func (s *Storage) GetPost(ctx context.Context, id string) (*domain.Post, error) {
+	if s.pending != nil {
+		return s.next.GetPost(ctx, id)
+	}
+	key := postKey(id)
+	value, fill, ok := s.cache.lookup(key, nil)
+	if ok {
+		return clonePost(value.(*domain.Post)), nil
+	}
+
+	post, err := s.next.GetPost(fill.context(ctx), id)
+	if err != nil || post == nil {
+		return post, err
+	}
+	s.cache.store(key, nil, fill.generation, clonePost(post))
+	return post, nil
+}
+
+func (s *Storage) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
+	if s.pending != nil {
+		return s.next.GetAllPosts(ctx)
+	}
+	value, fill, ok := s.cache.lookup(postsKey, nil)
+	if ok {
+		return clonePosts(value.([]*domain.Post)), nil
+	}
+
+	posts, err := s.next.GetAllPosts(fill.context(ctx))
+	if err != nil {
+		return nil, err
+	}
+	s.cache.store(postsKey, nil, fill.generation, clonePosts(posts))
+	return posts, nil
+}
+
+func (s *Storage) GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error) {
+	if s.pending != nil {
+		return s.next.GetPosts(ctx, limit, offset)
+	}
+	pg := &page{limit: limit, offset: offset}
+	value, fill, ok := s.cache.lookup(postPagesKey, pg)
+	if ok {
+		return clonePosts(value.([]*domain.Post)), nil
+	}
+
+	posts, err := s.next.GetPosts(fill.context(ctx), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.store(postPagesKey, pg, fill.generation, clonePosts(posts))
+	return posts, nil
+}
+
+func (s *Storage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error) {
+	post, err := s.next.SetCommentsEnabled(ctx, postID, enabled)
+	if err == nil && post != nil {
+		s.invalidate(postKey(postID), postsKey, postPagesKey)
+	}
+	return post, err
+}
+
+func (s *Storage) DeletePost(ctx context.Context, id string) (bool, error) {
+	deleted, err := s.next.DeletePost(ctx, id)
+	if err == nil && deleted {
+		s.invalidate(postKey(id), postsKey, postPagesKey, commentsKey(id))
+	}
+	return deleted, err
+}
+
+func (s *Storage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error) {
+	comment, err := s.next.CreateComment(ctx, postID, parentID, author, content)
+	if err == nil && comment != nil {
+		s.invalidate(commentsKey(postID))
+	}
+	return comment, err
+}
+
+func (s *Storage) GetComment(ctx context.Context, id string) (*domain.Comment, error) {
+	return s.next.GetComment(ctx, id)
+}
+
+func (s *Storage) GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error) {
+	if s.pending != nil {
+		return s.next.GetComments(ctx, postID, limit, offset)
+	}
+	key, pg := commentsKey(postID), &page{limit: limit, offset: offset}
+	value, fill, ok := s.cache.lookup(key, pg)
+	if ok {
+		return cloneComments(value.([]*domain.Comment)), nil
+	}
+
+	comments, err := s.next.GetComments(fill.context(ctx), postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.store(key, pg, fill.generation, cloneComments(comments))
+	return comments, nil
+}
+
+func (s *Storage) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	comment, err := s.next.UpdateComment(ctx, id, content)
+	if err == nil && comment != nil {
+		s.invalidate(commentsKey(comment.PostID))
+	}
+	return comment, err
+}
+
+func (s *Storage) DeleteCommentThread(ctx context.Context, id string) (int, error) {
+	// Пост комментария нужно узнать до удаления
+	comment, err := s.next.GetComment(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := s.next.DeleteCommentThread(ctx, id)
+	if err == nil && removed > 0 && comment != nil {
+		s.invalidate(commentsKey(comment.PostID))
+	}
+	return removed, err
+}
+
+func (s *Storage) SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	added, err := s.next.SetMentions(ctx, commentID, usernames)
+	if err != nil {
+		return added, err
+	}
+	// Удалённые упоминания тоже меняют страницу комментариев
+	comment, err := s.next.GetComment(ctx, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalidate cached comments: %w", err)
+	}
+	if comment != nil {
+		s.invalidate(commentsKey(comment.PostID))
+	}
+	return added, nil
+}
+
+func (s *Storage) EnsureUser(ctx context.Context, username string) (*domain.User, error) {
+	return s.next.EnsureUser(ctx, username)
+}
+
+func (s *Storage) GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error) {
+	return s.next.GetUsers(ctx, usernames)
+}
+
+func (s *Storage) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	return s.next.ListUsers(ctx)
+}
+
+func (s *Storage) CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error) {
+	return s.next.CreateNotification(ctx, notification)
+}
+
+func (s *Storage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error) {
+	return s.next.GetNotifications(ctx, recipient, unreadOnly, limit, after)
+}
+
+func (s *Storage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	return s.next.GetNotifiedUsers(ctx, commentID, usernames)
+}
+
+func (s *Storage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error) {
+	return s.next.MarkNotificationsRead(ctx, recipient, ids)
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error) {
+	return s.next.CreateWebhook(ctx, url, secret, eventTypes)
+}
+
+func (s *Storage) GetWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	return s.next.GetWebhooks(ctx)
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	return s.next.DeleteWebhook(ctx, id)
+}
+
+func (s *Storage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	return s.next.CreateWebhookDelivery(ctx, delivery)
+}
+
+func (s *Storage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error) {
+	return s.next.GetWebhookDeliveries(ctx, webhookID, limit, offset)
+}
+
+func (s *Storage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error {
+	return s.next.EnqueueDeliveries(ctx, event, webhookIDs)
+}
+
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error) {
+	return s.next.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (s *Storage) RetryDelivery(ctx context.Context, id string, at time.Time) error {
+	return s.next.RetryDelivery(ctx, id, at)
+}
+
+func (s *Storage) RemoveDelivery(ctx context.Context, id string) error {
+	return s.next.RemoveDelivery(ctx, id)
+}
+
+func (s *Storage) GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error) {
+	return s.next.GetQueuedDeliveries(ctx, limit)
+}
+
+func (s *Storage) GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	return s.next.GetPendingEvents(ctx, limit)
+}
+
+func (s *Storage) AckEvents(ctx context.Context, ids []string) error {
+	return s.next.AckEvents(ctx, ids)
+}
+
+func (s *Storage) RestoreUser(ctx context.Context, user *domain.User) error {
+	return s.next.RestoreUser(ctx, user)
+}
+
+func (s *Storage) RestorePost(ctx context.Context, post *domain.Post) error {
+	err := s.next.RestorePost(ctx, post)
+	if err == nil {
+		s.invalidate(postKey(post.ID), postsKey, postPagesKey)
+	}
+	return err
+}
+
+func (s *Storage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	err := s.next.RestoreComment(ctx, comment)
+	if err == nil {
+		s.invalidate(commentsKey(comment.PostID))
+	}
+	return err
+}
+
+func (s *Storage) RestoreNotification(ctx context.Context, notification *domain.Notification) error {
+	return s.next.RestoreNotification(ctx, notification)
+}
+
+func (s *Storage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	return s.next.RestoreWebhook(ctx, webhook)
+}
+
+func (s *Storage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return s.next.RestoreWebhookDelivery(ctx, delivery)
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, event *domain.Event) error {
+	return s.next.RestoreEvent(ctx, event)
+}
+
+func (s *Storage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error {
+	return s.next.RestoreQueuedDelivery(ctx, delivery)
+}
+
+func (s *Storage) HealthCheck(ctx context.Context) error {
+	return s.next.HealthCheck(ctx)
+}
+
+// Cached values are copied on the way in and out, so callers cannot modify
+// them.
+
+func clonePost(post *domain.Post) *domain.Post {
+	clone := *post
+	return &clone
+}
+
+func clonePosts(posts []*domain.Post) []*domain.Post {
+	if posts == nil {
+		return nil
+	}
+	clones := make([]*domain.Post, len(posts))
+	for i, post := range posts {
+		clones[i] = clonePost(post)
+	}
+	return clones
+}
+
+func cloneComments(comments []*domain.Comment) []*domain.Comment {
+	if comments == nil {
+		return nil
+	}
+	clones := make([]*domain.Comment, len(comments))
+	for i, comment := range comments {
+		clone := *comment
+		clone.Mentions = append([]string{}, comment.Mentions...)
+		clones[i] = &clone
+	}
+	return clones
+}
+
+var _ storage.Storage = (*Storage)(nil)
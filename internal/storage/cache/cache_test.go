@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"ArticleForum/internal/storage/storagetest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(memory.NewMemoryStorage(), Options{})
+	})
+}
+
+func TestCacheHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s := New(memory.NewMemoryStorage(), Options{})
+
+	post, err := s.CreatePost(ctx, "", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		_, err = s.GetComments(ctx, post.ID, 10, 0)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, Stats{Hits: 4, Misses: 2, Invalidations: 1, Entries: 2}, s.Stats())
+
+	_, err = s.CreateComment(ctx, post.ID, nil, "", "First")
+	require.NoError(t, err)
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1, "creating a comment drops the post's comment pages")
+
+	cached, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.True(t, cached.CommentsEnabled, "creating a comment keeps the post cached")
+	assert.Equal(t, uint64(5), s.Stats().Hits)
+
+	_, err = s.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+	cached, err = s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.False(t, cached.CommentsEnabled)
+
+	cached.Title = "Changed by the caller"
+	cached, err = s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Title", cached.Title, "cached values are copies")
+
+	page, err := s.GetPosts(ctx, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.False(t, page[0].CommentsEnabled)
+	_, err = s.CreatePost(ctx, "", "Newer", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	page, err = s.GetPosts(ctx, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "Newer", page[0].Title, "creating a post drops the cached post pages")
+}
+
+func TestCacheInvalidatesOnCommit(t *testing.T) {
+	ctx := context.Background()
+	s := New(memory.NewMemoryStorage(), Options{})
+	post, err := s.CreatePost(ctx, "", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+
+	failure := errors.New("rollback")
+	err = s.WithinTx(ctx, func(tx storage.Storage) error {
+		_, err := tx.CreateComment(ctx, post.ID, nil, "", "Discarded")
+		require.NoError(t, err)
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	invalidations := s.Stats().Invalidations
+
+	err = s.WithinTx(ctx, func(tx storage.Storage) error {
+		_, err := tx.CreateComment(ctx, post.ID, nil, "", "Kept")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, invalidations+1, s.Stats().Invalidations)
+
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Kept", comments[0].Content)
+}
+
+func TestCacheSkipsValuesLoadedDuringInvalidation(t *testing.T) {
+	c := &cache{entries: New(memory.NewMemoryStorage(), Options{}).cache.entries}
+
+	_, fill, ok := c.lookup(postsKey, nil)
+	require.False(t, ok)
+	c.invalidate(postsKey)
+	c.store(postsKey, nil, fill.generation, []*domain.Post{})
+
+	_, _, ok = c.lookup(postsKey, nil)
+	assert.False(t, ok, "a value read before the invalidation is not cached")
+}
+
+func TestCacheExpires(t *testing.T) {
+	ctx := context.Background()
+	s := New(memory.NewMemoryStorage(), Options{TTL: 20 * time.Millisecond})
+	_, err := s.GetAllPosts(ctx)
+	require.NoError(t, err)
+
+	time.Sleep(40 * time.Millisecond)
+	_, err = s.GetAllPosts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), s.Stats().Misses)
+}
+
+// laggingReplica sends writes and reads marked with storage.WithPrimary to
+// the primary and other reads to a replica that has not caught up.
+type laggingReplica struct {
+	storage.Storage
+	replica storage.Storage
+}
+
+func (l *laggingReplica) reader(ctx context.Context) storage.Storage {
+	if storage.ReadsPrimary(ctx) {
+		return l.Storage
+	}
+	return l.replica
+}
+
+func (l *laggingReplica) GetPost(ctx context.Context, id string) (*domain.Post, error) {
+	return l.reader(ctx).GetPost(ctx, id)
+}
+
+func (l *laggingReplica) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
+	return l.reader(ctx).GetAllPosts(ctx)
+}
+
+func (l *laggingReplica) GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error) {
+	return l.reader(ctx).GetComments(ctx, postID, limit, offset)
+}
+
+func TestCacheReloadsInvalidatedEntriesFromPrimary(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := memory.NewMemoryStorage(), memory.NewMemoryStorage()
+	s := New(&laggingReplica{Storage: primary, replica: replica}, Options{})
+
+	post, err := s.CreatePost(ctx, "", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	require.NoError(t, replica.RestorePost(ctx, post))
+	cached, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.True(t, cached.CommentsEnabled)
+
+	// Реплика ещё не получила ни комментарий, ни закрытие комментариев
+	_, err = s.CreateComment(ctx, post.ID, nil, "", "First")
+	require.NoError(t, err)
+	_, err = s.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+
+	for range 2 {
+		cached, err = s.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		assert.False(t, cached.CommentsEnabled, "the replica's value is not cached")
+		posts, err := s.GetAllPosts(ctx)
+		require.NoError(t, err)
+		require.Len(t, posts, 1)
+		assert.False(t, posts[0].CommentsEnabled)
+		comments, err := s.GetComments(ctx, post.ID, 10, 0)
+		require.NoError(t, err)
+		assert.Len(t, comments, 1)
+	}
+	assert.Equal(t, uint64(3), s.Stats().Hits, "the second round is served from the cache")
+
+	// Записи, которые не сбрасывались, по-прежнему читаются с реплики
+	other, err := replica.CreatePost(ctx, "", "Other", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	cached, err = s.GetPost(ctx, other.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, cached)
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"ArticleForum/internal/domain"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewEvent wraps data into an outbox event of the given type.
+func NewEvent(eventType domain.EventType, data any) (*domain.Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}, nil
+}
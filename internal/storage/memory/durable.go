@@ -0,0 +1,509 @@
+package memory
+
+import (
+	"ArticleForum/internal/domain"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotFile  = "snapshot.json"
+	segmentPrefix = "wal-"
+	segmentSuffix = ".log"
+
+	// recordHeaderSize is the length and CRC-32 of the payload, both uint32.
+	recordHeaderSize = 8
+	maxRecordSize    = 64 << 20
+
+	DefaultSnapshotInterval = 5 * time.Minute
+)
+
+// Options configures a durable memory storage.
+type Options struct {
+	// SnapshotInterval is how often the full state is written to disk and the
+	// write-ahead log is truncated. Zero uses DefaultSnapshotInterval.
+	SnapshotInterval time.Duration
+	// NoSync skips fsync after every log record. Writes survive a process
+	// crash but may be lost on power failure.
+	NoSync bool
+}
+
+type durability struct {
+	dir     string
+	options Options
+	segment int
+	file    *os.File
+	// size is the length of the segment up to the last complete record.
+	size int64
+	// broken is set when a failed write could not be removed from the log.
+	// Further records would follow the partial one, so they are refused
+	// until a restart discards it.
+	broken error
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type snapshot struct {
+	// NextSegment is the first log segment not covered by the snapshot.
+	NextSegment   int                       `json:"nextSegment"`
+	Posts         []*domain.Post            `json:"posts"`
+	Comments      []*domain.Comment         `json:"comments"`
+	Users         []*domain.User            `json:"users"`
+	Notifications []*domain.Notification    `json:"notifications"`
+	Webhooks      []*domain.Webhook         `json:"webhooks"`
+	Deliveries    []*domain.WebhookDelivery `json:"deliveries"`
+	Queue         []*domain.QueuedDelivery  `json:"queue"`
+	Outbox        []*domain.Event           `json:"outbox"`
+}
+
+// Open returns a memory storage persisted in dir. Every mutation is appended
+// to a write-ahead log before it is applied, and snapshots of the full state
+// are written periodically. On startup the latest snapshot is loaded and the
+// log written after it is replayed; a torn record at the end of the last
+// segment, left by a crash in the middle of a write, is discarded. A damaged
+// record anywhere else fails Open, since the records after it cannot be
+// applied without it.
+func Open(dir string, options Options) (*MemoryStorage, error) {
+	if options.SnapshotInterval <= 0 {
+		options.SnapshotInterval = DefaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	s := NewMemoryStorage()
+	nextSegment, err := s.recover(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &durability{
+		dir:     dir,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	// Новые записи всегда пишутся в новый сегмент, чтобы не дописывать
+	// их после возможно оборванной записи
+	if err := d.openSegment(nextSegment); err != nil {
+		return nil, err
+	}
+	s.durable = d
+
+	go s.snapshotLoop()
+	return s, nil
+}
+
+// Close writes a final snapshot and closes the log. It is a no-op for
+// storages created with NewMemoryStorage.
+func (s *MemoryStorage) Close() error {
+	if s.durable == nil {
+		return nil
+	}
+	close(s.durable.stop)
+	<-s.durable.done
+
+	err := s.Snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if closeErr := s.durable.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// HealthCheck checks that the data directory and the current log segment are
+// still accessible and that the log accepts records. It always succeeds for
+// storages created with NewMemoryStorage.
+func (s *MemoryStorage) HealthCheck(ctx context.Context) error {
+	if s.durable == nil {
+		return nil
+	}
+	defer s.rlock()()
+
+	if _, err := os.Stat(s.durable.dir); err != nil {
+		return fmt.Errorf("data directory is not accessible: %v", err)
+	}
+	if _, err := s.durable.file.Stat(); err != nil {
+		return fmt.Errorf("log segment is not accessible: %v", err)
+	}
+	if s.durable.broken != nil {
+		return fmt.Errorf("log is unusable after a failed write, restart to recover: %v", s.durable.broken)
+	}
+	return nil
+}
+
+// Snapshot writes the current state to disk and removes the log segments it
+// covers.
+func (s *MemoryStorage) Snapshot() error {
+	d := s.durable
+	if d == nil {
+		return nil
+	}
+
+	// Под блокировкой только копируем состояние и переключаем сегмент,
+	// запись снимка на диск идёт параллельно с новыми изменениями
+	s.mu.Lock()
+	state := s.snapshotState()
+	covered := d.segment
+	err := d.openSegment(covered + 1)
+	state.NextSegment = d.segment
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(d.dir, state); err != nil {
+		return err
+	}
+
+	segments, err := listSegments(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment <= covered {
+			if err := os.Remove(segmentPath(d.dir, segment)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) snapshotLoop() {
+	defer close(s.durable.done)
+
+	ticker := time.NewTicker(s.durable.options.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.durable.stop:
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				log.Printf("Failed to write memory storage snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// snapshotState copies the current state; the caller must hold the lock.
+func (s *MemoryStorage) snapshotState() *snapshot {
+	state := &snapshot{
+		Deliveries: append([]*domain.WebhookDelivery{}, s.deliveries...),
+		Queue:      append([]*domain.QueuedDelivery{}, s.queue...),
+		Outbox:     append([]*domain.Event{}, s.outbox...),
+	}
+	for _, post := range s.posts {
+		state.Posts = append(state.Posts, post)
+	}
+	for _, comment := range s.comments {
+		state.Comments = append(state.Comments, comment)
+	}
+	for _, user := range s.users {
+		state.Users = append(state.Users, user)
+	}
+	for _, notification := range s.notifications {
+		state.Notifications = append(state.Notifications, notification)
+	}
+	for _, webhook := range s.webhooks {
+		state.Webhooks = append(state.Webhooks, webhook)
+	}
+	return state
+}
+
+// recover loads the snapshot and replays the log, returning the number of the
+// segment new records should go to.
+func (s *MemoryStorage) recover(dir string) (int, error) {
+	nextSegment := 1
+
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case err == nil:
+		var state snapshot
+		if err := json.Unmarshal(data, &state); err != nil {
+			return 0, fmt.Errorf("failed to read snapshot: %v", err)
+		}
+		s.restore(&state)
+		nextSegment = state.NextSegment
+	case !errors.Is(err, os.ErrNotExist):
+		return 0, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+	// Оборванная запись допустима только в конце журнала: за ней могут идти
+	// лишь пустые сегменты, открытые после сбоя записи
+	tail := len(segments)
+	for tail > 0 {
+		info, err := os.Stat(segmentPath(dir, segments[tail-1]))
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() > 0 {
+			break
+		}
+		tail--
+	}
+	for i, segment := range segments {
+		if segment < nextSegment {
+			continue
+		}
+		if err := s.replaySegment(segmentPath(dir, segment), i >= tail-1); err != nil {
+			return 0, err
+		}
+		nextSegment = segment + 1
+	}
+	return nextSegment, nil
+}
+
+func (s *MemoryStorage) restore(state *snapshot) {
+	for _, post := range state.Posts {
+		s.posts[post.ID] = post
+	}
+	for _, comment := range state.Comments {
+		s.comments[comment.ID] = comment
+	}
+	for _, user := range state.Users {
+		s.users[user.Username] = user
+	}
+	for _, notification := range state.Notifications {
+		s.notifications[notification.ID] = notification
+	}
+	for _, webhook := range state.Webhooks {
+		s.webhooks[webhook.ID] = webhook
+	}
+	s.deliveries = state.Deliveries
+	s.queue = state.Queue
+	s.outbox = state.Outbox
+}
+
+// replaySegment applies the records of a log segment. A torn record is
+// accepted only at the end of the last segment with records, and is cut off
+// so that the segment stays valid when records are appended after it.
+func (s *MemoryStorage) replaySegment(path string, last bool) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := &countingReader{r: bufio.NewReader(file)}
+	for {
+		offset := reader.n
+		rec, err := readRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, errTornRecord) {
+			// Оборванной может быть только запись, которую не успели дописать
+			// до сбоя: после неё в журнале ничего нет
+			rest, readErr := io.Copy(io.Discard, reader)
+			if readErr != nil {
+				return fmt.Errorf("failed to replay %s: %v", path, readErr)
+			}
+			if !last || rest > 0 {
+				return fmt.Errorf("failed to replay %s: corrupted record at offset %d", path, offset)
+			}
+			log.Printf("Discarding torn record at the end of %s", path)
+			if err := file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to discard torn record in %s: %v", path, err)
+			}
+			return file.Sync()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replay %s at offset %d: %v", path, offset, err)
+		}
+		s.apply(rec)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var errTornRecord = errors.New("torn record")
+
+// readRecord reads one framed record. A partially written or corrupted record
+// is reported as errTornRecord.
+func readRecord(r io.Reader) (*record, error) {
+	header := make([]byte, recordHeaderSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		return nil, errTornRecord
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if size > maxRecordSize {
+		return nil, errTornRecord
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, errTornRecord
+	}
+
+	var rec record
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (d *durability) append(rec *record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[recordHeaderSize:], payload)
+
+	if d.broken != nil {
+		return fmt.Errorf("log is unusable after a failed write: %v", d.broken)
+	}
+	if _, err := d.file.Write(frame); err != nil {
+		return d.discardPartial(fmt.Errorf("failed to write log record: %v", err))
+	}
+	if !d.options.NoSync {
+		if err := d.file.Sync(); err != nil {
+			return d.discardPartial(fmt.Errorf("failed to sync log: %v", err))
+		}
+	}
+	d.size += int64(len(frame))
+	return nil
+}
+
+// discardPartial cuts the log back to its last complete record after a failed
+// write, so that records appended later are not lost behind a partial one on
+// recovery. It returns err.
+func (d *durability) discardPartial(err error) error {
+	if truncErr := d.file.Truncate(d.size); truncErr != nil {
+		d.broken = err
+		return fmt.Errorf("%v; failed to remove the partial record: %v", err, truncErr)
+	}
+	if !d.options.NoSync {
+		if syncErr := d.file.Sync(); syncErr != nil {
+			d.broken = err
+			return fmt.Errorf("%v; failed to remove the partial record: %v", err, syncErr)
+		}
+	}
+	return err
+}
+
+// openSegment switches the log to a new segment file.
+func (d *durability) openSegment(segment int) error {
+	file, err := os.OpenFile(segmentPath(d.dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log segment: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log segment: %v", err)
+	}
+	if d.file != nil {
+		d.file.Close()
+	}
+	d.file = file
+	d.segment = segment
+	d.size = info.Size()
+	return nil
+}
+
+func writeSnapshot(dir string, state *snapshot) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, snapshotFile+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, snapshotFile)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func segmentPath(dir string, segment int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%06d%s", segmentPrefix, segment, segmentSuffix))
+}
+
+func listSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		segment, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
@@ -0,0 +1,271 @@
+package memory
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestStorage(t *testing.T, dir string) *MemoryStorage {
+	t.Helper()
+	s, err := Open(dir, Options{SnapshotInterval: time.Hour})
+	require.NoError(t, err)
+	return s
+}
+
+func TestDurableStorageRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStorage(t, dir)
+	post, err := s.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	comment, err := s.CreateComment(ctx, post.ID, nil, "bob", "First")
+	require.NoError(t, err)
+	_, err = s.UpdateComment(ctx, comment.ID, "Edited")
+	require.NoError(t, err)
+
+	// Без Close: восстановление идёт только по журналу
+	s.durable.file.Close()
+
+	s = openTestStorage(t, dir)
+	defer s.Close()
+
+	restored, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Equal(t, "Title", restored.Title)
+
+	edited, err := s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, edited)
+	assert.Equal(t, "Edited", edited.Content)
+
+	events, err := s.GetPendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+}
+
+func TestDurableStorageSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStorage(t, dir)
+	first, err := s.CreatePost(ctx, "alice", "Before snapshot", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	require.NoError(t, s.Snapshot())
+	second, err := s.CreatePost(ctx, "alice", "After snapshot", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	s.durable.file.Close()
+
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Len(t, segments, 1, "segments covered by the snapshot are removed")
+
+	s = openTestStorage(t, dir)
+	defer s.Close()
+
+	posts, err := s.GetAllPosts(ctx)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, ids)
+}
+
+func TestDurableStorageTornRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStorage(t, dir)
+	post, err := s.CreatePost(ctx, "alice", "Title", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = s.CreatePost(ctx, "alice", "Torn", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	path := s.durable.file.Name()
+	s.durable.file.Close()
+
+	// Обрезаем последнюю запись, как при сбое посреди записи
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-5))
+
+	s = openTestStorage(t, dir)
+	posts, err := s.GetAllPosts(ctx)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, post.ID, posts[0].ID)
+
+	// Новые записи после восстановления тоже переживают перезапуск
+	_, err = s.CreatePost(ctx, "alice", "After recovery", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s = openTestStorage(t, dir)
+	defer s.Close()
+	posts, err = s.GetAllPosts(ctx)
+	require.NoError(t, err)
+	assert.Len(t, posts, 2)
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	assert.NoError(t, err)
+}
+
+func TestDurableStorageCorruptedRecord(t *testing.T) {
+	ctx := context.Background()
+
+	// writeLog оставляет сегмент с двумя постами и возвращает путь к нему
+	writeLog := func(t *testing.T, dir string) string {
+		s := openTestStorage(t, dir)
+		for _, title := range []string{"First", "Second"} {
+			_, err := s.CreatePost(ctx, "alice", title, "", domain.ContentFormatPlain, true)
+			require.NoError(t, err)
+		}
+		path := s.durable.file.Name()
+		s.durable.file.Close()
+		return path
+	}
+
+	t.Run("in the middle of a segment", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeLog(t, dir)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[recordHeaderSize+1] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		_, err = Open(dir, Options{})
+		assert.ErrorContains(t, err, "corrupted record at offset 0")
+	})
+
+	t.Run("at the end of a segment followed by records", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeLog(t, dir)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data[:len(data)-5], 0o644))
+		segments, err := listSegments(dir)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(segmentPath(dir, segments[len(segments)-1]+1), data, 0o644))
+
+		_, err = Open(dir, Options{})
+		assert.ErrorContains(t, err, "corrupted record")
+	})
+
+	t.Run("at the end of the log", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeLog(t, dir)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path, info.Size()-5))
+
+		// Пустой сегмент открыт запуском, который сразу упал
+		segments, err := listSegments(dir)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(segmentPath(dir, segments[len(segments)-1]+1), nil, 0o644))
+
+		s := openTestStorage(t, dir)
+		posts, err := s.GetAllPosts(ctx)
+		require.NoError(t, err)
+		assert.Len(t, posts, 1)
+		truncated, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Less(t, truncated.Size(), info.Size()-5, "the torn record is cut off")
+		s.durable.file.Close()
+
+		// Сегмент с обрезанной записью больше не последний, но читается
+		s = openTestStorage(t, dir)
+		defer s.Close()
+		posts, err = s.GetAllPosts(ctx)
+		require.NoError(t, err)
+		assert.Len(t, posts, 1)
+	})
+}
+
+func TestDurableStorageFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStorage(t, t.TempDir())
+	_, err := s.CreatePost(ctx, "alice", "Title", "", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+
+	// Часть записи попала в файл, прежде чем запись завершилась ошибкой
+	size := s.durable.size
+	partial, err := os.OpenFile(s.durable.file.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = partial.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+	partial.Close()
+
+	failure := errors.New("disk full")
+	assert.Equal(t, failure, s.durable.discardPartial(failure))
+	info, err := s.durable.file.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, size, info.Size(), "the partial record is removed")
+	require.NoError(t, s.HealthCheck(ctx))
+
+	// Если обрезать журнал не удалось, запись прекращается до перезапуска
+	s.durable.file.Close()
+	_, err = s.CreatePost(ctx, "alice", "Lost", "", domain.ContentFormatPlain, true)
+	require.Error(t, err)
+	require.NotNil(t, s.durable.broken)
+	_, err = s.CreatePost(ctx, "alice", "Refused", "", domain.ContentFormatPlain, true)
+	assert.ErrorContains(t, err, "log is unusable after a failed write")
+	assert.Error(t, s.HealthCheck(ctx))
+}
+
+func TestDurableStorageUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStorage(t, dir)
+	var committed, discarded *domain.Post
+	err := s.WithinTx(ctx, func(tx storage.Storage) error {
+		var err error
+		committed, err = tx.CreatePost(ctx, "alice", "Committed", "", domain.ContentFormatPlain, true)
+		return err
+	})
+	require.NoError(t, err)
+	err = s.WithinTx(ctx, func(tx storage.Storage) error {
+		var err error
+		if discarded, err = tx.CreatePost(ctx, "alice", "Discarded", "", domain.ContentFormatPlain, true); err != nil {
+			return err
+		}
+		return errors.New("failure")
+	})
+	require.Error(t, err)
+	s.durable.file.Close()
+
+	s = openTestStorage(t, dir)
+	defer s.Close()
+
+	post, err := s.GetPost(ctx, committed.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, post)
+	post, err = s.GetPost(ctx, discarded.ID)
+	require.NoError(t, err)
+	assert.Nil(t, post)
+}
+
+func TestDurableStorageHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStorage(t, dir)
+	require.NoError(t, s.HealthCheck(ctx))
+
+	s.durable.file.Close()
+	assert.Error(t, s.HealthCheck(ctx), "a closed log cannot take writes")
+
+	s = openTestStorage(t, dir)
+	defer s.Close()
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, s.HealthCheck(ctx), "the data directory is gone")
+}
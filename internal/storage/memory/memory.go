@@ -4,6 +4,9 @@ import (
 	"ArticleForum/internal/domain"
 	"ArticleForum/internal/storage"
 	"context"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,36 +14,122 @@ import (
 )
 
 type MemoryStorage struct {
-	posts    map[string]*domain.Post
-	comments map[string]*domain.Comment
-	mu       sync.RWMutex
+	*state
+	mu *sync.RWMutex
+
+	// Заполняются только для хранилища с каталогом данных, см. Open
+	durable *durability
+	// Заполняется у хранилища, переданного в WithinTx
+	tx *memoryTx
+}
+
+type state struct {
+	posts         map[string]*domain.Post
+	comments      map[string]*domain.Comment
+	notifications map[string]*domain.Notification
+	users         map[string]*domain.User
+	webhooks      map[string]*domain.Webhook
+	deliveries    []*domain.WebhookDelivery
+	// queue holds the deliveries waiting for their webhook in queue order
+	queue  []*domain.QueuedDelivery
+	outbox []*domain.Event
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		posts:    make(map[string]*domain.Post),
-		comments: make(map[string]*domain.Comment),
+		state: &state{
+			posts:         make(map[string]*domain.Post),
+			comments:      make(map[string]*domain.Comment),
+			notifications: make(map[string]*domain.Notification),
+			users:         make(map[string]*domain.User),
+			webhooks:      make(map[string]*domain.Webhook),
+		},
+		mu: &sync.RWMutex{},
+	}
+}
+
+// clone copies the collections so a unit of work can be rolled back. Stored
+// values are never mutated in place, so a shallow copy is enough.
+func (st *state) clone() *state {
+	return &state{
+		posts:         maps.Clone(st.posts),
+		comments:      maps.Clone(st.comments),
+		notifications: maps.Clone(st.notifications),
+		users:         maps.Clone(st.users),
+		webhooks:      maps.Clone(st.webhooks),
+		deliveries:    slices.Clone(st.deliveries),
+		queue:         slices.Clone(st.queue),
+		outbox:        slices.Clone(st.outbox),
 	}
 }
 
-func (s *MemoryStorage) CreatePost(ctx context.Context, title, content string, commentsEnabled bool) (*domain.Post, error) {
+// lock takes the write lock and returns the matching unlock. Inside a unit of
+// work the lock is already held by WithinTx.
+func (s *MemoryStorage) lock() func() {
+	if s.tx != nil {
+		return func() {}
+	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.mu.Unlock
+}
+
+// rlock is lock for readers.
+func (s *MemoryStorage) rlock() func() {
+	if s.tx != nil {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// WithinTx holds the write lock while fn runs, so units of work are
+// serialized with every other operation. If fn fails, the state is restored;
+// for a durable storage the records of the unit of work are logged together
+// as one record after fn succeeds. tx must not be used after fn returns.
+func (s *MemoryStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	defer s.lock()()
+
+	saved := s.state.clone()
+	tx := &MemoryStorage{state: s.state, mu: s.mu, durable: s.durable, tx: &memoryTx{}}
+	err := fn(tx)
+	if err == nil && s.durable != nil && len(tx.tx.records) > 0 {
+		err = s.durable.append(&record{Op: opBatch, Records: tx.tx.records})
+	}
+	if err != nil {
+		*s.state = *saved
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	defer s.lock()()
 
 	post := &domain.Post{
 		ID:              uuid.New().String(),
+		Author:          author,
 		Title:           title,
 		Content:         content,
+		ContentFormat:   format,
 		CommentsEnabled: commentsEnabled,
 		CreatedAt:       time.Now(),
 	}
-	s.posts[post.ID] = post
+	event, err := storage.NewEvent(domain.EventPostCreated, post)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(&record{Op: opPutPost, Post: post, Event: event}); err != nil {
+		return nil, err
+	}
 	return post, nil
 }
 
 func (s *MemoryStorage) GetPost(ctx context.Context, id string) (*domain.Post, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
 
 	post, exists := s.posts[id]
 	if !exists {
@@ -50,19 +139,76 @@ func (s *MemoryStorage) GetPost(ctx context.Context, id string) (*domain.Post, e
 }
 
 func (s *MemoryStorage) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
+	return s.sortedPosts(), nil
+}
+
+func (s *MemoryStorage) GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error) {
+	limit, offset = storage.Page(limit, offset)
+	defer s.rlock()()
+
+	posts := s.sortedPosts()
+	if offset >= len(posts) {
+		return []*domain.Post{}, nil
+	}
+
+	end := offset + limit
+	if end > len(posts) {
+		end = len(posts)
+	}
 
+	return posts[offset:end], nil
+}
+
+// sortedPosts returns all posts newest first. The caller must hold the lock.
+func (s *MemoryStorage) sortedPosts() []*domain.Post {
 	posts := make([]*domain.Post, 0, len(s.posts))
 	for _, post := range s.posts {
 		posts = append(posts, post)
 	}
-	return posts, nil
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	return posts
 }
 
-func (s *MemoryStorage) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*domain.Comment, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *MemoryStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error) {
+	defer s.lock()()
+
+	post, exists := s.posts[postID]
+	if !exists {
+		return nil, nil
+	}
+
+	updated := *post
+	updated.CommentsEnabled = enabled
+	event, err := storage.NewEvent(domain.EventPostUpdated, &updated)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(&record{Op: opPutPost, Post: &updated, Event: event}); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *MemoryStorage) DeletePost(ctx context.Context, id string) (bool, error) {
+	defer s.lock()()
+
+	if _, exists := s.posts[id]; !exists {
+		return false, nil
+	}
+	if err := s.commit(&record{Op: opDeletePost, IDs: []string{id}}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MemoryStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error) {
+	defer s.lock()()
 
 	post, exists := s.posts[postID]
 	if !exists {
@@ -73,20 +219,45 @@ func (s *MemoryStorage) CreateComment(ctx context.Context, postID string, parent
 		return nil, nil
 	}
 
+	if parentID != nil {
+		parent, exists := s.comments[*parentID]
+		if !exists || parent.PostID != postID {
+			return nil, nil
+		}
+	}
+
 	comment := &domain.Comment{
 		ID:        uuid.New().String(),
 		PostID:    postID,
 		ParentID:  parentID,
+		Author:    author,
 		Content:   content,
+		Mentions:  []string{},
 		CreatedAt: time.Now(),
 	}
-	s.comments[comment.ID] = comment
+	event, err := storage.NewEvent(domain.EventCommentCreated, comment)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(&record{Op: opPutComment, Comment: comment, Event: event}); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *MemoryStorage) GetComment(ctx context.Context, id string) (*domain.Comment, error) {
+	defer s.rlock()()
+
+	comment, exists := s.comments[id]
+	if !exists {
+		return nil, nil
+	}
 	return comment, nil
 }
 
 func (s *MemoryStorage) GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	limit, offset = storage.Page(limit, offset)
+	defer s.rlock()()
 
 	var comments []*domain.Comment
 	for _, comment := range s.comments {
@@ -94,6 +265,12 @@ func (s *MemoryStorage) GetComments(ctx context.Context, postID string, limit, o
 			comments = append(comments, comment)
 		}
 	}
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
 
 	if offset >= len(comments) {
 		return []*domain.Comment{}, nil
@@ -107,4 +284,493 @@ func (s *MemoryStorage) GetComments(ctx context.Context, postID string, limit, o
 	return comments[offset:end], nil
 }
 
+// UpdateComment and SetMentions replace the stored comment with a modified
+// copy, so comments already handed out to callers are never mutated.
+func (s *MemoryStorage) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	defer s.lock()()
+
+	comment, exists := s.comments[id]
+	if !exists {
+		return nil, nil
+	}
+
+	updated := *comment
+	updated.Content = content
+	event, err := storage.NewEvent(domain.EventCommentUpdated, &updated)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(&record{Op: opPutComment, Comment: &updated, Event: event}); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *MemoryStorage) DeleteCommentThread(ctx context.Context, id string) (int, error) {
+	defer s.lock()()
+
+	if _, exists := s.comments[id]; !exists {
+		return 0, nil
+	}
+
+	// Собираем ответы на ответы, пока находятся новые
+	thread := []string{id}
+	for i := 0; i < len(thread); i++ {
+		for _, comment := range s.comments {
+			if comment.ParentID != nil && *comment.ParentID == thread[i] {
+				thread = append(thread, comment.ID)
+			}
+		}
+	}
+
+	if err := s.commit(&record{Op: opDeleteComments, IDs: thread}); err != nil {
+		return 0, err
+	}
+	return len(thread), nil
+}
+
+func (s *MemoryStorage) SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	defer s.lock()()
+
+	comment, exists := s.comments[commentID]
+	if !exists {
+		return nil, nil
+	}
+
+	updated := *comment
+	updated.Mentions = make([]string, 0, len(usernames))
+	added := make([]string, 0)
+	for _, username := range usernames {
+		if slices.Contains(updated.Mentions, username) {
+			continue
+		}
+		updated.Mentions = append(updated.Mentions, username)
+		if !slices.Contains(comment.Mentions, username) {
+			added = append(added, username)
+		}
+	}
+	sort.Strings(updated.Mentions)
+	if !slices.Equal(updated.Mentions, comment.Mentions) {
+		if err := s.commit(&record{Op: opPutComment, Comment: &updated}); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+func (s *MemoryStorage) EnsureUser(ctx context.Context, username string) (*domain.User, error) {
+	defer s.lock()()
+
+	user, exists := s.users[username]
+	if !exists {
+		user = &domain.User{Username: username, CreatedAt: time.Now()}
+		if err := s.commit(&record{Op: opPutUser, User: user}); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *MemoryStorage) GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error) {
+	defer s.rlock()()
+
+	users := make([]*domain.User, 0, len(usernames))
+	for _, username := range usernames {
+		if user, exists := s.users[username]; exists {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStorage) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	defer s.rlock()()
+
+	users := make([]*domain.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users, nil
+}
+
+func (s *MemoryStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error) {
+	defer s.lock()()
+
+	created := *notification
+	created.ID = uuid.New().String()
+	created.Read = false
+	created.CreatedAt = time.Now()
+	if err := s.commit(&record{Op: opPutNotifications, Notifications: []*domain.Notification{&created}}); err != nil {
+		return nil, err
+	}
+
+	result := created
+	return &result, nil
+}
+
+func (s *MemoryStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error) {
+	defer s.rlock()()
+
+	var cursor *domain.Notification
+	if after != "" {
+		var exists bool
+		cursor, exists = s.notifications[after]
+		if !exists || cursor.Recipient != recipient {
+			return []*domain.Notification{}, nil
+		}
+	}
+
+	notifications := make([]*domain.Notification, 0)
+	for _, notification := range s.notifications {
+		if notification.Recipient != recipient || (unreadOnly && notification.Read) {
+			continue
+		}
+		if cursor != nil && !newerNotification(cursor, notification) {
+			continue
+		}
+		n := *notification
+		notifications = append(notifications, &n)
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return newerNotification(notifications[i], notifications[j])
+	})
+
+	if limit < len(notifications) {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (s *MemoryStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	defer s.rlock()()
+
+	notified := make([]string, 0)
+	for _, notification := range s.notifications {
+		if notification.CommentID == commentID && slices.Contains(usernames, notification.Recipient) &&
+			!slices.Contains(notified, notification.Recipient) {
+			notified = append(notified, notification.Recipient)
+		}
+	}
+	return notified, nil
+}
+
+func (s *MemoryStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error) {
+	defer s.lock()()
+
+	var marked []*domain.Notification
+	mark := func(notification *domain.Notification) {
+		if notification.Recipient == recipient && !notification.Read {
+			updated := *notification
+			updated.Read = true
+			marked = append(marked, &updated)
+		}
+	}
+
+	if len(ids) == 0 {
+		for _, notification := range s.notifications {
+			mark(notification)
+		}
+	} else {
+		for _, id := range ids {
+			if notification, exists := s.notifications[id]; exists {
+				mark(notification)
+			}
+		}
+	}
+
+	if len(marked) == 0 {
+		return 0, nil
+	}
+	if err := s.commit(&record{Op: opPutNotifications, Notifications: marked}); err != nil {
+		return 0, err
+	}
+	return len(marked), nil
+}
+
+func (s *MemoryStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error) {
+	defer s.lock()()
+
+	webhook := &domain.Webhook{
+		ID:         uuid.New().String(),
+		URL:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.commit(&record{Op: opPutWebhook, Webhook: webhook}); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *MemoryStorage) GetWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	defer s.rlock()()
+
+	webhooks := make([]*domain.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (s *MemoryStorage) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	defer s.lock()()
+
+	if _, exists := s.webhooks[id]; !exists {
+		return false, nil
+	}
+	if err := s.commit(&record{Op: opDeleteWebhook, IDs: []string{id}}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MemoryStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	defer s.lock()()
+
+	created := *delivery
+	created.ID = uuid.New().String()
+	created.CreatedAt = time.Now()
+	if err := s.commit(&record{Op: opPutDelivery, Delivery: &created}); err != nil {
+		return nil, err
+	}
+
+	result := created
+	return &result, nil
+}
+
+func (s *MemoryStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error) {
+	limit, offset = storage.Page(limit, offset)
+	defer s.rlock()()
+
+	// Записи журнала добавляются по порядку, поэтому новые находятся в конце
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if s.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+
+	if offset >= len(deliveries) {
+		return []*domain.WebhookDelivery{}, nil
+	}
+
+	end := offset + limit
+	if end > len(deliveries) {
+		end = len(deliveries)
+	}
+
+	return deliveries[offset:end], nil
+}
+
+func (s *MemoryStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error {
+	defer s.lock()()
+
+	now := time.Now()
+	var queued []*domain.QueuedDelivery
+	for _, webhookID := range webhookIDs {
+		if _, exists := s.webhooks[webhookID]; !exists {
+			continue
+		}
+		duplicate := func(q *domain.QueuedDelivery) bool { return q.WebhookID == webhookID && q.Event.ID == event.ID }
+		if slices.ContainsFunc(s.queue, duplicate) || slices.ContainsFunc(queued, duplicate) {
+			continue
+		}
+		queued = append(queued, &domain.QueuedDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhookID,
+			Event:         *event,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+	return s.commit(&record{Op: opQueueDeliveries, Queued: queued})
+}
+
+func (s *MemoryStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error) {
+	defer s.lock()()
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	var claimed []*domain.QueuedDelivery
+	for _, queued := range s.queue {
+		if len(claimed) >= limit {
+			break
+		}
+		// Доставка ждёт, пока не уйдут более старые события того же вебхука
+		if seen[queued.WebhookID] {
+			continue
+		}
+		seen[queued.WebhookID] = true
+		if queued.NextAttemptAt.After(now) {
+			continue
+		}
+		updated := *queued
+		updated.Attempts++
+		updated.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, &updated)
+	}
+	if len(claimed) == 0 {
+		return []*domain.QueuedDelivery{}, nil
+	}
+	if err := s.commit(&record{Op: opPutQueued, Queued: claimed}); err != nil {
+		return nil, err
+	}
+
+	result := make([]*domain.QueuedDelivery, len(claimed))
+	for i, queued := range claimed {
+		copied := *queued
+		result[i] = &copied
+	}
+	return result, nil
+}
+
+func (s *MemoryStorage) RetryDelivery(ctx context.Context, id string, at time.Time) error {
+	defer s.lock()()
+
+	i := slices.IndexFunc(s.queue, func(queued *domain.QueuedDelivery) bool { return queued.ID == id })
+	if i < 0 {
+		return nil
+	}
+	updated := *s.queue[i]
+	updated.NextAttemptAt = at
+	return s.commit(&record{Op: opPutQueued, Queued: []*domain.QueuedDelivery{&updated}})
+}
+
+func (s *MemoryStorage) RemoveDelivery(ctx context.Context, id string) error {
+	defer s.lock()()
+
+	if !slices.ContainsFunc(s.queue, func(queued *domain.QueuedDelivery) bool { return queued.ID == id }) {
+		return nil
+	}
+	return s.commit(&record{Op: opRemoveQueued, IDs: []string{id}})
+}
+
+func (s *MemoryStorage) GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error) {
+	defer s.rlock()()
+
+	end := min(limit, len(s.queue))
+	result := make([]*domain.QueuedDelivery, end)
+	for i, queued := range s.queue[:end] {
+		copied := *queued
+		result[i] = &copied
+	}
+	return result, nil
+}
+
+func (s *MemoryStorage) GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	defer s.rlock()()
+
+	end := min(limit, len(s.outbox))
+	return append([]*domain.Event{}, s.outbox[:end]...), nil
+}
+
+func (s *MemoryStorage) AckEvents(ctx context.Context, ids []string) error {
+	defer s.lock()()
+
+	return s.commit(&record{Op: opAckEvents, IDs: ids})
+}
+
+func (s *MemoryStorage) RestoreUser(ctx context.Context, user *domain.User) error {
+	defer s.lock()()
+
+	if _, exists := s.users[user.Username]; exists {
+		return nil
+	}
+	restored := *user
+	return s.commit(&record{Op: opPutUser, User: &restored})
+}
+
+func (s *MemoryStorage) RestorePost(ctx context.Context, post *domain.Post) error {
+	defer s.lock()()
+
+	if _, exists := s.posts[post.ID]; exists {
+		return nil
+	}
+	restored := *post
+	return s.commit(&record{Op: opPutPost, Post: &restored})
+}
+
+func (s *MemoryStorage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	defer s.lock()()
+
+	if _, exists := s.comments[comment.ID]; exists {
+		return nil
+	}
+	restored := *comment
+	restored.Mentions = append([]string{}, comment.Mentions...)
+	sort.Strings(restored.Mentions)
+	return s.commit(&record{Op: opPutComment, Comment: &restored})
+}
+
+func (s *MemoryStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) error {
+	defer s.lock()()
+
+	if _, exists := s.notifications[notification.ID]; exists {
+		return nil
+	}
+	restored := *notification
+	return s.commit(&record{Op: opPutNotifications, Notifications: []*domain.Notification{&restored}})
+}
+
+func (s *MemoryStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	defer s.lock()()
+
+	if _, exists := s.webhooks[webhook.ID]; exists {
+		return nil
+	}
+	restored := *webhook
+	restored.EventTypes = append([]domain.EventType{}, webhook.EventTypes...)
+	return s.commit(&record{Op: opPutWebhook, Webhook: &restored})
+}
+
+func (s *MemoryStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	defer s.lock()()
+
+	if slices.ContainsFunc(s.deliveries, func(d *domain.WebhookDelivery) bool { return d.ID == delivery.ID }) {
+		return nil
+	}
+	restored := *delivery
+	return s.commit(&record{Op: opPutDelivery, Delivery: &restored})
+}
+
+func (s *MemoryStorage) RestoreEvent(ctx context.Context, event *domain.Event) error {
+	defer s.lock()()
+
+	if slices.ContainsFunc(s.outbox, func(e *domain.Event) bool { return e.ID == event.ID }) {
+		return nil
+	}
+	restored := *event
+	return s.commit(&record{Op: opPutEvent, Event: &restored})
+}
+
+func (s *MemoryStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error {
+	defer s.lock()()
+
+	if slices.ContainsFunc(s.queue, func(q *domain.QueuedDelivery) bool { return q.ID == delivery.ID }) {
+		return nil
+	}
+	restored := *delivery
+	return s.commit(&record{Op: opQueueDeliveries, Queued: []*domain.QueuedDelivery{&restored}})
+}
+
+// newerNotification reports whether a sorts before b in newest-first order.
+func newerNotification(a, b *domain.Notification) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
 var _ storage.Storage = (*MemoryStorage)(nil)
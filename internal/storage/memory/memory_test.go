@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/storagetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return NewMemoryStorage()
+	})
+}
+
+func TestDurableMemoryStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := Open(t.TempDir(), Options{SnapshotInterval: time.Hour, NoSync: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"ArticleForum/internal/domain"
+	"maps"
+	"slices"
+)
+
+type op string
+
+const (
+	opPutPost          op = "put_post"
+	opDeletePost       op = "delete_post"
+	opDeleteComments   op = "delete_comments"
+	opPutComment       op = "put_comment"
+	opPutUser          op = "put_user"
+	opPutNotifications op = "put_notifications"
+	opPutWebhook       op = "put_webhook"
+	opDeleteWebhook    op = "delete_webhook"
+	opPutDelivery      op = "put_delivery"
+	opAckEvents        op = "ack_events"
+	// opQueueDeliveries appends to the webhook delivery queue, opPutQueued
+	// replaces queued deliveries with the same IDs.
+	opQueueDeliveries op = "queue_deliveries"
+	opPutQueued       op = "put_queued"
+	opRemoveQueued    op = "remove_queued"
+	// opPutEvent only appends the record's event to the outbox.
+	opPutEvent op = "put_event"
+	// opBatch groups the records of a unit of work, see WithinTx.
+	opBatch op = "batch"
+)
+
+// record describes a single mutation of the storage. Records are applied to
+// the in-memory state and, for durable storages, appended to the write-ahead
+// log first, so replaying the log rebuilds the same state.
+type record struct {
+	Op            op                       `json:"op"`
+	Post          *domain.Post             `json:"post,omitempty"`
+	Comment       *domain.Comment          `json:"comment,omitempty"`
+	User          *domain.User             `json:"user,omitempty"`
+	Notifications []*domain.Notification   `json:"notifications,omitempty"`
+	Webhook       *domain.Webhook          `json:"webhook,omitempty"`
+	Delivery      *domain.WebhookDelivery  `json:"delivery,omitempty"`
+	Queued        []*domain.QueuedDelivery `json:"queued,omitempty"`
+	Event         *domain.Event            `json:"event,omitempty"`
+	IDs           []string                 `json:"ids,omitempty"`
+	Records       []*record                `json:"records,omitempty"`
+}
+
+// memoryTx collects the records of a unit of work.
+type memoryTx struct {
+	records []*record
+}
+
+// commit logs the record when the storage is durable and applies it. Inside a
+// unit of work the record is logged when the unit of work succeeds. The
+// caller must hold the write lock.
+func (s *MemoryStorage) commit(rec *record) error {
+	if s.tx != nil {
+		s.tx.records = append(s.tx.records, rec)
+	} else if s.durable != nil {
+		if err := s.durable.append(rec); err != nil {
+			return err
+		}
+	}
+	s.apply(rec)
+	return nil
+}
+
+func (s *MemoryStorage) apply(rec *record) {
+	switch rec.Op {
+	case opPutPost:
+		s.posts[rec.Post.ID] = rec.Post
+	case opDeletePost:
+		for _, id := range rec.IDs {
+			delete(s.posts, id)
+		}
+		maps.DeleteFunc(s.comments, func(_ string, comment *domain.Comment) bool {
+			return slices.Contains(rec.IDs, comment.PostID)
+		})
+		maps.DeleteFunc(s.notifications, func(_ string, notification *domain.Notification) bool {
+			return slices.Contains(rec.IDs, notification.PostID)
+		})
+	case opDeleteComments:
+		for _, id := range rec.IDs {
+			delete(s.comments, id)
+		}
+		maps.DeleteFunc(s.notifications, func(_ string, notification *domain.Notification) bool {
+			return slices.Contains(rec.IDs, notification.CommentID)
+		})
+	case opPutComment:
+		s.comments[rec.Comment.ID] = rec.Comment
+	case opPutUser:
+		s.users[rec.User.Username] = rec.User
+	case opPutNotifications:
+		for _, notification := range rec.Notifications {
+			s.notifications[notification.ID] = notification
+		}
+	case opPutWebhook:
+		s.webhooks[rec.Webhook.ID] = rec.Webhook
+	case opDeleteWebhook:
+		for _, id := range rec.IDs {
+			delete(s.webhooks, id)
+		}
+		s.deliveries = slices.DeleteFunc(s.deliveries, func(delivery *domain.WebhookDelivery) bool {
+			return slices.Contains(rec.IDs, delivery.WebhookID)
+		})
+		s.queue = slices.DeleteFunc(s.queue, func(queued *domain.QueuedDelivery) bool {
+			return slices.Contains(rec.IDs, queued.WebhookID)
+		})
+	case opPutDelivery:
+		s.deliveries = append(s.deliveries, rec.Delivery)
+	case opAckEvents:
+		s.outbox = slices.DeleteFunc(s.outbox, func(event *domain.Event) bool {
+			return slices.Contains(rec.IDs, event.ID)
+		})
+	case opQueueDeliveries:
+		s.queue = append(s.queue, rec.Queued...)
+	case opPutQueued:
+		for _, updated := range rec.Queued {
+			if i := slices.IndexFunc(s.queue, func(queued *domain.QueuedDelivery) bool { return queued.ID == updated.ID }); i >= 0 {
+				s.queue[i] = updated
+			}
+		}
+	case opRemoveQueued:
+		s.queue = slices.DeleteFunc(s.queue, func(queued *domain.QueuedDelivery) bool {
+			return slices.Contains(rec.IDs, queued.ID)
+		})
+	case opBatch:
+		for _, nested := range rec.Records {
+			s.apply(nested)
+		}
+	}
+
+	if rec.Event != nil {
+		s.outbox = append(s.outbox, rec.Event)
+	}
+}
@@ -2,7 +2,9 @@ package mock
 
 import (
 	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -11,8 +13,8 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (m *MockStorage) CreatePost(ctx context.Context, title, content string, commentsEnabled bool) (*domain.Post, error) {
-	args := m.Called(ctx, title, content, commentsEnabled)
+func (m *MockStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	args := m.Called(ctx, author, title, content, format, commentsEnabled)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -35,8 +37,37 @@ func (m *MockStorage) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
 	return args.Get(0).([]*domain.Post), args.Error(1)
 }
 
-func (m *MockStorage) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*domain.Comment, error) {
-	args := m.Called(ctx, postID, parentID, content)
+func (m *MockStorage) GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error) {
+	args := m.Called(ctx, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Post), args.Error(1)
+}
+
+func (m *MockStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error) {
+	args := m.Called(ctx, postID, enabled)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Post), args.Error(1)
+}
+
+func (m *MockStorage) DeletePost(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error) {
+	args := m.Called(ctx, postID, parentID, author, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Comment), args.Error(1)
+}
+
+func (m *MockStorage) GetComment(ctx context.Context, id string) (*domain.Comment, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -50,3 +81,211 @@ func (m *MockStorage) GetComments(ctx context.Context, postID string, limit, off
 	}
 	return args.Get(0).([]*domain.Comment), args.Error(1)
 }
+
+func (m *MockStorage) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	args := m.Called(ctx, id, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Comment), args.Error(1)
+}
+
+func (m *MockStorage) DeleteCommentThread(ctx context.Context, id string) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	args := m.Called(ctx, commentID, usernames)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) EnsureUser(ctx context.Context, username string) (*domain.User, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockStorage) GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error) {
+	args := m.Called(ctx, usernames)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockStorage) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error) {
+	args := m.Called(ctx, notification)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Notification), args.Error(1)
+}
+
+func (m *MockStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error) {
+	args := m.Called(ctx, recipient, unreadOnly, limit, after)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Notification), args.Error(1)
+}
+
+func (m *MockStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	args := m.Called(ctx, commentID, usernames)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error) {
+	args := m.Called(ctx, recipient, ids)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error) {
+	args := m.Called(ctx, url, secret, eventTypes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Webhook), args.Error(1)
+}
+
+func (m *MockStorage) GetWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Webhook), args.Error(1)
+}
+
+func (m *MockStorage) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	args := m.Called(ctx, delivery)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error {
+	args := m.Called(ctx, event, webhookIDs)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error) {
+	args := m.Called(ctx, limit, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QueuedDelivery), args.Error(1)
+}
+
+func (m *MockStorage) RetryDelivery(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RemoveDelivery(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.QueuedDelivery), args.Error(1)
+}
+
+func (m *MockStorage) GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Event), args.Error(1)
+}
+
+func (m *MockStorage) AckEvents(ctx context.Context, ids []string) error {
+	args := m.Called(ctx, ids)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreUser(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestorePost(ctx context.Context, post *domain.Post) error {
+	args := m.Called(ctx, post)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	args := m.Called(ctx, comment)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) error {
+	args := m.Called(ctx, notification)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreEvent(ctx context.Context, event *domain.Event) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+// WithinTx runs fn against the mock itself, so expectations set on the mock
+// apply to the operations of the unit of work.
+func (m *MockStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	return fn(m)
+}
+
+func (m *MockStorage) HealthCheck(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+var _ storage.Storage = (*MockStorage)(nil)
@@ -0,0 +1,8 @@
+package storage
+
+// Page returns the bounds of a paged query with negative values replaced by
+// zero, so a negative limit selects nothing and a negative offset starts at
+// the first item. Every backend applies it to limit and offset arguments.
+func Page(limit, offset int) (int, int) {
+	return max(limit, 0), max(offset, 0)
+}
@@ -3,20 +3,33 @@ package postgres
 import (
 	"ArticleForum/internal/domain"
 	"ArticleForum/internal/storage"
+	"ArticleForum/pkg/migrations"
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresStorage struct {
 	db *sql.DB
+	// q is db, or tx inside a unit of work started with WithinTx.
+	q  queryer
+	tx *sql.Tx
+	// replicas is nil when no read replicas are configured.
+	replicas *replicaSet
 }
 
 func NewPostgresStorage(dataSourceName string) (*PostgresStorage, error) {
+	return Open(dataSourceName, Options{})
+}
+
+// Open connects to the primary database and to the read replicas given in
+// options.
+func Open(dataSourceName string, options Options) (*PostgresStorage, error) {
 	db, err := sql.Open("postgres", dataSourceName)
 	if err != nil {
 		return nil, err
@@ -25,74 +38,154 @@ func NewPostgresStorage(dataSourceName string) (*PostgresStorage, error) {
 		return nil, err
 	}
 
-	if err := createTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+	// Схема создаётся миграциями, здесь только проверяется её версия
+	if err := migrations.CheckVersion(context.Background(), db, migrations.Postgres); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	return &PostgresStorage{db: db}, nil
+	s := &PostgresStorage{db: db, q: traced(db, "primary")}
+	if len(options.ReplicaDSNs) > 0 {
+		if s.replicas, err = openReplicas(options); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
-func createTables(db *sql.DB) error {
-	postsTable := `
-		CREATE TABLE IF NOT EXISTS posts (
-			id TEXT PRIMARY KEY,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			comments_enabled BOOLEAN NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		)
-	`
-
-	commentsTable := `
-		CREATE TABLE IF NOT EXISTS comments (
-			id TEXT PRIMARY KEY,
-			post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
-			parent_id TEXT REFERENCES comments(id) ON DELETE CASCADE,
-			content TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		)
-	`
+func (s *PostgresStorage) Close() error {
+	if s.replicas != nil {
+		s.replicas.close()
+	}
+	return s.db.Close()
+}
 
-	indexes := `
-		CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
-		CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
-	`
+// Pools returns the connection pools of the primary and of the replicas by
+// name, for monitoring.
+func (s *PostgresStorage) Pools() map[string]*sql.DB {
+	pools := map[string]*sql.DB{"primary": s.db}
+	if s.replicas != nil {
+		for i, r := range s.replicas.replicas {
+			pools[fmt.Sprintf("replica-%d", i)] = r.db
+		}
+	}
+	return pools
+}
 
-	if _, err := db.Exec(postsTable); err != nil {
+// HealthCheck pings the primary and checks its schema version. Replicas are
+// not checked: reads fall back to the primary while they are unavailable.
+func (s *PostgresStorage) HealthCheck(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
 		return err
 	}
-	if _, err := db.Exec(commentsTable); err != nil {
+	return migrations.CheckVersion(ctx, s.db, migrations.Postgres)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithinTx runs fn in a transaction. Nested calls join the outer transaction.
+func (s *PostgresStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&PostgresStorage{db: s.db, q: traced(tx, "primary"), tx: tx, replicas: s.replicas})
+	})
+}
+
+// withTx runs fn in a transaction that is committed when fn succeeds. Inside
+// a unit of work fn runs in the surrounding transaction.
+func (s *PostgresStorage) withTx(ctx context.Context, fn func(tx queryer) error) error {
+	if s.tx != nil {
+		return fn(s.q)
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(traced(tx, "primary"))
+	})
+}
+
+// inTx begins a transaction and commits it when fn succeeds.
+func (s *PostgresStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
-	if _, err := db.Exec(indexes); err != nil {
+	if err := fn(tx); err != nil {
+		tx.Rollback()
 		return err
 	}
-
-	return nil
+	return tx.Commit()
 }
 
-func (s *PostgresStorage) CreatePost(ctx context.Context, title, content string, commentsEnabled bool) (*domain.Post, error) {
-	id := uuid.New().String()
-	createdAt := time.Now()
-	query := `INSERT INTO posts (id, title, content, comments_enabled, created_at) VALUES ($1, $2, $3, $4, $5)`
-	_, err := s.db.ExecContext(ctx, query, id, title, content, commentsEnabled, createdAt)
+// Keys of the advisory locks guarding the outbox.
+const (
+	outboxWriteLock int64 = 0x4f5554424f580001
+	outboxRelayLock int64 = 0x4f5554424f580002
+)
+
+// insertEvent writes an event into the outbox as part of the caller's
+// transaction, so it is published if and only if the change is committed.
+func insertEvent(ctx context.Context, q queryer, eventType domain.EventType, data any) error {
+	event, err := storage.NewEvent(eventType, data)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &domain.Post{
-		ID:              id,
+	// seq выдаётся при вставке, а видна строка становится после фиксации.
+	// Блокировка до конца транзакции упорядочивает фиксации по seq, иначе
+	// relay мог бы пройти мимо события, зафиксированного позже следующего
+	if _, err := q.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxWriteLock); err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox (id, type, data, created_at) VALUES ($1, $2, $3, $4)`
+	_, err = q.ExecContext(ctx, query, event.ID, event.Type, []byte(event.Data), event.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	s.wrote(ctx)
+	post := &domain.Post{
+		ID:              uuid.New().String(),
+		Author:          author,
 		Title:           title,
 		Content:         content,
+		ContentFormat:   format,
 		CommentsEnabled: commentsEnabled,
-		CreatedAt:       createdAt,
-	}, nil
+		CreatedAt:       time.Now(),
+	}
+
+	err := s.withTx(ctx, func(tx queryer) error {
+		query := `INSERT INTO posts (id, author, title, content, content_format, comments_enabled, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		if _, err := tx.ExecContext(ctx, query, post.ID, author, title, content, format, commentsEnabled, post.CreatedAt); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventPostCreated, post)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
 }
 
 func (s *PostgresStorage) GetPost(ctx context.Context, id string) (*domain.Post, error) {
-	query := `SELECT id, title, content, comments_enabled, created_at FROM posts WHERE id = $1`
-	row := s.db.QueryRowContext(ctx, query, id)
+	var post *domain.Post
+	err := s.read(ctx, func(q queryer) (err error) {
+		post, err = getPost(ctx, q, id)
+		return err
+	})
+	return post, err
+}
+
+func getPost(ctx context.Context, q queryer, id string) (*domain.Post, error) {
+	query := `SELECT id, author, title, content, content_format, comments_enabled, created_at FROM posts WHERE id = $1`
+	row := q.QueryRowContext(ctx, query, id)
 	var post domain.Post
-	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.CommentsEnabled, &post.CreatedAt)
+	err := row.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.ContentFormat, &post.CommentsEnabled, &post.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -102,8 +195,36 @@ func (s *PostgresStorage) GetPost(ctx context.Context, id string) (*domain.Post,
 }
 
 func (s *PostgresStorage) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
-	query := `SELECT id, title, content, comments_enabled, created_at FROM posts ORDER BY created_at DESC`
-	rows, err := s.db.QueryContext(ctx, query)
+	var posts []*domain.Post
+	err := s.read(ctx, func(q queryer) (err error) {
+		posts, err = getAllPosts(ctx, q)
+		return err
+	})
+	return posts, err
+}
+
+func (s *PostgresStorage) GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error) {
+	limit, offset = storage.Page(limit, offset)
+	var posts []*domain.Post
+	err := s.read(ctx, func(q queryer) (err error) {
+		posts, err = getPosts(ctx, q, limit, offset)
+		return err
+	})
+	return posts, err
+}
+
+func getAllPosts(ctx context.Context, q queryer) ([]*domain.Post, error) {
+	query := `SELECT id, author, title, content, content_format, comments_enabled, created_at FROM posts ORDER BY created_at DESC, id DESC`
+	return queryPosts(ctx, q, query)
+}
+
+func getPosts(ctx context.Context, q queryer, limit, offset int) ([]*domain.Post, error) {
+	query := `SELECT id, author, title, content, content_format, comments_enabled, created_at FROM posts ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2`
+	return queryPosts(ctx, q, query, limit, offset)
+}
+
+func queryPosts(ctx context.Context, q queryer, query string, args ...any) ([]*domain.Post, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,49 +233,140 @@ func (s *PostgresStorage) GetAllPosts(ctx context.Context) ([]*domain.Post, erro
 	var posts []*domain.Post
 	for rows.Next() {
 		var post domain.Post
-		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.CommentsEnabled, &post.CreatedAt); err != nil {
+		if err := rows.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.ContentFormat, &post.CommentsEnabled, &post.CreatedAt); err != nil {
 			return nil, err
 		}
 		posts = append(posts, &post)
 	}
-	return posts, nil
+	return posts, rows.Err()
 }
 
-func (s *PostgresStorage) CreateComment(ctx context.Context, postID string, parentID *string, content string) (*domain.Comment, error) {
-	// Проверяем, существует ли пост и разрешены ли комментарии
-	post, err := s.GetPost(ctx, postID)
+func (s *PostgresStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error) {
+	s.wrote(ctx)
+	var post *domain.Post
+	err := s.withTx(ctx, func(tx queryer) error {
+		query := `UPDATE posts SET comments_enabled = $2 WHERE id = $1
+			RETURNING id, author, title, content, content_format, comments_enabled, created_at`
+		var updated domain.Post
+		err := tx.QueryRowContext(ctx, query, postID, enabled).Scan(&updated.ID, &updated.Author, &updated.Title, &updated.Content,
+			&updated.ContentFormat, &updated.CommentsEnabled, &updated.CreatedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		post = &updated
+		return insertEvent(ctx, tx, domain.EventPostUpdated, post)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if post == nil || !post.CommentsEnabled {
-		return nil, nil
-	}
+	return post, nil
+}
 
-	id := uuid.New().String()
-	createdAt := time.Now()
-	var query string
-	if parentID == nil {
-		query = `INSERT INTO comments (id, post_id, content, created_at) VALUES ($1, $2, $3, $4)`
-		_, err = s.db.ExecContext(ctx, query, id, postID, content, createdAt)
-	} else {
-		query = `INSERT INTO comments (id, post_id, parent_id, content, created_at) VALUES ($1, $2, $3, $4, $5)`
-		_, err = s.db.ExecContext(ctx, query, id, postID, *parentID, content, createdAt)
+func (s *PostgresStorage) DeletePost(ctx context.Context, id string) (bool, error) {
+	s.wrote(ctx)
+	// Комментарии и уведомления удаляются каскадно
+	result, err := s.q.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
 	}
+	return affected > 0, nil
+}
+
+func (s *PostgresStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error) {
+	s.wrote(ctx)
+	var comment *domain.Comment
+	err := s.withTx(ctx, func(tx queryer) error {
+		// Проверяем, существует ли пост и разрешены ли комментарии. FOR SHARE
+		// не даёт изменить или удалить пост и родительский комментарий до
+		// конца транзакции
+		var commentsEnabled bool
+		err := tx.QueryRowContext(ctx, `SELECT comments_enabled FROM posts WHERE id = $1 FOR SHARE`, postID).Scan(&commentsEnabled)
+		if err == sql.ErrNoRows || (err == nil && !commentsEnabled) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if parentID != nil {
+			var parentPostID string
+			err := tx.QueryRowContext(ctx, `SELECT post_id FROM comments WHERE id = $1 FOR SHARE`, *parentID).Scan(&parentPostID)
+			if err == sql.ErrNoRows || (err == nil && parentPostID != postID) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		comment = &domain.Comment{
+			ID:        uuid.New().String(),
+			PostID:    postID,
+			ParentID:  parentID,
+			Author:    author,
+			Content:   content,
+			Mentions:  []string{},
+			CreatedAt: time.Now(),
+		}
+		query := `INSERT INTO comments (id, post_id, parent_id, author, content, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.ExecContext(ctx, query, comment.ID, postID, parentID, author, content, comment.CreatedAt); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventCommentCreated, comment)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &domain.Comment{
-		ID:        id,
-		PostID:    postID,
-		ParentID:  parentID,
-		Content:   content,
-		CreatedAt: createdAt,
-	}, nil
+	return comment, nil
+}
+
+// commentColumns selects a comment together with the users it mentions.
+const commentColumns = `id, post_id, parent_id, author, content, created_at,
+	ARRAY(SELECT username FROM comment_mentions WHERE comment_id = comments.id ORDER BY username)`
+
+func (s *PostgresStorage) GetComment(ctx context.Context, id string) (*domain.Comment, error) {
+	var comment *domain.Comment
+	err := s.read(ctx, func(q queryer) (err error) {
+		comment, err = getComment(ctx, q, id)
+		return err
+	})
+	return comment, err
+}
+
+func getComment(ctx context.Context, q queryer, id string) (*domain.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+	row := q.QueryRowContext(ctx, query, id)
+	var comment domain.Comment
+	var parentID sql.NullString
+	err := row.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Content, &comment.CreatedAt, pq.Array(&comment.Mentions))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		comment.ParentID = &parentID.String
+	}
+	return &comment, nil
 }
 
 func (s *PostgresStorage) GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error) {
-	query := `SELECT id, post_id, parent_id, content, created_at FROM comments WHERE post_id = $1 ORDER BY created_at ASC LIMIT $2 OFFSET $3`
-	rows, err := s.db.QueryContext(ctx, query, postID, limit, offset)
+	limit, offset = storage.Page(limit, offset)
+	var comments []*domain.Comment
+	err := s.read(ctx, func(q queryer) (err error) {
+		comments, err = getComments(ctx, q, postID, limit, offset)
+		return err
+	})
+	return comments, err
+}
+
+func getComments(ctx context.Context, q queryer, postID string, limit, offset int) ([]*domain.Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE post_id = $1 ORDER BY created_at ASC, id ASC LIMIT $2 OFFSET $3`
+	rows, err := q.QueryContext(ctx, query, postID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +376,7 @@ func (s *PostgresStorage) GetComments(ctx context.Context, postID string, limit,
 	for rows.Next() {
 		var comment domain.Comment
 		var parentID sql.NullString
-		if err := rows.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Content, &comment.CreatedAt); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Content, &comment.CreatedAt, pq.Array(&comment.Mentions)); err != nil {
 			return nil, err
 		}
 		if parentID.Valid {
@@ -172,7 +384,521 @@ func (s *PostgresStorage) GetComments(ctx context.Context, postID string, limit,
 		}
 		comments = append(comments, &comment)
 	}
-	return comments, nil
+	return comments, rows.Err()
+}
+
+func (s *PostgresStorage) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	s.wrote(ctx)
+	var comment *domain.Comment
+	err := s.withTx(ctx, func(tx queryer) error {
+		query := `UPDATE comments SET content = $2 WHERE id = $1`
+		result, err := tx.ExecContext(ctx, query, id, content)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		if comment, err = getComment(ctx, tx, id); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventCommentUpdated, comment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *PostgresStorage) DeleteCommentThread(ctx context.Context, id string) (int, error) {
+	s.wrote(ctx)
+	// Ответы удалились бы и каскадно, но так RowsAffected учитывает всю ветку
+	query := `WITH RECURSIVE thread AS (
+			SELECT id FROM comments WHERE id = $1
+			UNION ALL
+			SELECT comments.id FROM comments JOIN thread ON comments.parent_id = thread.id
+		)
+		DELETE FROM comments WHERE id IN (SELECT id FROM thread)`
+	result, err := s.q.ExecContext(ctx, query, id)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+func (s *PostgresStorage) SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	s.wrote(ctx)
+	if usernames == nil {
+		// pq.Array(nil) передаётся как NULL, и ANY(NULL) не удалил бы ничего
+		usernames = []string{}
+	}
+	added := make([]string, 0)
+	err := s.withTx(ctx, func(tx queryer) error {
+		query := `DELETE FROM comment_mentions WHERE comment_id = $1 AND NOT (username = ANY($2::text[]))`
+		if _, err := tx.ExecContext(ctx, query, commentID, pq.Array(usernames)); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO comment_mentions (comment_id, username)
+			SELECT $1, username FROM UNNEST($2::text[]) AS username
+			ON CONFLICT DO NOTHING
+			RETURNING username`
+		rows, err := tx.QueryContext(ctx, query, commentID, pq.Array(usernames))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var username string
+			if err := rows.Scan(&username); err != nil {
+				return err
+			}
+			added = append(added, username)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (s *PostgresStorage) EnsureUser(ctx context.Context, username string) (*domain.User, error) {
+	s.wrote(ctx)
+	query := `INSERT INTO users (username, created_at) VALUES ($1, $2)
+		ON CONFLICT (username) DO UPDATE SET username = EXCLUDED.username
+		RETURNING username, created_at`
+	var user domain.User
+	if err := s.q.QueryRowContext(ctx, query, username, time.Now()).Scan(&user.Username, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *PostgresStorage) GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error) {
+	query := `SELECT username, created_at FROM users WHERE username = ANY($1)`
+	rows, err := s.q.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0, len(usernames))
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresStorage) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT username, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0)
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error) {
+	s.wrote(ctx)
+	created := *notification
+	created.ID = uuid.New().String()
+	created.Read = false
+	created.CreatedAt = time.Now()
+
+	query := `INSERT INTO notifications (id, recipient, type, post_id, comment_id, actor, read, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := s.q.ExecContext(ctx, query, created.ID, created.Recipient, created.Type, created.PostID, created.CommentID, created.Actor, created.Read, created.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *PostgresStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error) {
+	query := `SELECT id, recipient, type, post_id, comment_id, actor, read, created_at FROM notifications
+		WHERE recipient = $1 AND ($2 = FALSE OR read = FALSE)`
+	args := []any{recipient, unreadOnly}
+	if after != "" {
+		query += ` AND (created_at, id) < (SELECT created_at, id FROM notifications WHERE id = $4 AND recipient = $1)`
+		args = append(args, limit, after)
+	} else {
+		args = append(args, limit)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $3`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]*domain.Notification, 0)
+	for rows.Next() {
+		var notification domain.Notification
+		if err := rows.Scan(&notification.ID, &notification.Recipient, &notification.Type, &notification.PostID,
+			&notification.CommentID, &notification.Actor, &notification.Read, &notification.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *PostgresStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	query := `SELECT DISTINCT recipient FROM notifications WHERE recipient = ANY($1) AND comment_id = $2`
+	rows, err := s.q.QueryContext(ctx, query, pq.Array(usernames), commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notified := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		notified = append(notified, username)
+	}
+	return notified, rows.Err()
+}
+
+func (s *PostgresStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error) {
+	s.wrote(ctx)
+	var result sql.Result
+	var err error
+	if len(ids) == 0 {
+		query := `UPDATE notifications SET read = TRUE WHERE recipient = $1 AND read = FALSE`
+		result, err = s.q.ExecContext(ctx, query, recipient)
+	} else {
+		query := `UPDATE notifications SET read = TRUE WHERE recipient = $1 AND read = FALSE AND id = ANY($2)`
+		result, err = s.q.ExecContext(ctx, query, recipient, pq.Array(ids))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+func (s *PostgresStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error) {
+	s.wrote(ctx)
+	webhook := &domain.Webhook{
+		ID:         uuid.New().String(),
+		URL:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+
+	query := `INSERT INTO webhooks (id, url, secret, event_types, active, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := s.q.ExecContext(ctx, query, webhook.ID, webhook.URL, webhook.Secret, pq.Array(eventTypes), webhook.Active, webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *PostgresStorage) GetWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	query := `SELECT id, url, secret, event_types, active, created_at FROM webhooks ORDER BY created_at ASC`
+	rows, err := s.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*domain.Webhook, 0)
+	for rows.Next() {
+		var webhook domain.Webhook
+		var eventTypes []string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, pq.Array(&eventTypes), &webhook.Active, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, eventType := range eventTypes {
+			webhook.EventTypes = append(webhook.EventTypes, domain.EventType(eventType))
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *PostgresStorage) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	s.wrote(ctx)
+	result, err := s.q.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *PostgresStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	s.wrote(ctx)
+	created := *delivery
+	created.ID = uuid.New().String()
+	created.CreatedAt = time.Now()
+
+	query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := s.q.ExecContext(ctx, query, created.ID, created.WebhookID, created.EventID, created.EventType, created.Attempt,
+		created.StatusCode, created.Error, created.Success, created.Duration.Milliseconds(), created.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *PostgresStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error) {
+	limit, offset = storage.Page(limit, offset)
+	query := `SELECT id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at
+		FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`
+	rows, err := s.q.QueryContext(ctx, query, webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery domain.WebhookDelivery
+		var durationMs int64
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.Success, &durationMs, &delivery.CreatedAt); err != nil {
+			return nil, err
+		}
+		delivery.Duration = time.Duration(durationMs) * time.Millisecond
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+const queuedColumns = `id, webhook_id, event_id, event_type, event_data, event_created_at, attempts, next_attempt_at, created_at`
+
+func (s *PostgresStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error {
+	s.wrote(ctx)
+	now := time.Now()
+	return s.withTx(ctx, func(tx queryer) error {
+		for _, webhookID := range webhookIDs {
+			query := `INSERT INTO webhook_queue (` + queuedColumns + `)
+				SELECT $1::text, $2::text, $3::text, $4::text, $5::jsonb, $6::timestamp, 0, $7::timestamp, $7::timestamp
+				WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = $2)
+				ON CONFLICT DO NOTHING`
+			_, err := tx.ExecContext(ctx, query, uuid.New().String(), webhookID, event.ID, event.Type, []byte(event.Data), event.CreatedAt, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error) {
+	s.wrote(ctx)
+	now := time.Now()
+	// Берётся только самая старая доставка каждого вебхука; строки, которые
+	// забирает другой экземпляр, пропускаются
+	query := `UPDATE webhook_queue SET attempts = attempts + 1, next_attempt_at = $1
+		WHERE seq IN (
+			SELECT seq FROM webhook_queue q
+			WHERE seq = (SELECT MIN(seq) FROM webhook_queue WHERE webhook_id = q.webhook_id) AND next_attempt_at <= $2
+			ORDER BY seq LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + queuedColumns
+	return queryQueued(ctx, s.q, query, now.Add(lease), now, limit)
+}
+
+func (s *PostgresStorage) RetryDelivery(ctx context.Context, id string, at time.Time) error {
+	s.wrote(ctx)
+	_, err := s.q.ExecContext(ctx, `UPDATE webhook_queue SET next_attempt_at = $2 WHERE id = $1`, id, at)
+	return err
+}
+
+func (s *PostgresStorage) RemoveDelivery(ctx context.Context, id string) error {
+	s.wrote(ctx)
+	_, err := s.q.ExecContext(ctx, `DELETE FROM webhook_queue WHERE id = $1`, id)
+	return err
+}
+
+func (s *PostgresStorage) GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error) {
+	return queryQueued(ctx, s.q, `SELECT `+queuedColumns+` FROM webhook_queue ORDER BY seq ASC LIMIT $1`, limit)
+}
+
+func queryQueued(ctx context.Context, q queryer, query string, args ...any) ([]*domain.QueuedDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*domain.QueuedDelivery, 0)
+	for rows.Next() {
+		var delivery domain.QueuedDelivery
+		var data []byte
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event.ID, &delivery.Event.Type, &data, &delivery.Event.CreatedAt,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Event.Data = data
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *PostgresStorage) GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	query := `SELECT id, type, data, created_at FROM outbox ORDER BY seq ASC LIMIT $1`
+	rows, err := s.q.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*domain.Event, 0)
+	for rows.Next() {
+		var event domain.Event
+		var data []byte
+		if err := rows.Scan(&event.ID, &event.Type, &data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Data = data
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// LockRelay takes a session advisory lock on a dedicated connection, so that
+// only one of the server instances sharing the database relays the outbox.
+// It matches outbox.Lock.
+func (s *PostgresStorage) LockRelay(ctx context.Context) (release func(), ok bool, err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxRelayLock).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, outboxRelayLock); err != nil {
+			// Соединение с неснятой блокировкой нельзя возвращать в пул
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+func (s *PostgresStorage) AckEvents(ctx context.Context, ids []string) error {
+	s.wrote(ctx)
+	_, err := s.q.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+func (s *PostgresStorage) RestoreUser(ctx context.Context, user *domain.User) error {
+	s.wrote(ctx)
+	query := `INSERT INTO users (username, created_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, user.Username, user.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) RestorePost(ctx context.Context, post *domain.Post) error {
+	s.wrote(ctx)
+	query := `INSERT INTO posts (id, author, title, content, content_format, comments_enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, post.ID, post.Author, post.Title, post.Content, post.ContentFormat, post.CommentsEnabled, post.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	s.wrote(ctx)
+	return s.withTx(ctx, func(tx queryer) error {
+		query := `INSERT INTO comments (id, post_id, parent_id, author, content, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`
+		result, err := tx.ExecContext(ctx, query, comment.ID, comment.PostID, comment.ParentID, comment.Author, comment.Content, comment.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		query = `INSERT INTO comment_mentions (comment_id, username) SELECT $1, UNNEST($2::text[])`
+		_, err = tx.ExecContext(ctx, query, comment.ID, pq.Array(comment.Mentions))
+		return err
+	})
+}
+
+func (s *PostgresStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) error {
+	s.wrote(ctx)
+	query := `INSERT INTO notifications (id, recipient, type, post_id, comment_id, actor, read, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, notification.ID, notification.Recipient, notification.Type, notification.PostID,
+		notification.CommentID, notification.Actor, notification.Read, notification.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	s.wrote(ctx)
+	query := `INSERT INTO webhooks (id, url, secret, event_types, active, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, webhook.ID, webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes), webhook.Active, webhook.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	s.wrote(ctx)
+	query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.Success, delivery.Duration.Milliseconds(), delivery.CreatedAt)
+	return err
+}
+
+func (s *PostgresStorage) RestoreEvent(ctx context.Context, event *domain.Event) error {
+	s.wrote(ctx)
+	return s.withTx(ctx, func(tx queryer) error {
+		// Как и insertEvent, упорядочиваем фиксацию с другими записями outbox
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxWriteLock); err != nil {
+			return err
+		}
+		query := `INSERT INTO outbox (id, type, data, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+		_, err := tx.ExecContext(ctx, query, event.ID, event.Type, []byte(event.Data), event.CreatedAt)
+		return err
+	})
+}
+
+func (s *PostgresStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error {
+	s.wrote(ctx)
+	query := `INSERT INTO webhook_queue (` + queuedColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, delivery.ID, delivery.WebhookID, delivery.Event.ID, delivery.Event.Type, []byte(delivery.Event.Data),
+		delivery.Event.CreatedAt, delivery.Attempts, delivery.NextAttemptAt, delivery.CreatedAt)
+	return err
 }
 
 var _ storage.Storage = (*PostgresStorage)(nil)
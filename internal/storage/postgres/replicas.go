@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"ArticleForum/internal/storage"
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultStickyWindow is how long a client reads from the primary after
+	// its own write when Options.StickyWindow is zero.
+	DefaultStickyWindow = 5 * time.Second
+	// DefaultHealthCheckInterval is how often replicas are pinged when
+	// Options.HealthCheckInterval is zero.
+	DefaultHealthCheckInterval = 5 * time.Second
+)
+
+type Options struct {
+	// ReplicaDSNs lists read replicas. GetPost, GetAllPosts, GetPosts,
+	// GetComment and GetComments outside a unit of work and without
+	// storage.WithPrimary are spread across the healthy replicas; everything
+	// else goes to the primary.
+	ReplicaDSNs []string
+	// StickyWindow is how long reads of a client, identified by
+	// storage.WithSession, go to the primary after the client's own write,
+	// so that it sees its changes despite replication lag.
+	StickyWindow time.Duration
+	// HealthCheckInterval is how often replicas are pinged. A replica that
+	// fails a ping or a query is skipped until it answers a ping again.
+	HealthCheckInterval time.Duration
+}
+
+type replica struct {
+	dsn     string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// markDown takes the replica out of rotation until the next successful ping.
+func (r *replica) markDown(err error) {
+	if r.healthy.Swap(false) {
+		log.Printf("postgres: replica %s is unavailable, reading from primary: %v", redactDSN(r.dsn), err)
+	}
+}
+
+// replicaSet routes reads between replicas and tracks recent writes of
+// client sessions.
+type replicaSet struct {
+	replicas     []*replica
+	next         atomic.Uint32
+	stickyWindow time.Duration
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func openReplicas(options Options) (*replicaSet, error) {
+	set := &replicaSet{
+		stickyWindow: options.StickyWindow,
+		writes:       make(map[string]time.Time),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if set.stickyWindow == 0 {
+		set.stickyWindow = DefaultStickyWindow
+	}
+
+	for _, dsn := range options.ReplicaDSNs {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			for _, r := range set.replicas {
+				r.db.Close()
+			}
+			return nil, err
+		}
+		r := &replica{dsn: dsn, db: db}
+		// Недоступная при запуске реплика не мешает старту, она вернётся в
+		// ротацию после успешной проверки
+		if err := db.Ping(); err != nil {
+			log.Printf("postgres: replica %s is unavailable, reading from primary: %v", redactDSN(dsn), err)
+		} else {
+			r.healthy.Store(true)
+		}
+		set.replicas = append(set.replicas, r)
+	}
+
+	interval := options.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	go set.run(interval)
+	return set, nil
+}
+
+// pick returns the replica to serve a read in ctx, or nil when the read
+// must go to the primary.
+func (rs *replicaSet) pick(ctx context.Context) *replica {
+	if storage.ReadsPrimary(ctx) {
+		return nil
+	}
+	if session, ok := storage.SessionFromContext(ctx); ok {
+		rs.mu.Lock()
+		wrote, found := rs.writes[session]
+		rs.mu.Unlock()
+		if found && time.Since(wrote) < rs.stickyWindow {
+			return nil
+		}
+	}
+
+	start := rs.next.Add(1)
+	for i := range rs.replicas {
+		r := rs.replicas[(int(start)+i)%len(rs.replicas)]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// wrote records a write of the client session in ctx.
+func (rs *replicaSet) wrote(ctx context.Context) {
+	if session, ok := storage.SessionFromContext(ctx); ok {
+		rs.mu.Lock()
+		rs.writes[session] = time.Now()
+		rs.mu.Unlock()
+	}
+}
+
+func (rs *replicaSet) run(interval time.Duration) {
+	defer close(rs.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			rs.checkHealth(interval)
+			rs.forgetWrites()
+		}
+	}
+}
+
+func (rs *replicaSet) checkHealth(timeout time.Duration) {
+	for _, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		if err != nil {
+			r.markDown(err)
+		} else if !r.healthy.Swap(true) {
+			log.Printf("postgres: replica %s is available again", redactDSN(r.dsn))
+		}
+	}
+}
+
+// forgetWrites drops sessions whose sticky window has passed.
+func (rs *replicaSet) forgetWrites() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for session, wrote := range rs.writes {
+		if time.Since(wrote) >= rs.stickyWindow {
+			delete(rs.writes, session)
+		}
+	}
+}
+
+func (rs *replicaSet) close() error {
+	close(rs.stop)
+	<-rs.done
+
+	var firstErr error
+	for _, r := range rs.replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// read runs fn against a replica chosen for ctx, or against the primary
+// inside a unit of work, for sticky sessions and when no replica is
+// healthy. A read that fails on a replica is retried on the primary.
+func (s *PostgresStorage) read(ctx context.Context, fn func(q queryer) error) error {
+	if s.replicas == nil || s.tx != nil {
+		return fn(s.q)
+	}
+	r := s.replicas.pick(ctx)
+	if r == nil {
+		return fn(s.q)
+	}
+
+	err := fn(traced(r.db, "replica"))
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	r.markDown(err)
+	return fn(s.q)
+}
+
+// wrote makes the reads of the client in ctx go to the primary for the
+// sticky window. Writes call it before executing, so a read racing with an
+// unfinished write already avoids replicas.
+func (s *PostgresStorage) wrote(ctx context.Context) {
+	if s.replicas != nil {
+		s.replicas.wrote(ctx)
+	}
+}
+
+var dsnPassword = regexp.MustCompile(`password=\S+`)
+
+// redactDSN hides the password in a DSN for logging.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			}
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password=xxxxx")
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedQueryer creates a span for every SQL statement. The span covers the
+// execution of the statement, not the reading of the returned rows.
+type tracedQueryer struct {
+	q    queryer
+	role attribute.KeyValue
+}
+
+// traced wraps q so that its statements are traced, with role telling the
+// primary from replicas.
+func traced(q queryer, role string) queryer {
+	return &tracedQueryer{q: q, role: attribute.String("db.role", role)}
+}
+
+// start creates a child span of the span in ctx; statements run outside a
+// trace are not traced.
+func (t *tracedQueryer) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	if parent := trace.SpanFromContext(ctx); !parent.SpanContext().IsValid() {
+		return ctx, parent
+	}
+	return otel.Tracer("ArticleForum/internal/storage/postgres").Start(ctx, "postgres.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", query),
+			t.role,
+		))
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.q.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (t *tracedQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (t *tracedQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.q.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
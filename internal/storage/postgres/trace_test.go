@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	_ "modernc.org/sqlite"
+)
+
+func TestTracedQueryer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	// Обёртка не зависит от драйвера, поэтому для теста хватает SQLite
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	q := traced(db, "replica")
+	_, err = q.ExecContext(ctx, `SELECT 1`)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Ended(), "statements outside a trace are not traced")
+
+	ctx, parent := otel.Tracer("test").Start(ctx, "parent")
+	defer parent.End()
+	_, err = q.ExecContext(ctx, `CREATE TABLE t (id INTEGER)`)
+	require.NoError(t, err)
+	var id int
+	assert.ErrorIs(t, q.QueryRowContext(ctx, `SELECT id FROM t`).Scan(&id), sql.ErrNoRows)
+	_, err = q.QueryContext(ctx, `SELECT missing FROM t`)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, "postgres.query", span.Name())
+	}
+	assert.Contains(t, spans[0].Attributes(), traced(nil, "replica").(*tracedQueryer).role)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code, "no rows is not an error")
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
@@ -0,0 +1,32 @@
+package storage
+
+import "context"
+
+type sessionKey struct{}
+type primaryKey struct{}
+
+// WithSession marks ctx as belonging to the client with the given session
+// ID. Backends that serve reads from replicas use it to send a client's
+// reads to the primary shortly after the client's own writes.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionFromContext returns the session ID set with WithSession, if any.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithPrimary makes reads in ctx see every committed write: backends that
+// serve reads from replicas send them to the primary. The cache uses it to
+// reload entries it has just invalidated.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// ReadsPrimary reports whether ctx was marked with WithPrimary.
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
@@ -0,0 +1,852 @@
+package sqlite
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/pkg/migrations"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// timeLayout has a fixed width so that timestamps stored as text sort in
+// chronological order.
+const timeLayout = "2006-01-02 15:04:05.000000000-07:00"
+
+type SQLiteStorage struct {
+	db *sql.DB
+	// q is db, or tx inside a unit of work started with WithinTx.
+	q  queryer
+	tx *sql.Tx
+}
+
+// OpenDB opens the database file at path, creating it if needed. Use
+// ":memory:" for a throwaway database.
+func OpenDB(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя, а база в памяти существует только
+	// в рамках соединения, поэтому все запросы идут через одно соединение
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewSQLiteStorage opens the database at path. Pending migrations are applied
+// when migrate is set; otherwise the schema must already be up to date.
+func NewSQLiteStorage(path string, migrate bool) (*SQLiteStorage, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if migrate {
+		err = migrations.Up(ctx, db, migrations.SQLite)
+	} else {
+		err = migrations.CheckVersion(ctx, db, migrations.SQLite)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStorage{db: db, q: db}, nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// Pools returns the connection pool by name, for monitoring.
+func (s *SQLiteStorage) Pools() map[string]*sql.DB {
+	return map[string]*sql.DB{"sqlite": s.db}
+}
+
+// HealthCheck pings the database and checks its schema version.
+func (s *SQLiteStorage) HealthCheck(ctx context.Context) error {
+	if s.tx != nil {
+		// Единственное соединение занято транзакцией, и раз она открыта,
+		// база доступна
+		return nil
+	}
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+	return migrations.CheckVersion(ctx, s.db, migrations.SQLite)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithinTx runs fn in a transaction. Nested calls join the outer transaction.
+func (s *SQLiteStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SQLiteStorage{db: s.db, q: tx, tx: tx})
+	})
+}
+
+// withTx runs fn in a transaction that is committed when fn succeeds. Inside
+// a unit of work fn runs in the surrounding transaction. With a single
+// connection fn must use tx only, never s.db.
+func (s *SQLiteStorage) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// timestamp stores t as fixed-width UTC text, see timeLayout.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// stringList stores a list of strings as a JSON array, which SQLite can also
+// expand with json_each in place of Postgres arrays.
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		l = stringList{}
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+func (l *stringList) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*l = stringList{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// insertEvent writes an event into the outbox as part of the caller's
+// transaction, so it is published if and only if the change is committed.
+func insertEvent(ctx context.Context, q queryer, eventType domain.EventType, data any) error {
+	event, err := storage.NewEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox (id, type, data, created_at) VALUES (?, ?, ?, ?)`
+	_, err = q.ExecContext(ctx, query, event.ID, event.Type, string(event.Data), timestamp(event.CreatedAt))
+	return err
+}
+
+const postColumns = `id, author, title, content, content_format, comments_enabled, created_at`
+
+func scanPost(row interface{ Scan(...any) error }) (*domain.Post, error) {
+	var post domain.Post
+	if err := row.Scan(&post.ID, &post.Author, &post.Title, &post.Content, &post.ContentFormat, &post.CommentsEnabled, &post.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (s *SQLiteStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error) {
+	post := &domain.Post{
+		ID:              uuid.New().String(),
+		Author:          author,
+		Title:           title,
+		Content:         content,
+		ContentFormat:   format,
+		CommentsEnabled: commentsEnabled,
+		CreatedAt:       time.Now(),
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO posts (` + postColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, query, post.ID, author, title, content, format, commentsEnabled, timestamp(post.CreatedAt)); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventPostCreated, post)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *SQLiteStorage) GetPost(ctx context.Context, id string) (*domain.Post, error) {
+	return getPost(ctx, s.q, id)
+}
+
+func getPost(ctx context.Context, q queryer, id string) (*domain.Post, error) {
+	post, err := scanPost(q.QueryRowContext(ctx, `SELECT `+postColumns+` FROM posts WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return post, err
+}
+
+func (s *SQLiteStorage) GetAllPosts(ctx context.Context) ([]*domain.Post, error) {
+	return s.queryPosts(ctx, `SELECT `+postColumns+` FROM posts ORDER BY created_at DESC, id DESC`)
+}
+
+func (s *SQLiteStorage) GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error) {
+	limit, offset = storage.Page(limit, offset)
+	return s.queryPosts(ctx, `SELECT `+postColumns+` FROM posts ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, limit, offset)
+}
+
+func (s *SQLiteStorage) queryPosts(ctx context.Context, query string, args ...any) ([]*domain.Post, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*domain.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *SQLiteStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error) {
+	var post *domain.Post
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		query := `UPDATE posts SET comments_enabled = ? WHERE id = ? RETURNING ` + postColumns
+		updated, err := scanPost(tx.QueryRowContext(ctx, query, enabled, postID))
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		post = updated
+		return insertEvent(ctx, tx, domain.EventPostUpdated, post)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *SQLiteStorage) DeletePost(ctx context.Context, id string) (bool, error) {
+	// Комментарии и уведомления удаляются каскадно
+	result, err := s.q.ExecContext(ctx, `DELETE FROM posts WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *SQLiteStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error) {
+	var comment *domain.Comment
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Проверяем, существует ли пост и разрешены ли комментарии
+		post, err := getPost(ctx, tx, postID)
+		if err != nil || post == nil || !post.CommentsEnabled {
+			return err
+		}
+		if parentID != nil {
+			parent, err := getComment(ctx, tx, *parentID)
+			if err != nil || parent == nil || parent.PostID != postID {
+				return err
+			}
+		}
+
+		comment = &domain.Comment{
+			ID:        uuid.New().String(),
+			PostID:    postID,
+			ParentID:  parentID,
+			Author:    author,
+			Content:   content,
+			Mentions:  []string{},
+			CreatedAt: time.Now(),
+		}
+		query := `INSERT INTO comments (id, post_id, parent_id, author, content, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, query, comment.ID, postID, parentID, author, content, timestamp(comment.CreatedAt)); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventCommentCreated, comment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// commentColumns selects a comment together with the users it mentions.
+const commentColumns = `id, post_id, parent_id, author, content, created_at,
+	(SELECT json_group_array(username) FROM (SELECT username FROM comment_mentions WHERE comment_id = comments.id ORDER BY username))`
+
+func scanComment(row interface{ Scan(...any) error }) (*domain.Comment, error) {
+	var comment domain.Comment
+	var parentID sql.NullString
+	var mentions stringList
+	if err := row.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Content, &comment.CreatedAt, &mentions); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		comment.ParentID = &parentID.String
+	}
+	comment.Mentions = mentions
+	return &comment, nil
+}
+
+func (s *SQLiteStorage) GetComment(ctx context.Context, id string) (*domain.Comment, error) {
+	return getComment(ctx, s.q, id)
+}
+
+func getComment(ctx context.Context, q queryer, id string) (*domain.Comment, error) {
+	comment, err := scanComment(q.QueryRowContext(ctx, `SELECT `+commentColumns+` FROM comments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return comment, err
+}
+
+func (s *SQLiteStorage) GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error) {
+	limit, offset = storage.Page(limit, offset)
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE post_id = ? ORDER BY created_at ASC, id ASC LIMIT ? OFFSET ?`
+	rows, err := s.q.QueryContext(ctx, query, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*domain.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func (s *SQLiteStorage) UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error) {
+	var comment *domain.Comment
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE comments SET content = ? WHERE id = ?`, content, id)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		if comment, err = getComment(ctx, tx, id); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, domain.EventCommentUpdated, comment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *SQLiteStorage) DeleteCommentThread(ctx context.Context, id string) (int, error) {
+	var removed int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// SQLite не учитывает каскадно удалённые строки, поэтому ветка
+		// считается заранее, а ответы удаляются каскадно вместе с корнем
+		query := `WITH RECURSIVE thread AS (
+				SELECT id FROM comments WHERE id = ?
+				UNION ALL
+				SELECT comments.id FROM comments JOIN thread ON comments.parent_id = thread.id
+			)
+			SELECT COUNT(*) FROM thread`
+		if err := tx.QueryRowContext(ctx, query, id).Scan(&removed); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+func (s *SQLiteStorage) SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	added := make([]string, 0)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT username FROM comment_mentions WHERE comment_id = ?`, commentID)
+		if err != nil {
+			return err
+		}
+		var stale []string
+		for rows.Next() {
+			var username string
+			if err := rows.Scan(&username); err != nil {
+				rows.Close()
+				return err
+			}
+			if !slices.Contains(usernames, username) {
+				stale = append(stale, username)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, username := range stale {
+			query := `DELETE FROM comment_mentions WHERE comment_id = ? AND username = ?`
+			if _, err := tx.ExecContext(ctx, query, commentID, username); err != nil {
+				return err
+			}
+		}
+
+		for _, username := range usernames {
+			query := `INSERT INTO comment_mentions (comment_id, username) VALUES (?, ?) ON CONFLICT DO NOTHING`
+			result, err := tx.ExecContext(ctx, query, commentID, username)
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if affected > 0 {
+				added = append(added, username)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (s *SQLiteStorage) EnsureUser(ctx context.Context, username string) (*domain.User, error) {
+	query := `INSERT INTO users (username, created_at) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET username = excluded.username
+		RETURNING username, created_at`
+	var user domain.User
+	if err := s.q.QueryRowContext(ctx, query, username, timestamp(time.Now())).Scan(&user.Username, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *SQLiteStorage) GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error) {
+	query := `SELECT username, created_at FROM users WHERE username IN (SELECT value FROM json_each(?))`
+	rows, err := s.q.QueryContext(ctx, query, stringList(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0, len(usernames))
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteStorage) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT username, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0)
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error) {
+	created := *notification
+	created.ID = uuid.New().String()
+	created.Read = false
+	created.CreatedAt = time.Now()
+
+	query := `INSERT INTO notifications (id, recipient, type, post_id, comment_id, actor, read, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.q.ExecContext(ctx, query, created.ID, created.Recipient, created.Type, created.PostID, created.CommentID, created.Actor, created.Read, timestamp(created.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *SQLiteStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error) {
+	query := `SELECT id, recipient, type, post_id, comment_id, actor, read, created_at FROM notifications
+		WHERE recipient = ? AND (? = FALSE OR read = FALSE)`
+	args := []any{recipient, unreadOnly}
+	if after != "" {
+		query += ` AND (created_at, id) < (SELECT created_at, id FROM notifications WHERE id = ? AND recipient = ?)`
+		args = append(args, after, recipient)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]*domain.Notification, 0)
+	for rows.Next() {
+		var notification domain.Notification
+		if err := rows.Scan(&notification.ID, &notification.Recipient, &notification.Type, &notification.PostID,
+			&notification.CommentID, &notification.Actor, &notification.Read, &notification.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *SQLiteStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error) {
+	query := `SELECT DISTINCT recipient FROM notifications
+		WHERE recipient IN (SELECT value FROM json_each(?)) AND comment_id = ?`
+	rows, err := s.q.QueryContext(ctx, query, stringList(usernames), commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notified := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		notified = append(notified, username)
+	}
+	return notified, rows.Err()
+}
+
+func (s *SQLiteStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error) {
+	var result sql.Result
+	var err error
+	if len(ids) == 0 {
+		query := `UPDATE notifications SET read = TRUE WHERE recipient = ? AND read = FALSE`
+		result, err = s.q.ExecContext(ctx, query, recipient)
+	} else {
+		query := `UPDATE notifications SET read = TRUE WHERE recipient = ? AND read = FALSE AND id IN (SELECT value FROM json_each(?))`
+		result, err = s.q.ExecContext(ctx, query, recipient, stringList(ids))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+func (s *SQLiteStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error) {
+	webhook := &domain.Webhook{
+		ID:         uuid.New().String(),
+		URL:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+
+	types := make(stringList, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		types = append(types, string(eventType))
+	}
+
+	query := `INSERT INTO webhooks (id, url, secret, event_types, active, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.q.ExecContext(ctx, query, webhook.ID, webhook.URL, webhook.Secret, types, webhook.Active, timestamp(webhook.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *SQLiteStorage) GetWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	query := `SELECT id, url, secret, event_types, active, created_at FROM webhooks ORDER BY created_at ASC`
+	rows, err := s.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*domain.Webhook, 0)
+	for rows.Next() {
+		var webhook domain.Webhook
+		var eventTypes stringList
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &eventTypes, &webhook.Active, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, eventType := range eventTypes {
+			webhook.EventTypes = append(webhook.EventTypes, domain.EventType(eventType))
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *SQLiteStorage) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	result, err := s.q.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *SQLiteStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error) {
+	created := *delivery
+	created.ID = uuid.New().String()
+	created.CreatedAt = time.Now()
+
+	query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.q.ExecContext(ctx, query, created.ID, created.WebhookID, created.EventID, created.EventType, created.Attempt,
+		created.StatusCode, created.Error, created.Success, created.Duration.Milliseconds(), timestamp(created.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (s *SQLiteStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error) {
+	limit, offset = storage.Page(limit, offset)
+	query := `SELECT id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`
+	rows, err := s.q.QueryContext(ctx, query, webhookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery domain.WebhookDelivery
+		var durationMs int64
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.Success, &durationMs, &delivery.CreatedAt); err != nil {
+			return nil, err
+		}
+		delivery.Duration = time.Duration(durationMs) * time.Millisecond
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+const queuedColumns = `id, webhook_id, event_id, event_type, event_data, event_created_at, attempts, next_attempt_at, created_at`
+
+func (s *SQLiteStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error {
+	now := timestamp(time.Now())
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, webhookID := range webhookIDs {
+			query := `INSERT INTO webhook_queue (` + queuedColumns + `)
+				SELECT ?, ?, ?, ?, ?, ?, 0, ?, ? WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = ?)
+				ON CONFLICT DO NOTHING`
+			_, err := tx.ExecContext(ctx, query, uuid.New().String(), webhookID, event.ID, event.Type, string(event.Data),
+				timestamp(event.CreatedAt), now, now, webhookID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error) {
+	now := time.Now()
+	// Берётся только самая старая доставка каждого вебхука
+	query := `UPDATE webhook_queue SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE seq IN (
+			SELECT seq FROM webhook_queue q
+			WHERE seq = (SELECT MIN(seq) FROM webhook_queue WHERE webhook_id = q.webhook_id) AND next_attempt_at <= ?
+			ORDER BY seq LIMIT ?)
+		RETURNING ` + queuedColumns
+	return s.queryQueued(ctx, query, timestamp(now.Add(lease)), timestamp(now), limit)
+}
+
+func (s *SQLiteStorage) RetryDelivery(ctx context.Context, id string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE webhook_queue SET next_attempt_at = ? WHERE id = ?`, timestamp(at), id)
+	return err
+}
+
+func (s *SQLiteStorage) RemoveDelivery(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM webhook_queue WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStorage) GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error) {
+	return s.queryQueued(ctx, `SELECT `+queuedColumns+` FROM webhook_queue ORDER BY seq ASC LIMIT ?`, limit)
+}
+
+func (s *SQLiteStorage) queryQueued(ctx context.Context, query string, args ...any) ([]*domain.QueuedDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*domain.QueuedDelivery, 0)
+	for rows.Next() {
+		var delivery domain.QueuedDelivery
+		var data string
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event.ID, &delivery.Event.Type, &data, &delivery.Event.CreatedAt,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Event.Data = json.RawMessage(data)
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLiteStorage) GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error) {
+	rows, err := s.q.QueryContext(ctx, `SELECT id, type, data, created_at FROM outbox ORDER BY seq ASC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*domain.Event, 0)
+	for rows.Next() {
+		var event domain.Event
+		var data string
+		if err := rows.Scan(&event.ID, &event.Type, &data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Data = json.RawMessage(data)
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLiteStorage) AckEvents(ctx context.Context, ids []string) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM outbox WHERE id IN (SELECT value FROM json_each(?))`, stringList(ids))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreUser(ctx context.Context, user *domain.User) error {
+	query := `INSERT INTO users (username, created_at) VALUES (?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, user.Username, timestamp(user.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestorePost(ctx context.Context, post *domain.Post) error {
+	query := `INSERT INTO posts (` + postColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, post.ID, post.Author, post.Title, post.Content, post.ContentFormat, post.CommentsEnabled, timestamp(post.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreComment(ctx context.Context, comment *domain.Comment) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO comments (id, post_id, parent_id, author, content, created_at)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+		result, err := tx.ExecContext(ctx, query, comment.ID, comment.PostID, comment.ParentID, comment.Author, comment.Content, timestamp(comment.CreatedAt))
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		query = `INSERT INTO comment_mentions (comment_id, username) SELECT ?, value FROM json_each(?)`
+		_, err = tx.ExecContext(ctx, query, comment.ID, stringList(comment.Mentions))
+		return err
+	})
+}
+
+func (s *SQLiteStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) error {
+	query := `INSERT INTO notifications (id, recipient, type, post_id, comment_id, actor, read, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, notification.ID, notification.Recipient, notification.Type, notification.PostID,
+		notification.CommentID, notification.Actor, notification.Read, timestamp(notification.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	types := make(stringList, 0, len(webhook.EventTypes))
+	for _, eventType := range webhook.EventTypes {
+		types = append(types, string(eventType))
+	}
+
+	query := `INSERT INTO webhooks (id, url, secret, event_types, active, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, webhook.ID, webhook.URL, webhook.Secret, types, webhook.Active, timestamp(webhook.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.Success, delivery.Duration.Milliseconds(), timestamp(delivery.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreEvent(ctx context.Context, event *domain.Event) error {
+	query := `INSERT INTO outbox (id, type, data, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, event.ID, event.Type, string(event.Data), timestamp(event.CreatedAt))
+	return err
+}
+
+func (s *SQLiteStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error {
+	query := `INSERT INTO webhook_queue (` + queuedColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	_, err := s.q.ExecContext(ctx, query, delivery.ID, delivery.WebhookID, delivery.Event.ID, delivery.Event.Type, string(delivery.Event.Data),
+		timestamp(delivery.Event.CreatedAt), delivery.Attempts, timestamp(delivery.NextAttemptAt), timestamp(delivery.CreatedAt))
+	return err
+}
+
+var _ storage.Storage = (*SQLiteStorage)(nil)
@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/storagetest"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T, path string) *SQLiteStorage {
+	t.Helper()
+	storage, err := NewSQLiteStorage(path, true)
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forum.db")
+	storage := newTestStorage(t, path)
+	ctx := context.Background()
+
+	t.Run("Create and get post", func(t *testing.T) {
+		post, err := storage.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatMarkdown, true)
+		require.NoError(t, err)
+
+		retrievedPost, err := storage.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.NotNil(t, retrievedPost)
+		assert.Equal(t, "alice", retrievedPost.Author)
+		assert.Equal(t, domain.ContentFormatMarkdown, retrievedPost.ContentFormat)
+		assert.True(t, retrievedPost.CreatedAt.Equal(post.CreatedAt))
+
+		missing, err := storage.GetPost(ctx, "missing")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("Comments and mentions", func(t *testing.T) {
+		post, err := storage.CreatePost(ctx, "alice", "For Comment", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+
+		comment, err := storage.CreateComment(ctx, post.ID, nil, "bob", "Hi @alice")
+		require.NoError(t, err)
+		require.NotNil(t, comment)
+		reply, err := storage.CreateComment(ctx, post.ID, &comment.ID, "alice", "Hi")
+		require.NoError(t, err)
+		require.NotNil(t, reply)
+
+		_, err = storage.EnsureUser(ctx, "alice")
+		require.NoError(t, err)
+		added, err := storage.SetMentions(ctx, comment.ID, []string{"alice"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, added)
+		added, err = storage.SetMentions(ctx, comment.ID, []string{"alice"})
+		require.NoError(t, err)
+		assert.Empty(t, added)
+
+		comments, err := storage.GetComments(ctx, post.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, comments, 2)
+		assert.Equal(t, []string{"alice"}, comments[0].Mentions)
+		assert.Equal(t, comment.ID, *comments[1].ParentID)
+
+		disabled, err := storage.CreatePost(ctx, "", "No Comments", "Content", domain.ContentFormatPlain, false)
+		require.NoError(t, err)
+		rejected, err := storage.CreateComment(ctx, disabled.ID, nil, "", "Should not work")
+		require.NoError(t, err)
+		assert.Nil(t, rejected)
+	})
+
+	t.Run("Notifications pagination", func(t *testing.T) {
+		post, err := storage.CreatePost(ctx, "", "Notified", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+		comment, err := storage.CreateComment(ctx, post.ID, nil, "bob", "Comment")
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err := storage.CreateNotification(ctx, &domain.Notification{
+				Recipient: "carol", Type: domain.NotificationTypePostComment, PostID: post.ID, CommentID: comment.ID, Actor: "bob",
+			})
+			require.NoError(t, err)
+		}
+
+		first, err := storage.GetNotifications(ctx, "carol", false, 2, "")
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+		rest, err := storage.GetNotifications(ctx, "carol", false, 2, first[1].ID)
+		require.NoError(t, err)
+		assert.Len(t, rest, 1)
+
+		marked, err := storage.MarkNotificationsRead(ctx, "carol", []string{first[0].ID})
+		require.NoError(t, err)
+		assert.Equal(t, 1, marked)
+		unread, err := storage.GetNotifications(ctx, "carol", true, 10, "")
+		require.NoError(t, err)
+		assert.Len(t, unread, 2)
+	})
+
+	t.Run("Webhooks and outbox", func(t *testing.T) {
+		webhook, err := storage.CreateWebhook(ctx, "https://example.com", "secret", []domain.EventType{domain.EventPostCreated})
+		require.NoError(t, err)
+		webhooks, err := storage.GetWebhooks(ctx)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		assert.Equal(t, []domain.EventType{domain.EventPostCreated}, webhooks[0].EventTypes)
+
+		events, err := storage.GetPendingEvents(ctx, 100)
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, domain.EventPostCreated, events[0].Type)
+		require.NoError(t, storage.AckEvents(ctx, []string{events[0].ID}))
+		remaining, err := storage.GetPendingEvents(ctx, 100)
+		require.NoError(t, err)
+		assert.Len(t, remaining, len(events)-1)
+
+		deleted, err := storage.DeleteWebhook(ctx, webhook.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+	})
+
+	t.Run("Data survives reopening", func(t *testing.T) {
+		post, err := storage.CreatePost(ctx, "", "Persistent", "Content", domain.ContentFormatPlain, true)
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		reopened := newTestStorage(t, path)
+		retrievedPost, err := reopened.GetPost(ctx, post.ID)
+		require.NoError(t, err)
+		require.NotNil(t, retrievedPost)
+		assert.Equal(t, "Persistent", retrievedPost.Title)
+	})
+}
+
+func TestSQLiteStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStorage(t, filepath.Join(t.TempDir(), "forum.db"))
+	})
+}
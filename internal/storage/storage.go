@@ -3,12 +3,117 @@ package storage
 import (
 	"ArticleForum/internal/domain"
 	"context"
+	"time"
 )
 
 type Storage interface {
-	CreatePost(ctx context.Context, title, content string, commentsEnabled bool) (*domain.Post, error)
+	CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (*domain.Post, error)
 	GetPost(ctx context.Context, id string) (*domain.Post, error)
+	// GetAllPosts returns posts newest first.
 	GetAllPosts(ctx context.Context) ([]*domain.Post, error)
-	CreateComment(ctx context.Context, postID string, parentID *string, content string) (*domain.Comment, error)
+	// GetPosts returns a page of posts newest first. Negative limits and
+	// offsets are treated as zero, see Page.
+	GetPosts(ctx context.Context, limit, offset int) ([]*domain.Post, error)
+	// SetCommentsEnabled locks or unlocks a post for new comments. It returns
+	// nil when the post does not exist.
+	SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*domain.Post, error)
+	// DeletePost removes the post with its comments and notifications.
+	DeletePost(ctx context.Context, id string) (bool, error)
+	// CreateComment returns nil without an error when the post does not
+	// exist, has comments disabled, or parentID is not a comment of the
+	// same post.
+	CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (*domain.Comment, error)
+	GetComment(ctx context.Context, id string) (*domain.Comment, error)
+	// GetComments returns a page of the post's comments oldest first, with
+	// negative bounds treated as zero.
 	GetComments(ctx context.Context, postID string, limit, offset int) ([]*domain.Comment, error)
+	UpdateComment(ctx context.Context, id, content string) (*domain.Comment, error)
+	// DeleteCommentThread removes the comment with all replies to it and
+	// returns how many comments were removed.
+	DeleteCommentThread(ctx context.Context, id string) (int, error)
+	// SetMentions replaces the users mentioned in a comment and returns the
+	// ones that were not mentioned in it before.
+	SetMentions(ctx context.Context, commentID string, usernames []string) ([]string, error)
+
+	// EnsureUser registers the user on first sight and returns it.
+	EnsureUser(ctx context.Context, username string) (*domain.User, error)
+	// GetUsers returns the users that exist among the given usernames.
+	GetUsers(ctx context.Context, usernames []string) ([]*domain.User, error)
+	// ListUsers returns all users ordered by username.
+	ListUsers(ctx context.Context) ([]*domain.User, error)
+
+	CreateNotification(ctx context.Context, notification *domain.Notification) (*domain.Notification, error)
+	// GetNotifications returns the recipient's notifications newest first,
+	// starting after the notification with the given ID when after is set.
+	GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) ([]*domain.Notification, error)
+	// GetNotifiedUsers returns those of the given users that have a
+	// notification about the comment.
+	GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) ([]string, error)
+	// MarkNotificationsRead marks the given notifications, or all of them when
+	// ids is empty, as read and returns how many were changed.
+	MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (int, error)
+
+	CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (*domain.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]*domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) (bool, error)
+	CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (*domain.WebhookDelivery, error)
+	// GetWebhookDeliveries returns the delivery log of a webhook newest first,
+	// with negative bounds treated as zero.
+	GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) ([]*domain.WebhookDelivery, error)
+
+	// EnqueueDeliveries queues the event for delivery to each of the
+	// webhooks. An event already queued for a webhook is not queued again.
+	EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) error
+	// ClaimDeliveries returns up to limit queued deliveries that are due, at
+	// most one per webhook: the oldest in its queue, so that every webhook
+	// receives its events in order. A claimed delivery counts an attempt and
+	// is not due again for lease, so that workers sharing the storage do not
+	// deliver it twice.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.QueuedDelivery, error)
+	// RetryDelivery makes a queued delivery due again at the given time.
+	RetryDelivery(ctx context.Context, id string, at time.Time) error
+	// RemoveDelivery takes a delivery off the queue once it has succeeded or
+	// used up its attempts.
+	RemoveDelivery(ctx context.Context, id string) error
+	// GetQueuedDeliveries returns up to limit queued deliveries in the order
+	// they were queued.
+	GetQueuedDeliveries(ctx context.Context, limit int) ([]*domain.QueuedDelivery, error)
+
+	// GetPendingEvents returns up to limit undispatched events from the
+	// outbox in the order they were written. CreatePost, CreateComment and
+	// UpdateComment write their events atomically with the change itself.
+	GetPendingEvents(ctx context.Context, limit int) ([]*domain.Event, error)
+	// AckEvents removes dispatched events from the outbox.
+	AckEvents(ctx context.Context, ids []string) error
+
+	// RestoreUser, RestorePost and RestoreComment store entities exactly as
+	// given, keeping their IDs, authors and timestamps, for importing data
+	// from another installation. They skip validation and write no events.
+	// An entity whose ID already exists is left unchanged. A comment's post,
+	// parent and mentioned users must be restored first.
+	RestoreUser(ctx context.Context, user *domain.User) error
+	RestorePost(ctx context.Context, post *domain.Post) error
+	RestoreComment(ctx context.Context, comment *domain.Comment) error
+	// RestoreNotification, RestoreWebhook, RestoreWebhookDelivery and
+	// RestoreEvent do the same for the rest of the data when it is copied
+	// between backends. A notification's post and comment and a delivery's
+	// webhook must be restored first. A restored event is pending and is
+	// dispatched after the events already in the outbox.
+	RestoreNotification(ctx context.Context, notification *domain.Notification) error
+	RestoreWebhook(ctx context.Context, webhook *domain.Webhook) error
+	RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+	RestoreEvent(ctx context.Context, event *domain.Event) error
+	// RestoreQueuedDelivery queues a copied delivery after the ones already
+	// queued. Its webhook must be restored first.
+	RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) error
+
+	// WithinTx runs fn as a unit of work: the changes fn makes through tx are
+	// committed together when it returns nil and discarded when it returns an
+	// error. Calling WithinTx on tx joins the same unit of work.
+	WithinTx(ctx context.Context, fn func(tx Storage) error) error
+
+	// HealthCheck reports whether the storage can serve requests: the
+	// database is reachable and its schema is at the version this build
+	// expects.
+	HealthCheck(ctx context.Context) error
 }
@@ -0,0 +1,976 @@
+// Package storagetest verifies that a storage.Storage implementation honours
+// the contract the rest of the application relies on. Every backend runs the
+// same suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			return NewMemoryStorage()
+//		})
+//	}
+package storagetest
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty storage for a single subtest. It may register
+// cleanup with t.Cleanup.
+type Factory func(t *testing.T) storage.Storage
+
+// Run runs the whole suite, calling newStorage once per subtest.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"Posts", testPosts},
+		{"PostOrdering", testPostOrdering},
+		{"PostPagination", testPostPagination},
+		{"LockPost", testLockPost},
+		{"DeletePost", testDeletePost},
+		{"Comments", testComments},
+		{"CommentPagination", testCommentPagination},
+		{"DisabledComments", testDisabledComments},
+		{"ParentRules", testParentRules},
+		{"UpdateComment", testUpdateComment},
+		{"DeleteCommentThread", testDeleteCommentThread},
+		{"Mentions", testMentions},
+		{"Users", testUsers},
+		{"Notifications", testNotifications},
+		{"Webhooks", testWebhooks},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"WebhookQueue", testWebhookQueue},
+		{"Outbox", testOutbox},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"UnitOfWork", testUnitOfWork},
+		{"Restore", testRestore},
+		{"RestoreCopiedData", testRestoreCopiedData},
+		{"HealthCheck", testHealthCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+// Хранилища могут округлять время, например Postgres до микросекунд
+const timePrecision = time.Millisecond
+
+func createPost(t *testing.T, s storage.Storage, title string, commentsEnabled bool) *domain.Post {
+	t.Helper()
+	post, err := s.CreatePost(context.Background(), "alice", title, "Content", domain.ContentFormatPlain, commentsEnabled)
+	require.NoError(t, err)
+	require.NotNil(t, post)
+	return post
+}
+
+func createComment(t *testing.T, s storage.Storage, postID string, parentID *string, content string) *domain.Comment {
+	t.Helper()
+	comment, err := s.CreateComment(context.Background(), postID, parentID, "bob", content)
+	require.NoError(t, err)
+	require.NotNil(t, comment)
+	return comment
+}
+
+func commentIDs(comments []*domain.Comment) []string {
+	ids := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+func testPosts(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	post, err := s.CreatePost(ctx, "alice", "Title", "# Content", domain.ContentFormatMarkdown, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, post.ID)
+
+	stored, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, post.ID, stored.ID)
+	assert.Equal(t, "alice", stored.Author)
+	assert.Equal(t, "Title", stored.Title)
+	assert.Equal(t, "# Content", stored.Content)
+	assert.Equal(t, domain.ContentFormatMarkdown, stored.ContentFormat)
+	assert.True(t, stored.CommentsEnabled)
+	assert.WithinDuration(t, post.CreatedAt, stored.CreatedAt, timePrecision)
+
+	missing, err := s.GetPost(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func testPostOrdering(t *testing.T, s storage.Storage) {
+	posts, err := s.GetAllPosts(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	first := createPost(t, s, "First", true)
+	time.Sleep(2 * timePrecision)
+	second := createPost(t, s, "Second", false)
+
+	posts, err = s.GetAllPosts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, second.ID, posts[0].ID, "posts are returned newest first")
+	assert.Equal(t, first.ID, posts[1].ID)
+}
+
+func testPostPagination(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append([]string{createPost(t, s, fmt.Sprintf("Post %d", i), true).ID}, ids...)
+		time.Sleep(2 * timePrecision)
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{limit: 10, offset: 0, want: ids},
+		{limit: 3, offset: 0, want: ids[:3]},
+		{limit: 3, offset: 3, want: ids[3:]},
+		{limit: 3, offset: 5, want: nil},
+		{limit: 0, offset: 0, want: nil},
+		// Отрицательные границы считаются нулевыми
+		{limit: -1, offset: 0, want: nil},
+		{limit: 2, offset: -1, want: ids[:2]},
+		{limit: -1, offset: -1, want: nil},
+	}
+	for _, tt := range tests {
+		posts, err := s.GetPosts(ctx, tt.limit, tt.offset)
+		require.NoError(t, err)
+		if tt.want == nil {
+			assert.Empty(t, posts, "limit %d offset %d", tt.limit, tt.offset)
+			continue
+		}
+		got := make([]string, 0, len(posts))
+		for _, post := range posts {
+			got = append(got, post.ID)
+		}
+		assert.Equal(t, tt.want, got, "limit %d offset %d: posts are returned newest first", tt.limit, tt.offset)
+	}
+}
+
+func testLockPost(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+
+	locked, err := s.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+	require.NotNil(t, locked)
+	assert.False(t, locked.CommentsEnabled)
+	assert.Equal(t, "Post", locked.Title)
+
+	comment, err := s.CreateComment(ctx, post.ID, nil, "bob", "Locked out")
+	require.NoError(t, err)
+	assert.Nil(t, comment, "locked posts reject comments")
+
+	unlocked, err := s.SetCommentsEnabled(ctx, post.ID, true)
+	require.NoError(t, err)
+	assert.True(t, unlocked.CommentsEnabled)
+	createComment(t, s, post.ID, nil, "Welcome back")
+
+	missing, err := s.SetCommentsEnabled(ctx, "missing", false)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 4, "a missing post writes no event")
+	assert.Equal(t, domain.EventPostUpdated, events[1].Type)
+	assert.Equal(t, domain.EventPostUpdated, events[2].Type)
+	var updated domain.Post
+	require.NoError(t, json.Unmarshal(events[1].Data, &updated))
+	assert.Equal(t, post.ID, updated.ID)
+	assert.False(t, updated.CommentsEnabled)
+}
+
+func testDeletePost(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Doomed", true)
+	kept := createPost(t, s, "Kept", true)
+	comment := createComment(t, s, post.ID, nil, "Comment")
+	createComment(t, s, kept.ID, nil, "Comment")
+	_, err := s.CreateNotification(ctx, &domain.Notification{
+		Recipient: "alice", Type: domain.NotificationTypePostComment, PostID: post.ID, CommentID: comment.ID, Actor: "bob",
+	})
+	require.NoError(t, err)
+
+	deleted, err := s.DeletePost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	missing, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	orphan, err := s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Nil(t, orphan, "comments are deleted with the post")
+	notifications, err := s.GetNotifications(ctx, "alice", false, 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "notifications are deleted with the post")
+
+	comments, err := s.GetComments(ctx, kept.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+
+	deleted, err = s.DeletePost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func testComments(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+
+	comment := createComment(t, s, post.ID, nil, "Comment")
+	assert.NotEmpty(t, comment.ID)
+	assert.Equal(t, post.ID, comment.PostID)
+	assert.Nil(t, comment.ParentID)
+	assert.Equal(t, "bob", comment.Author)
+	assert.Empty(t, comment.Mentions)
+
+	stored, err := s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "Comment", stored.Content)
+	assert.Nil(t, stored.ParentID)
+	assert.WithinDuration(t, comment.CreatedAt, stored.CreatedAt, timePrecision)
+
+	missing, err := s.GetComment(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	onMissingPost, err := s.CreateComment(ctx, "missing", nil, "bob", "Comment")
+	require.NoError(t, err)
+	assert.Nil(t, onMissingPost)
+
+	other := createPost(t, s, "Other", true)
+	createComment(t, s, other.ID, nil, "Elsewhere")
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{comment.ID}, commentIDs(comments), "only comments of the post are returned")
+}
+
+func testCommentPagination(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, createComment(t, s, post.ID, nil, fmt.Sprintf("Comment %d", i)).ID)
+		time.Sleep(2 * timePrecision)
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{limit: 10, offset: 0, want: ids},
+		{limit: 3, offset: 0, want: ids[:3]},
+		{limit: 3, offset: 3, want: ids[3:]},
+		{limit: 5, offset: 4, want: ids[4:]},
+		{limit: 3, offset: 5, want: nil},
+		{limit: 3, offset: 100, want: nil},
+		{limit: 0, offset: 0, want: nil},
+		// Отрицательные границы считаются нулевыми
+		{limit: -1, offset: 0, want: nil},
+		{limit: 2, offset: -1, want: ids[:2]},
+		{limit: -1, offset: -1, want: nil},
+	}
+	for _, tt := range tests {
+		comments, err := s.GetComments(ctx, post.ID, tt.limit, tt.offset)
+		require.NoError(t, err)
+		if tt.want == nil {
+			assert.Empty(t, comments, "limit %d offset %d", tt.limit, tt.offset)
+			continue
+		}
+		assert.Equal(t, tt.want, commentIDs(comments), "limit %d offset %d: comments are returned oldest first", tt.limit, tt.offset)
+	}
+
+	empty, err := s.GetComments(ctx, createPost(t, s, "Empty", true).ID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testDisabledComments(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Closed", false)
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+
+	comment, err := s.CreateComment(ctx, post.ID, nil, "bob", "Should not work")
+	require.NoError(t, err)
+	assert.Nil(t, comment)
+
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+
+	after, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, after, len(events), "rejected comments do not produce events")
+}
+
+func testParentRules(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+	other := createPost(t, s, "Other", true)
+
+	parent := createComment(t, s, post.ID, nil, "Parent")
+	reply := createComment(t, s, post.ID, &parent.ID, "Reply")
+	require.NotNil(t, reply.ParentID)
+	assert.Equal(t, parent.ID, *reply.ParentID)
+
+	nested := createComment(t, s, post.ID, &reply.ID, "Nested reply")
+	stored, err := s.GetComment(ctx, nested.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.ParentID)
+	assert.Equal(t, reply.ID, *stored.ParentID)
+
+	missing := "missing"
+	comment, err := s.CreateComment(ctx, post.ID, &missing, "bob", "Orphan")
+	require.NoError(t, err)
+	assert.Nil(t, comment, "the parent must exist")
+
+	comment, err = s.CreateComment(ctx, other.ID, &parent.ID, "bob", "Cross-post reply")
+	require.NoError(t, err)
+	assert.Nil(t, comment, "the parent must belong to the same post")
+}
+
+func testUpdateComment(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+	comment := createComment(t, s, post.ID, nil, "Original")
+
+	updated, err := s.UpdateComment(ctx, comment.ID, "Edited")
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, comment.ID, updated.ID)
+	assert.Equal(t, "Edited", updated.Content)
+	assert.WithinDuration(t, comment.CreatedAt, updated.CreatedAt, timePrecision)
+
+	stored, err := s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", stored.Content)
+
+	missing, err := s.UpdateComment(ctx, "missing", "Edited")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func testDeleteCommentThread(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+
+	root := createComment(t, s, post.ID, nil, "Root")
+	reply := createComment(t, s, post.ID, &root.ID, "Reply")
+	createComment(t, s, post.ID, &reply.ID, "Nested reply")
+	createComment(t, s, post.ID, &root.ID, "Second reply")
+	sibling := createComment(t, s, post.ID, nil, "Sibling")
+	_, err := s.CreateNotification(ctx, &domain.Notification{
+		Recipient: "alice", Type: domain.NotificationTypeCommentReply, PostID: post.ID, CommentID: reply.ID, Actor: "bob",
+	})
+	require.NoError(t, err)
+
+	removed, err := s.DeleteCommentThread(ctx, reply.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "the comment is removed with its replies")
+
+	removed, err = s.DeleteCommentThread(ctx, root.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sibling.ID}, commentIDs(comments))
+
+	notifications, err := s.GetNotifications(ctx, "alice", false, 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "notifications about removed comments are deleted")
+
+	removed, err = s.DeleteCommentThread(ctx, "missing")
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func testMentions(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for _, username := range []string{"carol", "alice"} {
+		_, err := s.EnsureUser(ctx, username)
+		require.NoError(t, err)
+	}
+	post := createPost(t, s, "Post", true)
+	comment := createComment(t, s, post.ID, nil, "Hi @carol @alice")
+
+	added, err := s.SetMentions(ctx, comment.ID, []string{"carol", "alice"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"carol", "alice"}, added)
+
+	added, err = s.SetMentions(ctx, comment.ID, []string{"alice", "carol"})
+	require.NoError(t, err)
+	assert.Empty(t, added, "repeated mentions are not reported again")
+
+	stored, err := s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "carol"}, stored.Mentions, "mentions are sorted")
+
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, []string{"alice", "carol"}, comments[0].Mentions)
+
+	_, err = s.EnsureUser(ctx, "bob")
+	require.NoError(t, err)
+	added, err = s.SetMentions(ctx, comment.ID, []string{"bob", "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, added)
+	stored, err = s.GetComment(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, stored.Mentions, "users no longer mentioned are removed")
+
+	added, err = s.SetMentions(ctx, comment.ID, nil)
+	require.NoError(t, err)
+	assert.Empty(t, added)
+	comments, err = s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Empty(t, comments[0].Mentions)
+}
+
+func testUsers(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	user, err := s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	again, err := s.EnsureUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.WithinDuration(t, user.CreatedAt, again.CreatedAt, timePrecision, "existing users keep their registration time")
+
+	users, err := s.GetUsers(ctx, []string{"alice", "nobody"})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Username)
+
+	users, err = s.GetUsers(ctx, []string{})
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	_, err = s.EnsureUser(ctx, "aaron")
+	require.NoError(t, err)
+	users, err = s.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "aaron", users[0].Username, "users are listed by username")
+	assert.Equal(t, "alice", users[1].Username)
+}
+
+func testNotifications(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Post", true)
+	comment := createComment(t, s, post.ID, nil, "Comment")
+
+	notify := func(recipient string) *domain.Notification {
+		notification, err := s.CreateNotification(ctx, &domain.Notification{
+			Recipient: recipient,
+			Type:      domain.NotificationTypePostComment,
+			PostID:    post.ID,
+			CommentID: comment.ID,
+			Actor:     "bob",
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, notification.ID)
+		assert.False(t, notification.Read)
+		time.Sleep(2 * timePrecision)
+		return notification
+	}
+
+	var created []*domain.Notification
+	for i := 0; i < 3; i++ {
+		created = append(created, notify("alice"))
+	}
+	foreign := notify("carol")
+
+	page, err := s.GetNotifications(ctx, "alice", false, 2, "")
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, created[2].ID, page[0].ID, "notifications are returned newest first")
+	assert.Equal(t, created[1].ID, page[1].ID)
+	assert.Equal(t, domain.NotificationTypePostComment, page[0].Type)
+	assert.Equal(t, "bob", page[0].Actor)
+
+	rest, err := s.GetNotifications(ctx, "alice", false, 2, page[1].ID)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, created[0].ID, rest[0].ID)
+
+	end, err := s.GetNotifications(ctx, "alice", false, 2, rest[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, end)
+
+	foreignCursor, err := s.GetNotifications(ctx, "alice", false, 2, foreign.ID)
+	require.NoError(t, err)
+	assert.Empty(t, foreignCursor, "another recipient's notification is not a valid cursor")
+
+	marked, err := s.MarkNotificationsRead(ctx, "alice", []string{created[0].ID, foreign.ID})
+	require.NoError(t, err)
+	assert.Equal(t, 1, marked, "only the recipient's own notifications are marked")
+
+	unread, err := s.GetNotifications(ctx, "alice", true, 10, "")
+	require.NoError(t, err)
+	assert.Len(t, unread, 2)
+
+	marked, err = s.MarkNotificationsRead(ctx, "alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, marked)
+
+	marked, err = s.MarkNotificationsRead(ctx, "alice", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, marked, "already read notifications are not counted")
+
+	carol, err := s.GetNotifications(ctx, "carol", true, 10, "")
+	require.NoError(t, err)
+	assert.Len(t, carol, 1)
+
+	notified, err := s.GetNotifiedUsers(ctx, comment.ID, []string{"alice", "dave"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, notified, "each user is listed once")
+	other := createComment(t, s, post.ID, nil, "Other")
+	notified, err = s.GetNotifiedUsers(ctx, other.ID, []string{"alice", "carol"})
+	require.NoError(t, err)
+	assert.Empty(t, notified)
+}
+
+func testWebhooks(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	first, err := s.CreateWebhook(ctx, "https://example.com/first", "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+	assert.True(t, first.Active)
+	time.Sleep(2 * timePrecision)
+	second, err := s.CreateWebhook(ctx, "https://example.com/second", "secret", []domain.EventType{domain.EventCommentCreated, domain.EventCommentUpdated})
+	require.NoError(t, err)
+
+	webhooks, err := s.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, first.ID, webhooks[0].ID, "webhooks are returned oldest first")
+	assert.Equal(t, "secret", webhooks[0].Secret)
+	assert.Equal(t, []domain.EventType{domain.EventCommentCreated, domain.EventCommentUpdated}, webhooks[1].EventTypes)
+
+	deleted, err := s.DeleteWebhook(ctx, second.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = s.DeleteWebhook(ctx, second.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	webhooks, err = s.GetWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Len(t, webhooks, 1)
+}
+
+func testWebhookDeliveries(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	webhook, err := s.CreateWebhook(ctx, "https://example.com", "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	var ids []string
+	for attempt := 1; attempt <= 3; attempt++ {
+		delivery, err := s.CreateWebhookDelivery(ctx, &domain.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			EventID:    "event",
+			EventType:  domain.EventPostCreated,
+			Attempt:    attempt,
+			StatusCode: 500,
+			Error:      "server error",
+			Duration:   25 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, delivery.ID)
+		ids = append(ids, delivery.ID)
+		time.Sleep(2 * timePrecision)
+	}
+
+	deliveries, err := s.GetWebhookDeliveries(ctx, webhook.ID, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, ids[2], deliveries[0].ID, "deliveries are returned newest first")
+	assert.Equal(t, 3, deliveries[0].Attempt)
+	assert.Equal(t, 25*time.Millisecond, deliveries[0].Duration)
+	assert.Equal(t, "server error", deliveries[0].Error)
+
+	deliveries, err = s.GetWebhookDeliveries(ctx, webhook.ID, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ids[0], deliveries[0].ID)
+
+	deliveries, err = s.GetWebhookDeliveries(ctx, webhook.ID, -1, -1)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries, "negative bounds are treated as zero")
+
+	deliveries, err = s.GetWebhookDeliveries(ctx, "missing", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func testWebhookQueue(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	first, err := s.CreateWebhook(ctx, "https://example.com/first", "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+	second, err := s.CreateWebhook(ctx, "https://example.com/second", "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	var events []*domain.Event
+	for _, id := range []string{"post-1", "post-2"} {
+		event, err := storage.NewEvent(domain.EventPostCreated, &domain.Post{ID: id})
+		require.NoError(t, err)
+		require.NoError(t, s.EnqueueDeliveries(ctx, event, []string{first.ID, second.ID, "missing"}))
+		events = append(events, event)
+	}
+	require.NoError(t, s.EnqueueDeliveries(ctx, events[0], []string{first.ID}), "an event is queued once per webhook")
+
+	queued, err := s.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 4, "unknown webhooks are skipped")
+	assert.Equal(t, first.ID, queued[0].WebhookID)
+	assert.Equal(t, events[0].ID, queued[0].Event.ID)
+	assert.Equal(t, domain.EventPostCreated, queued[0].Event.Type)
+	assert.JSONEq(t, string(events[0].Data), string(queued[0].Event.Data))
+	assert.Zero(t, queued[0].Attempts)
+
+	// Каждый вебхук получает события по одному и по порядку
+	claimed, err := s.ClaimDeliveries(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	for _, delivery := range claimed {
+		assert.Equal(t, events[0].ID, delivery.Event.ID)
+		assert.Equal(t, 1, delivery.Attempts)
+	}
+	again, err := s.ClaimDeliveries(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, again, "claimed deliveries are leased")
+
+	byWebhook := map[string]*domain.QueuedDelivery{}
+	for _, delivery := range claimed {
+		byWebhook[delivery.WebhookID] = delivery
+	}
+	require.NoError(t, s.RemoveDelivery(ctx, byWebhook[first.ID].ID))
+	require.NoError(t, s.RetryDelivery(ctx, byWebhook[second.ID].ID, time.Now().Add(-time.Second)))
+
+	claimed, err = s.ClaimDeliveries(ctx, 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	for _, delivery := range claimed {
+		if delivery.WebhookID == first.ID {
+			assert.Equal(t, events[1].ID, delivery.Event.ID, "the next event follows a delivered one")
+			assert.Equal(t, 1, delivery.Attempts)
+		} else {
+			assert.Equal(t, events[0].ID, delivery.Event.ID, "a retried event stays at the head of its queue")
+			assert.Equal(t, 2, delivery.Attempts)
+		}
+	}
+
+	for _, delivery := range claimed {
+		require.NoError(t, s.RetryDelivery(ctx, delivery.ID, time.Now().Add(-time.Second)))
+	}
+	limited, err := s.ClaimDeliveries(ctx, 1, time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+
+	deleted, err := s.DeleteWebhook(ctx, second.ID)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	queued, err = s.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 1, "deleting a webhook drops its queue")
+	assert.Equal(t, first.ID, queued[0].WebhookID)
+
+	require.NoError(t, s.RemoveDelivery(ctx, "missing"), "removing twice is not an error")
+}
+
+func testOutbox(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	post := createPost(t, s, "Post", true)
+	comment := createComment(t, s, post.ID, nil, "Comment")
+	_, err := s.UpdateComment(ctx, comment.ID, "Edited")
+	require.NoError(t, err)
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, domain.EventPostCreated, events[0].Type)
+	assert.Equal(t, domain.EventCommentCreated, events[1].Type)
+	assert.Equal(t, domain.EventCommentUpdated, events[2].Type)
+	assert.Contains(t, string(events[0].Data), post.ID)
+
+	limited, err := s.GetPendingEvents(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, limited, 2)
+	assert.Equal(t, events[0].ID, limited[0].ID)
+
+	require.NoError(t, s.AckEvents(ctx, []string{events[0].ID, events[1].ID}))
+	remaining, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, events[2].ID, remaining[0].ID)
+
+	require.NoError(t, s.AckEvents(ctx, []string{events[0].ID}), "acknowledging twice is not an error")
+}
+
+func testConcurrentWrites(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	post := createPost(t, s, "Busy", true)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := s.CreateComment(ctx, post.ID, nil, "bob", fmt.Sprintf("Comment %d", i)); err != nil {
+				errs <- err
+			}
+			if _, err := s.EnsureUser(ctx, "shared"); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	comments, err := s.GetComments(ctx, post.ID, 2*writers, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, writers)
+
+	seen := make(map[string]bool)
+	for _, comment := range comments {
+		assert.False(t, seen[comment.ID], "comment IDs are unique")
+		seen[comment.ID] = true
+	}
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, events, writers+1)
+}
+
+func testUnitOfWork(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	var committed *domain.Comment
+	err := s.WithinTx(ctx, func(tx storage.Storage) error {
+		post, err := tx.CreatePost(ctx, "alice", "Committed", "Content", domain.ContentFormatPlain, true)
+		if err != nil {
+			return err
+		}
+		// Изменения видны внутри единицы работы, в том числе во вложенной
+		return tx.WithinTx(ctx, func(tx storage.Storage) error {
+			committed, err = tx.CreateComment(ctx, post.ID, nil, "bob", "Comment")
+			return err
+		})
+	})
+	require.NoError(t, err)
+	require.NotNil(t, committed)
+
+	stored, err := s.GetComment(ctx, committed.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored)
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	failure := errors.New("failure")
+	var discarded *domain.Post
+	err = s.WithinTx(ctx, func(tx storage.Storage) error {
+		if discarded, err = tx.CreatePost(ctx, "alice", "Discarded", "Content", domain.ContentFormatPlain, true); err != nil {
+			return err
+		}
+		if _, err := tx.UpdateComment(ctx, committed.ID, "Discarded edit"); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	missing, err := s.GetPost(ctx, discarded.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing, "changes of a failed unit of work are discarded")
+
+	stored, err = s.GetComment(ctx, committed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Comment", stored.Content)
+
+	after, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	assert.Len(t, after, len(events), "events of a failed unit of work are discarded")
+}
+
+func testRestore(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	user := &domain.User{Username: "alice", CreatedAt: createdAt}
+	post := &domain.Post{
+		ID:            "00000000-0000-0000-0000-000000000001",
+		Author:        "alice",
+		Title:         "Imported",
+		Content:       "Content",
+		ContentFormat: domain.ContentFormatMarkdown,
+		// Комментарии восстанавливаются и в закрытый пост
+		CommentsEnabled: false,
+		CreatedAt:       createdAt,
+	}
+	parent := &domain.Comment{
+		ID: "00000000-0000-0000-0000-000000000002", PostID: post.ID, Author: "bob",
+		Content: "Hi @alice", Mentions: []string{"alice"}, CreatedAt: createdAt.Add(time.Minute),
+	}
+	reply := &domain.Comment{
+		ID: "00000000-0000-0000-0000-000000000003", PostID: post.ID, ParentID: &parent.ID, Author: "alice",
+		Content: "Hi", Mentions: []string{}, CreatedAt: createdAt.Add(2 * time.Minute),
+	}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.RestoreUser(ctx, user))
+		require.NoError(t, s.RestorePost(ctx, post))
+		require.NoError(t, s.RestoreComment(ctx, parent))
+		require.NoError(t, s.RestoreComment(ctx, reply), "restoring twice is not an error")
+	}
+
+	users, err := s.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.True(t, users[0].CreatedAt.Equal(createdAt))
+
+	stored, err := s.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "alice", stored.Author)
+	assert.Equal(t, domain.ContentFormatMarkdown, stored.ContentFormat)
+	assert.False(t, stored.CommentsEnabled)
+	assert.True(t, stored.CreatedAt.Equal(createdAt), "timestamps are kept")
+
+	comments, err := s.GetComments(ctx, post.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, parent.ID, comments[0].ID)
+	assert.Equal(t, []string{"alice"}, comments[0].Mentions)
+	assert.True(t, comments[0].CreatedAt.Equal(parent.CreatedAt))
+	require.NotNil(t, comments[1].ParentID)
+	assert.Equal(t, parent.ID, *comments[1].ParentID)
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	assert.Empty(t, events, "restoring does not publish events")
+}
+
+func testRestoreCopiedData(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	post := createPost(t, s, "Post", true)
+	comment := createComment(t, s, post.ID, nil, "Hi @alice")
+	pending, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+
+	notification := &domain.Notification{
+		ID: "00000000-0000-0000-0000-000000000001", Recipient: "alice", Type: domain.NotificationTypeMention,
+		PostID: post.ID, CommentID: comment.ID, Actor: "bob", Read: true, CreatedAt: createdAt,
+	}
+	webhook := &domain.Webhook{
+		ID: "00000000-0000-0000-0000-000000000002", URL: "https://example.com/hook", Secret: "s3cret",
+		EventTypes: []domain.EventType{domain.EventCommentCreated}, Active: true, CreatedAt: createdAt,
+	}
+	delivery := &domain.WebhookDelivery{
+		ID: "00000000-0000-0000-0000-000000000003", WebhookID: webhook.ID, EventID: "event", EventType: domain.EventCommentCreated,
+		Attempt: 2, StatusCode: 500, Error: "server error", Duration: 250 * time.Millisecond, CreatedAt: createdAt,
+	}
+	event := &domain.Event{
+		ID: "00000000-0000-0000-0000-000000000004", Type: domain.EventPostCreated,
+		Data: json.RawMessage(`{"id":"copied"}`), CreatedAt: createdAt,
+	}
+	queued := &domain.QueuedDelivery{
+		ID: "00000000-0000-0000-0000-000000000005", WebhookID: webhook.ID,
+		Event:    domain.Event{ID: "event", Type: domain.EventCommentCreated, Data: json.RawMessage(`{"id":"queued"}`), CreatedAt: createdAt},
+		Attempts: 2, NextAttemptAt: createdAt, CreatedAt: createdAt,
+	}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.RestoreNotification(ctx, notification))
+		require.NoError(t, s.RestoreWebhook(ctx, webhook))
+		require.NoError(t, s.RestoreWebhookDelivery(ctx, delivery))
+		require.NoError(t, s.RestoreEvent(ctx, event), "restoring twice is not an error")
+		require.NoError(t, s.RestoreQueuedDelivery(ctx, queued))
+	}
+
+	notifications, err := s.GetNotifications(ctx, "alice", false, 10, "")
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.True(t, notifications[0].Read, "the read state is kept")
+	assert.True(t, notifications[0].CreatedAt.Equal(createdAt))
+
+	webhooks, err := s.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "s3cret", webhooks[0].Secret)
+	assert.Equal(t, webhook.EventTypes, webhooks[0].EventTypes)
+
+	deliveries, err := s.GetWebhookDeliveries(ctx, webhook.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 250*time.Millisecond, deliveries[0].Duration)
+	assert.Equal(t, "server error", deliveries[0].Error)
+
+	events, err := s.GetPendingEvents(ctx, 100)
+	require.NoError(t, err)
+	require.Len(t, events, len(pending)+1)
+	assert.Equal(t, event.ID, events[len(events)-1].ID, "a restored event is dispatched after the pending ones")
+	assert.JSONEq(t, `{"id":"copied"}`, string(events[len(events)-1].Data))
+
+	queue, err := s.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	assert.Equal(t, queued.ID, queue[0].ID)
+	assert.Equal(t, 2, queue[0].Attempts)
+	assert.True(t, queue[0].NextAttemptAt.Equal(createdAt))
+	assert.True(t, queue[0].Event.CreatedAt.Equal(createdAt))
+	assert.JSONEq(t, `{"id":"queued"}`, string(queue[0].Event.Data))
+}
+
+func testHealthCheck(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	assert.NoError(t, s.HealthCheck(ctx))
+
+	// Проверка внутри единицы работы не должна ждать освободившегося соединения
+	err := s.WithinTx(ctx, func(tx storage.Storage) error {
+		createPost(t, tx, "Title", true)
+		return tx.HealthCheck(ctx)
+	})
+	assert.NoError(t, err)
+}
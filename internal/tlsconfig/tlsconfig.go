@@ -0,0 +1,154 @@
+// Package tlsconfig builds the TLS configuration of the server listeners:
+// a certificate reloaded from disk when it changes and optional client
+// certificate authentication.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often the certificate files are checked for
+// changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// Reloader serves a certificate and key pair read from files and reloads it
+// when the files change, so that renewed certificates are picked up without a
+// restart.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// loaded identifies the files the certificate was read from.
+	loaded fileVersion
+}
+
+type fileVersion struct {
+	certModTime, keyModTime time.Time
+	certSize, keySize       int64
+}
+
+// NewReloader reads the certificate and key pair. It fails when the pair
+// cannot be loaded, so that a misconfigured server does not start.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is meant for
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reads the files again when they have changed since the last load
+// and reports whether the certificate was replaced. On error the previous
+// certificate stays in use.
+func (r *Reloader) Reload() (bool, error) {
+	version, err := r.version()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && version == r.loaded
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.loaded = version
+	return true, nil
+}
+
+// Run checks the files for changes every interval until ctx is done.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Файлы могут обновляться не одновременно; при ошибке остаётся
+		// прежний сертификат, и загрузка повторяется на следующей проверке
+		reloaded, err := r.Reload()
+		if err != nil {
+			log.Printf("Keeping the current TLS certificate: %v", err)
+		} else if reloaded {
+			log.Printf("Reloaded TLS certificate from %s", r.certFile)
+		}
+	}
+}
+
+func (r *Reloader) version() (fileVersion, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{
+		certModTime: certInfo.ModTime(),
+		keyModTime:  keyInfo.ModTime(),
+		certSize:    certInfo.Size(),
+		keySize:     keyInfo.Size(),
+	}, nil
+}
+
+// Server returns the configuration of a listener serving the certificate of
+// r.
+func Server(r *Reloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// RequireClientCerts returns a copy of config that accepts only clients
+// presenting a certificate signed by one of the CAs in caFile.
+func RequireClientCerts(config *tls.Config, caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("client CA file contains no PEM certificates")
+	}
+
+	config = config.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.ClientCAs = pool
+	return config, nil
+}
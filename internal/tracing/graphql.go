@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL returns a gqlgen extension that creates a span per operation and,
+// with fields set, a child span per field resolved by a resolver method.
+func GraphQL(fields bool) graphql.HandlerExtension {
+	return graphQLExtension{fields: fields}
+}
+
+type graphQLExtension struct {
+	fields bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = graphQLExtension{}
+
+func (graphQLExtension) ExtensionName() string {
+	return "Tracing"
+}
+
+func (graphQLExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse wraps each response in a span. A subscription gets a
+// span per event it sends.
+func (graphQLExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	oc := graphql.GetOperationContext(ctx)
+
+	kind, name := "operation", oc.OperationName
+	if oc.Operation != nil {
+		kind = string(oc.Operation.Operation)
+		if name == "" {
+			name = oc.Operation.Name
+		}
+	}
+	spanName := "graphql." + kind
+	if name != "" {
+		spanName += " " + name
+	}
+
+	ctx, span := tracer().Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(oc.Stats.OperationStart),
+		trace.WithAttributes(
+			attribute.String("graphql.operation.type", kind),
+			attribute.String("graphql.operation.name", name),
+		))
+	defer span.End()
+
+	response := next(ctx)
+	if response != nil && len(response.Errors) > 0 {
+		span.SetStatus(codes.Error, response.Errors.Error())
+	}
+	return response
+}
+
+func (e graphQLExtension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	// Поля без резолвера только читают структуру и не заслуживают спана
+	if !e.fields || fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := tracer().Start(ctx, fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	defer span.End()
+
+	result, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
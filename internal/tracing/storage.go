@@ -0,0 +1,298 @@
+package tracing
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStorage creates a span for every call to the wrapped storage.
+type tracedStorage struct {
+	next    storage.Storage
+	backend attribute.KeyValue
+}
+
+// Storage wraps s so that its calls are traced under the given backend name.
+func Storage(s storage.Storage, backend string) storage.Storage {
+	return &tracedStorage{next: s, backend: attribute.String("storage.backend", backend)}
+}
+
+// start creates a child span of the span in ctx. Calls made outside a trace,
+// such as outbox polling, are not traced.
+func (s *tracedStorage) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	if parent := trace.SpanFromContext(ctx); !parent.SpanContext().IsValid() {
+		return ctx, parent
+	}
+	return tracer().Start(ctx, "storage."+method, trace.WithAttributes(s.backend))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Close closes the wrapped storage if it can be closed.
+func (s *tracedStorage) Close() error {
+	if closer, ok := s.next.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *tracedStorage) CreatePost(ctx context.Context, author, title, content string, format domain.ContentFormat, commentsEnabled bool) (result *domain.Post, err error) {
+	ctx, span := s.start(ctx, "CreatePost")
+	defer func() { end(span, err) }()
+	return s.next.CreatePost(ctx, author, title, content, format, commentsEnabled)
+}
+
+func (s *tracedStorage) GetPost(ctx context.Context, id string) (result *domain.Post, err error) {
+	ctx, span := s.start(ctx, "GetPost")
+	defer func() { end(span, err) }()
+	return s.next.GetPost(ctx, id)
+}
+
+func (s *tracedStorage) GetAllPosts(ctx context.Context) (result []*domain.Post, err error) {
+	ctx, span := s.start(ctx, "GetAllPosts")
+	defer func() { end(span, err) }()
+	return s.next.GetAllPosts(ctx)
+}
+
+func (s *tracedStorage) GetPosts(ctx context.Context, limit, offset int) (result []*domain.Post, err error) {
+	ctx, span := s.start(ctx, "GetPosts")
+	defer func() { end(span, err) }()
+	return s.next.GetPosts(ctx, limit, offset)
+}
+
+func (s *tracedStorage) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (result *domain.Post, err error) {
+	ctx, span := s.start(ctx, "SetCommentsEnabled")
+	defer func() { end(span, err) }()
+	return s.next.SetCommentsEnabled(ctx, postID, enabled)
+}
+
+func (s *tracedStorage) DeletePost(ctx context.Context, id string) (result bool, err error) {
+	ctx, span := s.start(ctx, "DeletePost")
+	defer func() { end(span, err) }()
+	return s.next.DeletePost(ctx, id)
+}
+
+func (s *tracedStorage) CreateComment(ctx context.Context, postID string, parentID *string, author, content string) (result *domain.Comment, err error) {
+	ctx, span := s.start(ctx, "CreateComment")
+	defer func() { end(span, err) }()
+	return s.next.CreateComment(ctx, postID, parentID, author, content)
+}
+
+func (s *tracedStorage) GetComment(ctx context.Context, id string) (result *domain.Comment, err error) {
+	ctx, span := s.start(ctx, "GetComment")
+	defer func() { end(span, err) }()
+	return s.next.GetComment(ctx, id)
+}
+
+func (s *tracedStorage) GetComments(ctx context.Context, postID string, limit, offset int) (result []*domain.Comment, err error) {
+	ctx, span := s.start(ctx, "GetComments")
+	defer func() { end(span, err) }()
+	return s.next.GetComments(ctx, postID, limit, offset)
+}
+
+func (s *tracedStorage) UpdateComment(ctx context.Context, id, content string) (result *domain.Comment, err error) {
+	ctx, span := s.start(ctx, "UpdateComment")
+	defer func() { end(span, err) }()
+	return s.next.UpdateComment(ctx, id, content)
+}
+
+func (s *tracedStorage) DeleteCommentThread(ctx context.Context, id string) (result int, err error) {
+	ctx, span := s.start(ctx, "DeleteCommentThread")
+	defer func() { end(span, err) }()
+	return s.next.DeleteCommentThread(ctx, id)
+}
+
+func (s *tracedStorage) SetMentions(ctx context.Context, commentID string, usernames []string) (result []string, err error) {
+	ctx, span := s.start(ctx, "SetMentions")
+	defer func() { end(span, err) }()
+	return s.next.SetMentions(ctx, commentID, usernames)
+}
+
+func (s *tracedStorage) EnsureUser(ctx context.Context, username string) (result *domain.User, err error) {
+	ctx, span := s.start(ctx, "EnsureUser")
+	defer func() { end(span, err) }()
+	return s.next.EnsureUser(ctx, username)
+}
+
+func (s *tracedStorage) GetUsers(ctx context.Context, usernames []string) (result []*domain.User, err error) {
+	ctx, span := s.start(ctx, "GetUsers")
+	defer func() { end(span, err) }()
+	return s.next.GetUsers(ctx, usernames)
+}
+
+func (s *tracedStorage) ListUsers(ctx context.Context) (result []*domain.User, err error) {
+	ctx, span := s.start(ctx, "ListUsers")
+	defer func() { end(span, err) }()
+	return s.next.ListUsers(ctx)
+}
+
+func (s *tracedStorage) CreateNotification(ctx context.Context, notification *domain.Notification) (result *domain.Notification, err error) {
+	ctx, span := s.start(ctx, "CreateNotification")
+	defer func() { end(span, err) }()
+	return s.next.CreateNotification(ctx, notification)
+}
+
+func (s *tracedStorage) GetNotifications(ctx context.Context, recipient string, unreadOnly bool, limit int, after string) (result []*domain.Notification, err error) {
+	ctx, span := s.start(ctx, "GetNotifications")
+	defer func() { end(span, err) }()
+	return s.next.GetNotifications(ctx, recipient, unreadOnly, limit, after)
+}
+
+func (s *tracedStorage) GetNotifiedUsers(ctx context.Context, commentID string, usernames []string) (result []string, err error) {
+	ctx, span := s.start(ctx, "GetNotifiedUsers")
+	defer func() { end(span, err) }()
+	return s.next.GetNotifiedUsers(ctx, commentID, usernames)
+}
+
+func (s *tracedStorage) MarkNotificationsRead(ctx context.Context, recipient string, ids []string) (result int, err error) {
+	ctx, span := s.start(ctx, "MarkNotificationsRead")
+	defer func() { end(span, err) }()
+	return s.next.MarkNotificationsRead(ctx, recipient, ids)
+}
+
+func (s *tracedStorage) CreateWebhook(ctx context.Context, url, secret string, eventTypes []domain.EventType) (result *domain.Webhook, err error) {
+	ctx, span := s.start(ctx, "CreateWebhook")
+	defer func() { end(span, err) }()
+	return s.next.CreateWebhook(ctx, url, secret, eventTypes)
+}
+
+func (s *tracedStorage) GetWebhooks(ctx context.Context) (result []*domain.Webhook, err error) {
+	ctx, span := s.start(ctx, "GetWebhooks")
+	defer func() { end(span, err) }()
+	return s.next.GetWebhooks(ctx)
+}
+
+func (s *tracedStorage) DeleteWebhook(ctx context.Context, id string) (result bool, err error) {
+	ctx, span := s.start(ctx, "DeleteWebhook")
+	defer func() { end(span, err) }()
+	return s.next.DeleteWebhook(ctx, id)
+}
+
+func (s *tracedStorage) CreateWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (result *domain.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "CreateWebhookDelivery")
+	defer func() { end(span, err) }()
+	return s.next.CreateWebhookDelivery(ctx, delivery)
+}
+
+func (s *tracedStorage) GetWebhookDeliveries(ctx context.Context, webhookID string, limit, offset int) (result []*domain.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "GetWebhookDeliveries")
+	defer func() { end(span, err) }()
+	return s.next.GetWebhookDeliveries(ctx, webhookID, limit, offset)
+}
+
+func (s *tracedStorage) EnqueueDeliveries(ctx context.Context, event *domain.Event, webhookIDs []string) (err error) {
+	ctx, span := s.start(ctx, "EnqueueDeliveries")
+	defer func() { end(span, err) }()
+	return s.next.EnqueueDeliveries(ctx, event, webhookIDs)
+}
+
+func (s *tracedStorage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (result []*domain.QueuedDelivery, err error) {
+	ctx, span := s.start(ctx, "ClaimDeliveries")
+	defer func() { end(span, err) }()
+	return s.next.ClaimDeliveries(ctx, limit, lease)
+}
+
+func (s *tracedStorage) RetryDelivery(ctx context.Context, id string, at time.Time) (err error) {
+	ctx, span := s.start(ctx, "RetryDelivery")
+	defer func() { end(span, err) }()
+	return s.next.RetryDelivery(ctx, id, at)
+}
+
+func (s *tracedStorage) RemoveDelivery(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "RemoveDelivery")
+	defer func() { end(span, err) }()
+	return s.next.RemoveDelivery(ctx, id)
+}
+
+func (s *tracedStorage) GetQueuedDeliveries(ctx context.Context, limit int) (result []*domain.QueuedDelivery, err error) {
+	ctx, span := s.start(ctx, "GetQueuedDeliveries")
+	defer func() { end(span, err) }()
+	return s.next.GetQueuedDeliveries(ctx, limit)
+}
+
+func (s *tracedStorage) GetPendingEvents(ctx context.Context, limit int) (result []*domain.Event, err error) {
+	ctx, span := s.start(ctx, "GetPendingEvents")
+	defer func() { end(span, err) }()
+	return s.next.GetPendingEvents(ctx, limit)
+}
+
+func (s *tracedStorage) AckEvents(ctx context.Context, ids []string) (err error) {
+	ctx, span := s.start(ctx, "AckEvents")
+	defer func() { end(span, err) }()
+	return s.next.AckEvents(ctx, ids)
+}
+
+func (s *tracedStorage) RestoreUser(ctx context.Context, user *domain.User) (err error) {
+	ctx, span := s.start(ctx, "RestoreUser")
+	defer func() { end(span, err) }()
+	return s.next.RestoreUser(ctx, user)
+}
+
+func (s *tracedStorage) RestorePost(ctx context.Context, post *domain.Post) (err error) {
+	ctx, span := s.start(ctx, "RestorePost")
+	defer func() { end(span, err) }()
+	return s.next.RestorePost(ctx, post)
+}
+
+func (s *tracedStorage) RestoreComment(ctx context.Context, comment *domain.Comment) (err error) {
+	ctx, span := s.start(ctx, "RestoreComment")
+	defer func() { end(span, err) }()
+	return s.next.RestoreComment(ctx, comment)
+}
+
+func (s *tracedStorage) RestoreNotification(ctx context.Context, notification *domain.Notification) (err error) {
+	ctx, span := s.start(ctx, "RestoreNotification")
+	defer func() { end(span, err) }()
+	return s.next.RestoreNotification(ctx, notification)
+}
+
+func (s *tracedStorage) RestoreWebhook(ctx context.Context, webhook *domain.Webhook) (err error) {
+	ctx, span := s.start(ctx, "RestoreWebhook")
+	defer func() { end(span, err) }()
+	return s.next.RestoreWebhook(ctx, webhook)
+}
+
+func (s *tracedStorage) RestoreWebhookDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (err error) {
+	ctx, span := s.start(ctx, "RestoreWebhookDelivery")
+	defer func() { end(span, err) }()
+	return s.next.RestoreWebhookDelivery(ctx, delivery)
+}
+
+func (s *tracedStorage) RestoreEvent(ctx context.Context, event *domain.Event) (err error) {
+	ctx, span := s.start(ctx, "RestoreEvent")
+	defer func() { end(span, err) }()
+	return s.next.RestoreEvent(ctx, event)
+}
+
+func (s *tracedStorage) RestoreQueuedDelivery(ctx context.Context, delivery *domain.QueuedDelivery) (err error) {
+	ctx, span := s.start(ctx, "RestoreQueuedDelivery")
+	defer func() { end(span, err) }()
+	return s.next.RestoreQueuedDelivery(ctx, delivery)
+}
+
+func (s *tracedStorage) WithinTx(ctx context.Context, fn func(tx storage.Storage) error) (err error) {
+	ctx, span := s.start(ctx, "WithinTx")
+	defer func() { end(span, err) }()
+	return s.next.WithinTx(ctx, func(tx storage.Storage) error {
+		return fn(&tracedStorage{next: tx, backend: s.backend})
+	})
+}
+
+func (s *tracedStorage) HealthCheck(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "HealthCheck")
+	defer func() { end(span, err) }()
+	return s.next.HealthCheck(ctx)
+}
+
+var _ storage.Storage = (*tracedStorage)(nil)
@@ -0,0 +1,119 @@
+// Package tracing configures OpenTelemetry tracing and traces GraphQL
+// operations, resolvers and storage calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "ArticleForum"
+
+// Exporters supported by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Options struct {
+	// Exporter is ExporterNone, ExporterStdout or ExporterOTLP.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector address, such as
+	// "localhost:4318". When empty the OTEL_EXPORTER_OTLP_* environment
+	// variables apply.
+	Endpoint string
+	// Insecure sends spans to Endpoint over plain HTTP. By default they are
+	// sent over HTTPS.
+	Insecure bool
+	// ServiceName is reported unless OTEL_SERVICE_NAME is set.
+	ServiceName string
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch options.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if options.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(options.Endpoint))
+		}
+		if options.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", options.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", options.ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// HTTP wraps a handler routing with http.ServeMux in a server span per
+// request, named after the method and the matched route, or after operation
+// when no route matched. Apply it directly to the mux, so that the route is
+// visible to it.
+func HTTP(next http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(next, operation,
+		// Без этого otelhttp берёт провайдер удалённого спана из Middleware,
+		// который ничего не записывает
+		otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern == "" {
+				return operation
+			}
+			// Шаблон маршрута может уже начинаться с метода
+			if strings.Contains(r.Pattern, " ") {
+				return r.Pattern
+			}
+			return r.Method + " " + r.Pattern
+		}))
+}
+
+// Middleware continues the trace given in the W3C traceparent header of the
+// request, if any.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
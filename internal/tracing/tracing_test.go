@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"ArticleForum/internal/graph"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"ArticleForum/internal/storage/storagetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestTracedStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return Storage(memory.NewMemoryStorage(), "memory")
+	})
+}
+
+func TestGraphQLTracing(t *testing.T) {
+	for _, fields := range []bool{false, true} {
+		recorder := record(t)
+
+		store := Storage(memory.NewMemoryStorage(), "memory")
+		srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
+		srv.AddTransport(transport.POST{})
+		srv.Use(GraphQL(fields))
+
+		req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query":"query Feed { posts { id title } }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		Middleware(srv).ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+
+		operation, ok := spans["graphql.query Feed"]
+		require.True(t, ok)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", operation.SpanContext().TraceID().String(), "the trace continues the incoming traceparent")
+		assert.Equal(t, "00f067aa0ba902b7", operation.Parent().SpanID().String())
+
+		storageSpan, ok := spans["storage.GetAllPosts"]
+		require.True(t, ok)
+		assert.Equal(t, operation.SpanContext().TraceID(), storageSpan.SpanContext().TraceID())
+
+		field, ok := spans["Query.posts"]
+		assert.Equal(t, fields, ok)
+		if fields {
+			assert.Equal(t, field.SpanContext().SpanID(), storageSpan.Parent().SpanID())
+		} else {
+			assert.Equal(t, operation.SpanContext().SpanID(), storageSpan.Parent().SpanID())
+		}
+		assert.NotContains(t, spans, "Post.title", "fields without resolvers are not traced")
+	}
+}
+
+func TestHTTPTracing(t *testing.T) {
+	recorder := record(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api/v1/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Middleware(HTTP(mux, "rest"))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/posts/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/elsewhere", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "DELETE /api/v1/posts/{id}", spans[0].Name(), "spans are named after the route, not the path")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String(), "the trace continues the incoming traceparent")
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, "GET /api/v1/openapi.json", spans[1].Name())
+	assert.Equal(t, "rest", spans[2].Name(), "unrouted requests are named after the operation")
+}
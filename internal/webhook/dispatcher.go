@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	EventHeader     = "X-ArticleForum-Event"
+	DeliveryHeader  = "X-ArticleForum-Delivery"
+	SignatureHeader = "X-ArticleForum-Signature"
+)
+
+// claimBatchSize limits how many deliveries one poll of the queue starts.
+const claimBatchSize = 100
+
+type Options struct {
+	// MaxAttempts is how many times a delivery is tried before giving up.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it doubles with
+	// every further attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// PollInterval is how often Run looks for due deliveries.
+	PollInterval time.Duration
+	// Lease is how long a claimed delivery is hidden from other workers. It
+	// must outlast an attempt, or the delivery may be attempted twice.
+	Lease  time.Duration
+	Client *http.Client
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		PollInterval:   time.Second,
+		Lease:          time.Minute,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Dispatcher delivers forum events to the webhooks subscribed to them and
+// records every delivery attempt. Dispatch queues the deliveries of an event
+// and Run performs them, so a slow or failing receiver delays only its own
+// webhook.
+type Dispatcher struct {
+	storage storage.Storage
+	options Options
+	// wake makes Run claim again as soon as a delivery finishes, so that the
+	// next event of its webhook does not wait for the poll interval.
+	wake chan struct{}
+}
+
+func NewDispatcher(storage storage.Storage, options Options) *Dispatcher {
+	defaults := DefaultOptions()
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaults.MaxAttempts
+	}
+	if options.InitialBackoff <= 0 {
+		options.InitialBackoff = defaults.InitialBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaults.MaxBackoff
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaults.PollInterval
+	}
+	if options.Lease <= 0 {
+		options.Lease = defaults.Lease
+	}
+	if options.Client == nil {
+		options.Client = defaults.Client
+	}
+
+	return &Dispatcher{
+		storage: storage,
+		options: options,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the value of the signature header for body: the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch queues the event for every active webhook subscribed to its type
+// and returns once the deliveries are stored, so the relay can acknowledge
+// the event without waiting for receivers. An event dispatched twice is
+// queued once per webhook. Its signature matches outbox.Handler.
+func (d *Dispatcher) Dispatch(ctx context.Context, event *domain.Event) error {
+	webhooks, err := d.storage.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, webhook := range webhooks {
+		if webhook.Active && slices.Contains(webhook.EventTypes, event.Type) {
+			ids = append(ids, webhook.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.storage.EnqueueDeliveries(ctx, event, ids)
+}
+
+// Run delivers queued events until ctx is done, then waits for the attempts
+// in progress. Each webhook receives its events in order, one at a time;
+// failed attempts are retried with exponential backoff until MaxAttempts is
+// reached. Several servers may run it against the same storage.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		deliveries, err := d.storage.ClaimDeliveries(ctx, claimBatchSize, d.options.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim webhook deliveries: %v", err)
+		}
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+				select {
+				case d.wake <- struct{}{}:
+				default:
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliver makes one attempt of a claimed delivery, records it and then
+// removes the delivery from the queue or schedules its retry.
+func (d *Dispatcher) deliver(ctx context.Context, queued *domain.QueuedDelivery) {
+	// Начатая попытка доводится до конца, её ограничивает таймаут клиента
+	ctx = context.WithoutCancel(ctx)
+
+	webhooks, err := d.storage.GetWebhooks(ctx)
+	if err != nil {
+		log.Printf("Failed to load webhook %s: %v", queued.WebhookID, err)
+		return
+	}
+	i := slices.IndexFunc(webhooks, func(w *domain.Webhook) bool { return w.ID == queued.WebhookID })
+	if i < 0 || !webhooks[i].Active {
+		// Отключённый вебхук событий не получает
+		d.remove(ctx, queued)
+		return
+	}
+
+	body, err := json.Marshal(&queued.Event)
+	if err != nil {
+		log.Printf("Failed to encode event %s: %v", queued.Event.ID, err)
+		d.remove(ctx, queued)
+		return
+	}
+
+	delivery := d.attempt(ctx, webhooks[i], &queued.Event, body)
+	delivery.Attempt = queued.Attempts
+	if _, err := d.storage.CreateWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("Failed to record delivery of event %s to webhook %s: %v", queued.Event.ID, queued.WebhookID, err)
+	}
+
+	if delivery.Success || queued.Attempts >= d.options.MaxAttempts {
+		d.remove(ctx, queued)
+		return
+	}
+	if err := d.storage.RetryDelivery(ctx, queued.ID, time.Now().Add(d.backoff(queued.Attempts))); err != nil {
+		// Повтор произойдёт после истечения аренды
+		log.Printf("Failed to schedule retry of event %s to webhook %s: %v", queued.Event.ID, queued.WebhookID, err)
+	}
+}
+
+func (d *Dispatcher) remove(ctx context.Context, queued *domain.QueuedDelivery) {
+	if err := d.storage.RemoveDelivery(ctx, queued.ID); err != nil {
+		log.Printf("Failed to dequeue event %s for webhook %s: %v", queued.Event.ID, queued.WebhookID, err)
+	}
+}
+
+// backoff returns the delay after the given failed attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.options.InitialBackoff
+	for i := 1; i < attempt && backoff < d.options.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.options.MaxBackoff)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, webhook *domain.Webhook, event *domain.Event, body []byte) *domain.WebhookDelivery {
+	delivery := &domain.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+
+	start := time.Now()
+	resp, err := d.options.Client.Do(req)
+	delivery.Duration = time.Since(start)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return delivery
+}
@@ -0,0 +1,259 @@
+package webhook
+
+import (
+	"ArticleForum/internal/domain"
+	"ArticleForum/internal/storage"
+	"ArticleForum/internal/storage/memory"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run runs the dispatcher until the test ends.
+func run(t *testing.T, dispatcher *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	var calls atomic.Int32
+	received := make(chan *domain.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Первая попытка завершается ошибкой, чтобы проверить повтор
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event domain.Event
+		if err := json.Unmarshal(body, &event); err == nil {
+			received <- &event
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	subscribed, err := store.CreateWebhook(ctx, receiver.URL, "secret", []domain.EventType{domain.EventCommentCreated})
+	require.NoError(t, err)
+	other, err := store.CreateWebhook(ctx, receiver.URL, "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	dispatcher := NewDispatcher(store, Options{InitialBackoff: time.Millisecond, PollInterval: time.Millisecond})
+	event, err := storage.NewEvent(domain.EventCommentCreated, &domain.Comment{ID: "comment-1", Content: "Hello"})
+	require.NoError(t, err)
+
+	// Dispatch только ставит доставку в очередь
+	require.NoError(t, dispatcher.Dispatch(ctx, event))
+	require.NoError(t, dispatcher.Dispatch(ctx, event))
+	queued, err := store.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 1, "a dispatched again event is queued once")
+	assert.Equal(t, subscribed.ID, queued[0].WebhookID)
+	assert.Zero(t, calls.Load())
+
+	run(t, dispatcher)
+	select {
+	case got := <-received:
+		assert.Equal(t, event.ID, got.ID)
+		assert.Equal(t, domain.EventCommentCreated, got.Type)
+		assert.JSONEq(t, string(event.Data), string(got.Data))
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+
+	require.Eventually(t, func() bool {
+		queued, err := store.GetQueuedDeliveries(ctx, 10)
+		return err == nil && len(queued) == 0
+	}, time.Second, 5*time.Millisecond, "a delivered event leaves the queue")
+
+	deliveries, err := store.GetWebhookDeliveries(ctx, subscribed.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.True(t, deliveries[0].Success)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+	assert.False(t, deliveries[1].Success)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[1].StatusCode)
+
+	deliveries, err = store.GetWebhookDeliveries(ctx, other.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	webhook, err := store.CreateWebhook(ctx, receiver.URL, "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	dispatcher := NewDispatcher(store, Options{MaxAttempts: 3, InitialBackoff: time.Millisecond, PollInterval: time.Millisecond})
+	event, err := storage.NewEvent(domain.EventPostCreated, &domain.Post{ID: "post-1"})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.Dispatch(ctx, event))
+	run(t, dispatcher)
+
+	require.Eventually(t, func() bool {
+		queued, err := store.GetQueuedDeliveries(ctx, 10)
+		return err == nil && len(queued) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	deliveries, err := store.GetWebhookDeliveries(ctx, webhook.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	for i, delivery := range deliveries {
+		assert.False(t, delivery.Success)
+		assert.Equal(t, http.StatusBadGateway, delivery.StatusCode)
+		assert.Equal(t, 3-i, delivery.Attempt)
+	}
+}
+
+func TestDispatcherSlowReceiver(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	defer close(release)
+	var fast atomic.Int32
+	quick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fast.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer quick.Close()
+
+	stalled, err := store.CreateWebhook(ctx, slow.URL, "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+	_, err = store.CreateWebhook(ctx, quick.URL, "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	dispatcher := NewDispatcher(store, Options{PollInterval: time.Millisecond})
+	for _, id := range []string{"post-1", "post-2"} {
+		event, err := storage.NewEvent(domain.EventPostCreated, &domain.Post{ID: id})
+		require.NoError(t, err)
+		require.NoError(t, dispatcher.Dispatch(ctx, event))
+	}
+	run(t, dispatcher)
+
+	// Медленный получатель не задерживает другие вебхуки
+	require.Eventually(t, func() bool { return fast.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	// а его собственные события ждут своей очереди
+	queued, err := store.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, queued, 2)
+	for _, delivery := range queued {
+		assert.Equal(t, stalled.ID, delivery.WebhookID)
+	}
+	assert.Equal(t, 1, queued[0].Attempts)
+	assert.Zero(t, queued[1].Attempts)
+}
+
+func TestDispatcherPostUpdated(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	received := make(chan *domain.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event domain.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			received <- &event
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	_, err := store.CreateWebhook(ctx, receiver.URL, "secret", []domain.EventType{domain.EventPostUpdated})
+	require.NoError(t, err)
+	post, err := store.CreatePost(ctx, "alice", "Title", "Content", domain.ContentFormatPlain, true)
+	require.NoError(t, err)
+	_, err = store.SetCommentsEnabled(ctx, post.ID, false)
+	require.NoError(t, err)
+
+	dispatcher := NewDispatcher(store, Options{PollInterval: time.Millisecond})
+	events, err := store.GetPendingEvents(ctx, 10)
+	require.NoError(t, err)
+	for _, event := range events {
+		require.NoError(t, dispatcher.Dispatch(ctx, event))
+	}
+	run(t, dispatcher)
+
+	select {
+	case got := <-received:
+		assert.Equal(t, domain.EventPostUpdated, got.Type)
+		var updated domain.Post
+		require.NoError(t, json.Unmarshal(got.Data, &updated))
+		assert.Equal(t, post.ID, updated.ID)
+		assert.False(t, updated.CommentsEnabled)
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("unsubscribed event %s was delivered", got.Type)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestDispatcherSkipsRemovedWebhooks(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryStorage()
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	webhook, err := store.CreateWebhook(ctx, receiver.URL, "secret", []domain.EventType{domain.EventPostCreated})
+	require.NoError(t, err)
+
+	dispatcher := NewDispatcher(store, Options{PollInterval: time.Millisecond})
+	event, err := storage.NewEvent(domain.EventPostCreated, &domain.Post{ID: "post-1"})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.Dispatch(ctx, event))
+
+	deleted, err := store.DeleteWebhook(ctx, webhook.ID)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	queued, err := store.GetQueuedDeliveries(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, queued, "deleting a webhook drops its queue")
+
+	run(t, dispatcher)
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, calls.Load())
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+// Commands lists the subcommands accepted by Command.
+var Commands = []string{"up", "down", "redo", "status", "version"}
+
+// Command runs a goose subcommand against the embedded migrations and writes
+// a human-readable report to out:
+//
+//	up       apply all pending migrations
+//	down     roll back the latest migration
+//	redo     roll back the latest migration and apply it again
+//	status   list migrations and whether they are applied
+//	version  print the current schema version
+func Command(ctx context.Context, db *sql.DB, dialect goose.Dialect, command string, out io.Writer) error {
+	provider, err := NewProvider(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		printResults(out, results)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+	case "down":
+		result, err := provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		printResults(out, []*goose.MigrationResult{result})
+	case "redo":
+		down, err := provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		up, err := provider.UpByOne(ctx)
+		printResults(out, []*goose.MigrationResult{down, up})
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+		}
+		return w.Flush()
+	case "version":
+		current, target, err := provider.GetVersions(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "version %d (latest %d)\n", current, target)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected one of %v", command, Commands)
+	}
+	return nil
+}
+
+func printResults(out io.Writer, results []*goose.MigrationResult) {
+	for _, result := range results {
+		if result != nil {
+			fmt.Fprintln(out, result)
+		}
+	}
+}
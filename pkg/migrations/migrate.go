@@ -1,16 +1,61 @@
 package migrations
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
-	"os"
-	"path/filepath"
 
 	_ "github.com/lib/pq"
 	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
 )
 
+// Файлы миграций встроены в бинарник, поэтому не зависят от рабочего каталога
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+const (
+	Postgres = goose.DialectPostgres
+	SQLite   = goose.DialectSQLite3
+)
+
+// ErrSchemaVersion is returned by CheckVersion when the database schema does
+// not match the migrations built into the binary.
+var ErrSchemaVersion = errors.New("database schema version mismatch")
+
+// NewProvider returns a goose provider for the embedded migrations of the
+// dialect.
+func NewProvider(db *sql.DB, dialect goose.Dialect) (*goose.Provider, error) {
+	var dir string
+	var options []goose.ProviderOption
+	switch dialect {
+	case Postgres:
+		dir = "postgres"
+		// Advisory-блокировка не даёт нескольким экземплярам применять
+		// миграции одновременно
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, goose.WithSessionLocker(locker))
+	case SQLite:
+		dir = "sqlite"
+	default:
+		return nil, fmt.Errorf("unsupported migration dialect: %s", dialect)
+	}
+
+	fsys, err := fs.Sub(files, dir)
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(dialect, db, fsys, options...)
+}
+
 func RunMigrations(dsn string) error {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -18,23 +63,39 @@ func RunMigrations(dsn string) error {
 	}
 	defer db.Close()
 
-	migrationsDir, err := filepath.Abs("./migrations")
+	return Up(context.Background(), db, Postgres)
+}
+
+// Up applies all pending migrations.
+func Up(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := NewProvider(db, dialect)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for migrations: %v", err)
+		return err
 	}
 
-	if _, err := os.Stat(migrationsDir); os.IsNotExist(err) {
-		return fmt.Errorf("migrations directory does not exist: %s", migrationsDir)
+	if _, err := provider.Up(ctx); err != nil {
+		return fmt.Errorf("failed to apply migrations: %v", err)
 	}
 
-	if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("failed to set dialect: %v", err)
-	}
+	log.Println("Migrations applied successfully")
+	return nil
+}
 
-	if err := goose.Up(db, migrationsDir); err != nil {
-		return fmt.Errorf("failed to apply migrations: %v", err)
+// CheckVersion verifies that the database has exactly the migrations built
+// into the binary applied.
+func CheckVersion(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := NewProvider(db, dialect)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Migrations applied successfully")
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if current != target {
+		return fmt.Errorf("%w: database is at version %d, this build expects %d; apply the migrations first",
+			ErrSchemaVersion, current, target)
+	}
 	return nil
 }
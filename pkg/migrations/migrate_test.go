@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		entries, err := files.ReadDir(dialect)
+		require.NoError(t, err)
+		assert.NotEmpty(t, entries, "%s migrations are embedded", dialect)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "forum.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = CheckVersion(ctx, db, SQLite)
+	assert.ErrorIs(t, err, ErrSchemaVersion, "an empty database is rejected")
+
+	require.NoError(t, Up(ctx, db, SQLite))
+	assert.NoError(t, CheckVersion(ctx, db, SQLite))
+}
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "forum.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var out strings.Builder
+	require.NoError(t, Command(ctx, db, SQLite, "status", &out))
+	assert.Contains(t, out.String(), "pending")
+
+	out.Reset()
+	require.NoError(t, Command(ctx, db, SQLite, "up", &out))
+	assert.Contains(t, out.String(), "OK    up 00001_init.sql")
+	assert.Contains(t, out.String(), "OK    up 00002_webhook_queue.sql")
+
+	out.Reset()
+	require.NoError(t, Command(ctx, db, SQLite, "redo", &out))
+	assert.Contains(t, out.String(), "down 00002_webhook_queue.sql")
+	assert.NoError(t, CheckVersion(ctx, db, SQLite))
+
+	out.Reset()
+	require.NoError(t, Command(ctx, db, SQLite, "down", &out))
+	assert.ErrorIs(t, CheckVersion(ctx, db, SQLite), ErrSchemaVersion)
+
+	assert.Error(t, Command(ctx, db, SQLite, "sideways", &out))
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_format TEXT NOT NULL DEFAULT 'plain';
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN IF EXISTS content_format;
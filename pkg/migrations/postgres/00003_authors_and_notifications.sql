@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS author TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS author TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id TEXT PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    type TEXT NOT NULL,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id TEXT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    actor TEXT NOT NULL DEFAULT '',
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(recipient, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_notifications_recipient;
+DROP TABLE IF EXISTS notifications;
+ALTER TABLE comments DROP COLUMN IF EXISTS author;
+ALTER TABLE posts DROP COLUMN IF EXISTS author;